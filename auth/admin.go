@@ -0,0 +1,24 @@
+// Package auth guards the endpoints only staff may use
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RequireAdmin lets through only requests carrying token as a bearer token.
+// Without a configured token every request is turned away.
+func RequireAdmin(token string) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		given, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"success": false,
+				"error":   "admin token required",
+			})
+		}
+		return c.Next()
+	}
+}
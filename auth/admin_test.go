@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		status        int
+	}{
+		{"matching token", "secret", "Bearer secret", fiber.StatusOK},
+		{"wrong token", "secret", "Bearer guess", fiber.StatusUnauthorized},
+		{"missing header", "secret", "", fiber.StatusUnauthorized},
+		{"no token configured", "", "Bearer ", fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/admin", RequireAdmin(tt.token), func(c fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+			req := httptest.NewRequest(fiber.MethodGet, "/admin", nil)
+			if tt.authorization != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.authorization)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("expected %d, got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+}
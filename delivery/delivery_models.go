@@ -1,6 +1,12 @@
 package delivery
 
-import "gorm.io/gorm"
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
 
 // CreateQuoteRequest represents a bare minimum request to create a delivery quote with DoorDash Drive API.
 // All fields are required by the DoorDash Drive API.
@@ -14,6 +20,15 @@ type CreateQuoteRequest struct {
 	// PickupPhoneNumber is the phone number at pickup location (E.164 format recommended, e.g., +14155552671)
 	PickupPhoneNumber string `json:"pickup_phone_number" binding:"required"`
 
+	// PickupBusinessName is shown to the dasher at pickup
+	PickupBusinessName string `json:"pickup_business_name,omitempty"`
+
+	// PickupInstructions are shown to the dasher at pickup
+	PickupInstructions string `json:"pickup_instructions,omitempty"`
+
+	// PickupTime is the ISO 8601 timestamp the order will be ready for the dasher
+	PickupTime string `json:"pickup_time,omitempty"`
+
 	// DropoffAddress is the full street address of the dropoff location (must include city, state, ZIP)
 	DropoffAddress string `json:"dropoff_address" binding:"required"`
 
@@ -22,6 +37,9 @@ type CreateQuoteRequest struct {
 
 	// OrderValue is the order value in cents (e.g., $20.00 = 2000)
 	OrderValue int `json:"order_value" binding:"required,min=0"`
+
+	// DropoffInstructions are shown to the dasher at dropoff
+	DropoffInstructions string `json:"dropoff_instructions,omitempty"`
 }
 
 // CreateQuoteResponse represents the response from DoorDash Drive API after creating a delivery quote.
@@ -40,9 +58,33 @@ type CreateQuoteResponse struct {
 
 	// ExpiresAt is the ISO 8601 timestamp when this quote expires
 	ExpiresAt string `json:"expires_at"`
+
+	// DropoffTimeEstimated is the ISO 8601 timestamp the provider expects to drop off by
+	DropoffTimeEstimated string `json:"dropoff_time_estimated,omitempty"`
+}
+
+// IsExpired reports whether the quote can no longer be accepted at now. A
+// quote without a readable expiry is treated as expired.
+func (q *CreateQuoteResponse) IsExpired(now time.Time) bool {
+	expiresAt, err := time.Parse(time.RFC3339, q.ExpiresAt)
+	if err != nil {
+		return true
+	}
+	return !now.Before(expiresAt)
+}
+
+// DropoffETA returns the estimated dropoff time, or false when the provider gave none
+func (q *CreateQuoteResponse) DropoffETA() (time.Time, bool) {
+	eta, err := time.Parse(time.RFC3339, q.DropoffTimeEstimated)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return eta, true
 }
 
 type QuoteResult struct {
+	// Provider is the provider the quote came from
+	Provider Provider
 	Response *CreateQuoteResponse
 	Error    error
 }
@@ -58,31 +100,262 @@ type DoorDashConfig struct {
 
 	// SigningSecret is your DoorDash signing secret used to generate HMAC-SHA256 signatures
 	SigningSecret string `json:"signing_secret"`
+
+	// BaseURL is the root of the Drive API, defaults to https://openapi.doordash.com.
+	// Point it at a doordashsim server for tests and offline development.
+	BaseURL string `json:"base_url"`
+
+	// HTTPClient sends the API requests, defaults to a plain http.Client
+	HTTPClient *http.Client `json:"-"`
 }
 
 // DeliveryQuoteParams contains all the parameters needed to request a delivery quote.
 type DeliveryQuoteParams struct {
+	// ExternalDeliveryID identifies the delivery in our system, generated when empty
+	ExternalDeliveryID string
+
 	// PickupAddress is the restaurant/store address where the order will be picked up
 	PickupAddress string
 
 	// PickupPhoneNumber is the restaurant/store phone number (E.164 format recommended)
 	PickupPhoneNumber string
 
+	// PickupBusinessName is the name of the location the order is picked up from
+	PickupBusinessName string
+
+	// PickupInstructions are notes for the driver at pickup, e.g. where to park
+	PickupInstructions string
+
+	// PickupLat and PickupLng locate the pickup, when known, for providers
+	// that dispatch by distance
+	PickupLat *float64
+	PickupLng *float64
+
+	// PickupTime is when the order will be ready, if known, so the driver
+	// isn't sent before the food is
+	PickupTime *time.Time
+
 	// DropoffAddress is the customer's delivery address
 	DropoffAddress string
 
 	// DropoffPhoneNumber is the customer's phone number (E.164 format recommended)
 	DropoffPhoneNumber string
 
+	// DropoffInstructions are notes for the driver, e.g. a gate code
+	DropoffInstructions string
+
 	// OrderValue is the order total in cents (e.g., $20.00 = 2000)
 	OrderValue int
 }
 
+// AcceptQuoteRequest is the optional body for accepting a quote. The tip and
+// dropoff phone number may still change between quoting and accepting.
+type AcceptQuoteRequest struct {
+	// Tip is the dasher tip in cents
+	Tip int `json:"tip,omitempty"`
+
+	// DropoffPhoneNumber overrides the phone number given when quoting
+	DropoffPhoneNumber string `json:"dropoff_phone_number,omitempty"`
+}
+
+// CreateDeliveryRequest creates a delivery directly, without accepting a quote first
+type CreateDeliveryRequest struct {
+	// ExternalDeliveryID is a unique identifier for the delivery from your system
+	ExternalDeliveryID string `json:"external_delivery_id"`
+
+	// PickupAddress is the full street address of the pickup location
+	PickupAddress string `json:"pickup_address"`
+
+	// PickupBusinessName is shown to the dasher at pickup
+	PickupBusinessName string `json:"pickup_business_name,omitempty"`
+
+	// PickupPhoneNumber is the phone number at pickup location
+	PickupPhoneNumber string `json:"pickup_phone_number"`
+
+	// PickupInstructions are shown to the dasher at pickup
+	PickupInstructions string `json:"pickup_instructions,omitempty"`
+
+	// DropoffAddress is the full street address of the dropoff location
+	DropoffAddress string `json:"dropoff_address"`
+
+	// DropoffPhoneNumber is the phone number at dropoff location
+	DropoffPhoneNumber string `json:"dropoff_phone_number"`
+
+	// DropoffInstructions are shown to the dasher at dropoff
+	DropoffInstructions string `json:"dropoff_instructions,omitempty"`
+
+	// OrderValue is the order value in cents
+	OrderValue int `json:"order_value"`
+
+	// Tip is the dasher tip in cents
+	Tip int `json:"tip,omitempty"`
+}
+
+// UpdateDeliveryRequest changes a delivery that has not been picked up yet.
+// Empty fields are left unchanged.
+type UpdateDeliveryRequest struct {
+	DropoffAddress      string `json:"dropoff_address,omitempty"`
+	DropoffPhoneNumber  string `json:"dropoff_phone_number,omitempty"`
+	DropoffInstructions string `json:"dropoff_instructions,omitempty"`
+	PickupInstructions  string `json:"pickup_instructions,omitempty"`
+	Tip                 *int   `json:"tip,omitempty"`
+}
+
+// DeliveryResponse is a delivery as returned by the DoorDash Drive API
+type DeliveryResponse struct {
+	// ExternalDeliveryID is the unique identifier that was sent when quoting or creating
+	ExternalDeliveryID string `json:"external_delivery_id"`
+
+	// SupportReference is DoorDash's own identifier for the delivery
+	SupportReference string `json:"support_reference"`
+
+	// DeliveryStatus is DoorDash's status, e.g. "created", "picked_up" or "delivered"
+	DeliveryStatus string `json:"delivery_status"`
+
+	// Currency is the currency code (e.g., "USD")
+	Currency string `json:"currency"`
+
+	// Fee is the delivery fee in cents
+	Fee int64 `json:"fee"`
+
+	// Tip is the dasher tip in cents
+	Tip int `json:"tip"`
+
+	// OrderValue is the order value in cents
+	OrderValue int `json:"order_value"`
+
+	PickupAddress  string `json:"pickup_address"`
+	DropoffAddress string `json:"dropoff_address"`
+
+	// TrackingURL is a page where the customer can follow the delivery
+	TrackingURL string `json:"tracking_url"`
+
+	// Dasher details are only set once a dasher has accepted the delivery
+	DasherID                 int64  `json:"dasher_id,omitempty"`
+	DasherName               string `json:"dasher_name,omitempty"`
+	DasherDropoffPhoneNumber string `json:"dasher_dropoff_phone_number,omitempty"`
+
+	// PickupTimeEstimated and DropoffTimeEstimated are ISO 8601 timestamps
+	PickupTimeEstimated  string `json:"pickup_time_estimated,omitempty"`
+	DropoffTimeEstimated string `json:"dropoff_time_estimated,omitempty"`
+
+	// CancellationReason is set when the delivery was cancelled
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+}
+
 // DeliveryData contains delivery address and contact information
 type DeliveryData struct {
 	gorm.Model
 	Address     string
 	PhoneNumber string
-	OrderID     uint
+	// Unit is the apartment or suite, kept apart from the street line when entered
+	Unit string
+	// DropoffInstructions are notes for the driver, e.g. a gate code
+	DropoffInstructions string
+	// Lat and Lng locate the dropoff, set from the geocoded address and
+	// needed when delivery zones are configured
+	Lat     *float64
+	Lng     *float64
+	OrderID uint
+	// Zone is the delivery zone the dropoff fell in, if zones are configured
+	Zone string
+	// ProviderFee is what the provider charges us; the order's delivery fee is
+	// what the customer pays after any zone override or subsidy
+	ProviderFee int64
+	// Provider is the delivery provider whose quote was chosen, DoorDash when empty
+	Provider Provider
+	// ExternalDeliveryID is the ID we sent to the provider for this delivery
+	ExternalDeliveryID string `gorm:"index"`
+	// QuoteID is the provider's ID for the quote the fee came from
+	QuoteID string
+	// ProviderDeliveryID is the provider's own ID, set once the delivery is dispatched
+	ProviderDeliveryID string
+	// ProviderStatus is the provider's latest status for the delivery
+	ProviderStatus string
+	// TrackingURL lets the customer follow the delivery
+	TrackingURL string
+	// Status is where the delivery is, driven by provider webhooks
+	Status DeliveryStatus
+	// Dasher details, set once a dasher has accepted the delivery
+	DasherID          int64
+	DasherName        string
+	DasherPhoneNumber string
 	// Order       Order // this would cause circ dep, use hasOne vs this belongsTo relation
 }
+
+// ApplyAddress replaces the entered address with its normalized form and location
+func (d *DeliveryData) ApplyAddress(a *Address) {
+	if a.Unit == "" && d.Unit != "" {
+		a.Unit = formatUnit(d.Unit)
+	}
+	d.Address = a.String()
+	d.Unit = a.Unit
+	d.Lat = &a.Lat
+	d.Lng = &a.Lng
+	if a.DropoffInstructions != "" && d.DropoffInstructions == "" {
+		d.DropoffInstructions = a.DropoffInstructions
+	}
+}
+
+// Location returns the dropoff position, or false when it isn't known
+func (d *DeliveryData) Location() (Point, bool) {
+	if d.Lat == nil || d.Lng == nil {
+		return Point{}, false
+	}
+	return Point{Lat: *d.Lat, Lng: *d.Lng}, true
+}
+
+// ApplyResponse copies the provider's view of the delivery onto the record
+func (d *DeliveryData) ApplyResponse(res *DeliveryResponse) {
+	if res.ExternalDeliveryID != "" {
+		d.ExternalDeliveryID = res.ExternalDeliveryID
+	}
+	if res.SupportReference != "" {
+		d.ProviderDeliveryID = res.SupportReference
+	}
+	if res.DeliveryStatus != "" {
+		d.ProviderStatus = res.DeliveryStatus
+	}
+	if res.TrackingURL != "" {
+		d.TrackingURL = res.TrackingURL
+	}
+	if res.DasherID != 0 {
+		d.DasherID = res.DasherID
+		d.DasherName = res.DasherName
+		d.DasherPhoneNumber = res.DasherDropoffPhoneNumber
+	}
+	if status, ok := (WebhookEvent{EventName: res.DeliveryStatus}).Status(); ok && d.Status.CanAdvance(status) {
+		d.Status = status
+	}
+}
+
+// ApplyEvent records a webhook event on the delivery. It returns whether the
+// delivery status advanced; events older than the current status only update
+// the dasher and tracking details.
+func (d *DeliveryData) ApplyEvent(e WebhookEvent) bool {
+	if e.SupportReference != "" {
+		d.ProviderDeliveryID = e.SupportReference
+	}
+	if e.TrackingURL != "" {
+		d.TrackingURL = e.TrackingURL
+	}
+	if e.DasherID != 0 {
+		d.DasherID = e.DasherID
+	}
+	if e.DasherName != "" {
+		d.DasherName = e.DasherName
+	}
+	if e.DasherDropoffPhoneNumber != "" {
+		d.DasherPhoneNumber = e.DasherDropoffPhoneNumber
+	}
+	if e.EventName != "" {
+		d.ProviderStatus = strings.ToLower(e.EventName)
+	}
+
+	status, ok := e.Status()
+	if !ok || !d.Status.CanAdvance(status) {
+		return false
+	}
+	d.Status = status
+	return true
+}
@@ -0,0 +1,199 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Provider names a delivery provider
+type Provider string
+
+const (
+	ProviderDoorDash Provider = "doordash"
+	// ProviderInHouse is our own drivers
+	ProviderInHouse Provider = "in_house"
+)
+
+// QuotePolicy decides which of several provider quotes an order uses
+type QuotePolicy string
+
+const (
+	// CheapestQuote picks the lowest fee, the earliest dropoff on a tie
+	CheapestQuote QuotePolicy = "cheapest"
+	// FastestQuote picks the earliest estimated dropoff, the lowest fee on a tie.
+	// Quotes without an estimate rank behind those with one.
+	FastestQuote QuotePolicy = "fastest"
+)
+
+var (
+	// ErrUnknownProvider is returned for a provider that was never registered
+	ErrUnknownProvider = errors.New("unknown delivery provider")
+	// ErrNoProviders is returned when quoting with every provider disabled
+	ErrNoProviders = errors.New("no delivery providers enabled")
+)
+
+// ParseQuotePolicy parses a policy name, defaulting to CheapestQuote when empty
+func ParseQuotePolicy(s string) (QuotePolicy, error) {
+	switch QuotePolicy(s) {
+	case "":
+		return CheapestQuote, nil
+	case CheapestQuote, FastestQuote:
+		return QuotePolicy(s), nil
+	}
+	return "", fmt.Errorf("unknown quote policy %q", s)
+}
+
+// Registry holds the delivery providers we can send orders with. Quotes are
+// requested from every enabled provider; disabled providers still serve the
+// deliveries they already have.
+type Registry struct {
+	mu        sync.RWMutex
+	policy    QuotePolicy
+	providers map[Provider]DeliveryService
+	enabled   map[Provider]bool
+	// names keeps registration order; the first provider is the default
+	names []Provider
+}
+
+// NewRegistry creates an empty registry choosing quotes by policy
+func NewRegistry(policy QuotePolicy) *Registry {
+	return &Registry{
+		policy:    policy,
+		providers: make(map[Provider]DeliveryService),
+		enabled:   make(map[Provider]bool),
+	}
+}
+
+// Register adds an enabled provider, replacing any registered under the same name
+func (r *Registry) Register(name Provider, service DeliveryService) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.providers[name]; !exists {
+		r.names = append(r.names, name)
+	}
+	r.providers[name] = service
+	r.enabled[name] = true
+}
+
+// SetEnabled includes or excludes a provider from quoting
+func (r *Registry) SetEnabled(name Provider, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.providers[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	r.enabled[name] = enabled
+	return nil
+}
+
+// Get returns the named provider. An empty name returns the default provider,
+// so deliveries recorded before providers were tracked keep working.
+func (r *Registry) Get(name Provider) (DeliveryService, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" && len(r.names) > 0 {
+		name = r.names[0]
+	}
+	service, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return service, nil
+}
+
+// RequestQuote asks every enabled provider for a quote concurrently and
+// returns the best one per the registry's policy. All providers share ctx's
+// deadline; providers that fail or miss it are left out. The error joins every
+// provider's failure when none of them quoted.
+func (r *Registry) RequestQuote(ctx context.Context, params DeliveryQuoteParams) (*QuoteResult, error) {
+	r.mu.RLock()
+	var names []Provider
+	for _, name := range r.names {
+		if r.enabled[name] {
+			names = append(names, name)
+		}
+	}
+	services := make([]DeliveryService, len(names))
+	for i, name := range names {
+		services[i] = r.providers[name]
+	}
+	policy := r.policy
+	r.mu.RUnlock()
+
+	if len(names) == 0 {
+		return nil, ErrNoProviders
+	}
+
+	// Every provider quotes under the same ID, so whichever wins can be accepted by it
+	if params.ExternalDeliveryID == "" {
+		params.ExternalDeliveryID = uuid.New().String()
+	}
+
+	results := make([]QuoteResult, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := services[i].RequestQuote(ctx, params)
+			if err == nil && res == nil {
+				err = errors.New("empty quote")
+			}
+			results[i] = QuoteResult{Provider: names[i], Response: res, Error: err}
+		}(i)
+	}
+	wg.Wait()
+
+	var best *QuoteResult
+	var errs []error
+	for i := range results {
+		result := &results[i]
+		if result.Error != nil {
+			log.Printf("%s quote error: %v", result.Provider, result.Error)
+			errs = append(errs, fmt.Errorf("%s: %w", result.Provider, result.Error))
+			continue
+		}
+		if best == nil || policy.prefers(result.Response, best.Response) {
+			best = result
+		}
+	}
+	if best == nil {
+		return nil, errors.Join(errs...)
+	}
+	log.Printf("chose %s quote: Fee=%d, ID=%s", best.Provider, best.Response.Fee, best.Response.ID)
+	return best, nil
+}
+
+// prefers reports whether quote a beats quote b under the policy
+func (p QuotePolicy) prefers(a, b *CreateQuoteResponse) bool {
+	if p == FastestQuote {
+		if c := compareETA(a, b); c != 0 {
+			return c < 0
+		}
+		return a.Fee < b.Fee
+	}
+	if a.Fee != b.Fee {
+		return a.Fee < b.Fee
+	}
+	return compareETA(a, b) < 0
+}
+
+// compareETA orders quotes by estimated dropoff, those without one last
+func compareETA(a, b *CreateQuoteResponse) int {
+	etaA, okA := a.DropoffETA()
+	etaB, okB := b.DropoffETA()
+	switch {
+	case okA && okB:
+		return etaA.Compare(etaB)
+	case okA:
+		return -1
+	case okB:
+		return 1
+	}
+	return 0
+}
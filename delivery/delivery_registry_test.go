@@ -0,0 +1,111 @@
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"folo/delivery"
+	"folo/delivery/doordashsim"
+)
+
+func TestRegistry_PicksQuotePerPolicy(t *testing.T) {
+	cheap, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 600, Latency: 10 * time.Millisecond})
+	pricey, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 900})
+
+	registry := delivery.NewRegistry(delivery.CheapestQuote)
+	registry.Register("cheap", cheap)
+	registry.Register("pricey", pricey)
+
+	result, err := registry.RequestQuote(context.Background(), testQuoteParams)
+	if err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+	if result.Provider != "cheap" || result.Response.Fee != 600 {
+		t.Errorf("expected the cheap quote, got %s at %d", result.Provider, result.Response.Fee)
+	}
+
+	if err := registry.SetEnabled("cheap", false); err != nil {
+		t.Fatalf("unexpected error disabling provider: %v", err)
+	}
+	result, err = registry.RequestQuote(context.Background(), testQuoteParams)
+	if err != nil || result.Provider != "pricey" {
+		t.Errorf("expected only the enabled provider to quote, got %+v (err %v)", result, err)
+	}
+
+	// Disabled providers still serve the deliveries they have
+	if service, err := registry.Get("cheap"); err != nil || service != cheap {
+		t.Errorf("expected disabled provider to be found, got %v", err)
+	}
+	if _, err := registry.Get("unknown"); !errors.Is(err, delivery.ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestRegistry_SkipsFailingAndSlowProviders(t *testing.T) {
+	failing, sim := newSimulatedService(t, doordashsim.Config{QuoteFee: 100})
+	slow, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 200, Latency: 300 * time.Millisecond})
+	working, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 800})
+	sim.InjectFault(doordashsim.Fault{Status: http.StatusInternalServerError})
+
+	registry := delivery.NewRegistry(delivery.CheapestQuote)
+	registry.Register("failing", failing)
+	registry.Register("slow", slow)
+	registry.Register("working", working)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	result, err := registry.RequestQuote(ctx, testQuoteParams)
+	if err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+	if result.Provider != "working" {
+		t.Errorf("expected the only successful quote to win, got %s", result.Provider)
+	}
+
+	registry.SetEnabled("working", false)
+	sim.InjectFault(doordashsim.Fault{Status: http.StatusInternalServerError})
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := registry.RequestQuote(ctx, testQuoteParams); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the joined error to include the timeout, got %v", err)
+	}
+}
+
+func TestQuotePolicy_Fastest(t *testing.T) {
+	now := time.Now()
+	fast := &stubProvider{quote: &delivery.CreateQuoteResponse{Fee: 900, DropoffTimeEstimated: now.Add(20 * time.Minute).Format(time.RFC3339)}}
+	slow := &stubProvider{quote: &delivery.CreateQuoteResponse{Fee: 500, DropoffTimeEstimated: now.Add(50 * time.Minute).Format(time.RFC3339)}}
+	unknown := &stubProvider{quote: &delivery.CreateQuoteResponse{Fee: 100}}
+
+	registry := delivery.NewRegistry(delivery.FastestQuote)
+	registry.Register("unknown", unknown)
+	registry.Register("slow", slow)
+	registry.Register("fast", fast)
+
+	result, err := registry.RequestQuote(context.Background(), testQuoteParams)
+	if err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+	if result.Provider != "fast" {
+		t.Errorf("expected the earliest dropoff to win, got %s", result.Provider)
+	}
+	if fast.params.ExternalDeliveryID == "" || fast.params.ExternalDeliveryID != slow.params.ExternalDeliveryID {
+		t.Errorf("expected every provider to quote under the same delivery ID")
+	}
+}
+
+// stubProvider returns a fixed quote and records what it was asked for
+type stubProvider struct {
+	delivery.DeliveryService
+	quote  *delivery.CreateQuoteResponse
+	params delivery.DeliveryQuoteParams
+}
+
+func (s *stubProvider) RequestQuote(ctx context.Context, params delivery.DeliveryQuoteParams) (*delivery.CreateQuoteResponse, error) {
+	s.params = params
+	return s.quote, nil
+}
@@ -5,10 +5,13 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -18,6 +21,28 @@ import (
 // DeliveryService defines the interface for delivery operations
 type DeliveryService interface {
 	RequestQuote(ctx context.Context, params DeliveryQuoteParams) (*CreateQuoteResponse, error)
+	AcceptQuote(ctx context.Context, externalDeliveryID string, req AcceptQuoteRequest) (*DeliveryResponse, error)
+	CreateDelivery(ctx context.Context, req CreateDeliveryRequest) (*DeliveryResponse, error)
+	GetDelivery(ctx context.Context, externalDeliveryID string) (*DeliveryResponse, error)
+	UpdateDelivery(ctx context.Context, externalDeliveryID string, req UpdateDeliveryRequest) (*DeliveryResponse, error)
+	CancelDelivery(ctx context.Context, externalDeliveryID string) error
+}
+
+// ErrDeliveryNotFound is returned when the provider has no delivery for the given ID,
+// e.g. when only a quote was requested and the delivery was never created
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// DefaultDoorDashBaseURL is the root of the production DoorDash Drive API
+const DefaultDoorDashBaseURL = "https://openapi.doordash.com"
+
+// APIError is returned when DoorDash answers with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("doordash API returned status %d: %s", e.StatusCode, e.Body)
 }
 
 // DoorDashService handles DoorDash API interactions
@@ -28,9 +53,16 @@ type DoorDashService struct {
 
 // NewDoorDashService creates a new DoorDash service
 func NewDoorDashService(config DoorDashConfig) *DoorDashService {
+	if config.BaseURL == "" {
+		config.BaseURL = DefaultDoorDashBaseURL
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{}
+	}
 	return &DoorDashService{
 		config: config,
-		client: &http.Client{},
+		client: client,
 	}
 }
 
@@ -74,82 +106,163 @@ func (s *DoorDashService) generateJWT() (string, error) {
 // RequestQuote creates a delivery quote with DoorDash Drive API.
 // This is a synchronous method that can be called from a goroutine.
 func (s *DoorDashService) RequestQuote(ctx context.Context, params DeliveryQuoteParams) (*CreateQuoteResponse, error) {
-	log.Printf("entered goroutine call")
-	// Check if context is already cancelled before starting
-	select {
-	case <-ctx.Done():
-		log.Printf("triggered done case")
-		return nil, ctx.Err()
-	default:
-		log.Printf("triggered default case")
+	externalDeliveryID := params.ExternalDeliveryID
+	if externalDeliveryID == "" {
+		externalDeliveryID = uuid.New().String()
 	}
 
 	// Prepare the request payload
 	createQuoteReq := CreateQuoteRequest{
-		ExternalDeliveryID: uuid.New().String(),
-		PickupAddress:      params.PickupAddress,
-		PickupPhoneNumber:  params.PickupPhoneNumber,
-		DropoffAddress:     params.DropoffAddress,
-		DropoffPhoneNumber: params.DropoffPhoneNumber,
-		OrderValue:         params.OrderValue,
+		ExternalDeliveryID:  externalDeliveryID,
+		PickupAddress:       params.PickupAddress,
+		PickupPhoneNumber:   params.PickupPhoneNumber,
+		PickupBusinessName:  params.PickupBusinessName,
+		PickupInstructions:  params.PickupInstructions,
+		DropoffAddress:      params.DropoffAddress,
+		DropoffPhoneNumber:  params.DropoffPhoneNumber,
+		OrderValue:          params.OrderValue,
+		DropoffInstructions: params.DropoffInstructions,
+	}
+	if params.PickupTime != nil {
+		createQuoteReq.PickupTime = params.PickupTime.UTC().Format(time.RFC3339)
 	}
 
-	// Marshal request to JSON
-	jsonData, err := json.Marshal(createQuoteReq)
-	if err != nil {
-		log.Printf("error serializing delivery data: %s", err.Error())
+	createQuoteRes := new(CreateQuoteResponse)
+	if err := s.do(ctx, http.MethodPost, "/drive/v2/quotes", createQuoteReq, createQuoteRes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("created quote with id: %v", createQuoteReq.ExternalDeliveryID)
+	return createQuoteRes, nil
+}
+
+// AcceptQuote turns a quote into a delivery at the quoted fee. Quotes expire
+// a few minutes after they are issued.
+func (s *DoorDashService) AcceptQuote(ctx context.Context, externalDeliveryID string, req AcceptQuoteRequest) (*DeliveryResponse, error) {
+	res := new(DeliveryResponse)
+	path := fmt.Sprintf("/drive/v2/quotes/%s/accept", url.PathEscape(externalDeliveryID))
+	if err := s.do(ctx, http.MethodPost, path, req, res); err != nil {
+		return nil, err
+	}
+	log.Printf("accepted quote for delivery with id: %v", externalDeliveryID)
+	return res, nil
+}
+
+// CreateDelivery creates a delivery without a prior quote
+func (s *DoorDashService) CreateDelivery(ctx context.Context, req CreateDeliveryRequest) (*DeliveryResponse, error) {
+	if req.ExternalDeliveryID == "" {
+		req.ExternalDeliveryID = uuid.New().String()
+	}
+	res := new(DeliveryResponse)
+	if err := s.do(ctx, http.MethodPost, "/drive/v2/deliveries", req, res); err != nil {
+		return nil, err
+	}
+	log.Printf("created delivery with id: %v", req.ExternalDeliveryID)
+	return res, nil
+}
+
+// GetDelivery returns DoorDash's current view of a delivery
+func (s *DoorDashService) GetDelivery(ctx context.Context, externalDeliveryID string) (*DeliveryResponse, error) {
+	res := new(DeliveryResponse)
+	path := fmt.Sprintf("/drive/v2/deliveries/%s", url.PathEscape(externalDeliveryID))
+	if err := s.do(ctx, http.MethodGet, path, nil, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// UpdateDelivery changes the dropoff details or tip of a delivery
+func (s *DoorDashService) UpdateDelivery(ctx context.Context, externalDeliveryID string, req UpdateDeliveryRequest) (*DeliveryResponse, error) {
+	res := new(DeliveryResponse)
+	path := fmt.Sprintf("/drive/v2/deliveries/%s", url.PathEscape(externalDeliveryID))
+	if err := s.do(ctx, http.MethodPatch, path, req, res); err != nil {
 		return nil, err
 	}
+	log.Printf("updated delivery with id: %v", externalDeliveryID)
+	return res, nil
+}
+
+// CancelDelivery cancels a delivery with DoorDash Drive API.
+// Returns ErrDeliveryNotFound if DoorDash has no delivery with the given ID.
+func (s *DoorDashService) CancelDelivery(ctx context.Context, externalDeliveryID string) error {
+	path := fmt.Sprintf("/drive/v2/deliveries/%s/cancel", url.PathEscape(externalDeliveryID))
+	if err := s.do(ctx, http.MethodPut, path, nil, nil); err != nil {
+		return err
+	}
+	log.Printf("canceled delivery with id: %v", externalDeliveryID)
+	return nil
+}
+
+// do sends an authenticated request to the Drive API and decodes the response
+// into out. Body and out may be nil. A 404 is reported as ErrDeliveryNotFound
+// and any other non-2xx status as an *APIError.
+func (s *DoorDashService) do(ctx context.Context, method, path string, body any, out any) error {
+	// Check if context is already cancelled before starting
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			log.Printf("error serializing delivery data: %s", err.Error())
+			return err
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
 
 	// Create HTTP request with context for proper cancellation support
-	reqUrl := "https://openapi.doordash.com/drive/v2/quotes"
-	req, err := http.NewRequestWithContext(ctx, "POST", reqUrl, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.config.BaseURL, "/")+path, reqBody)
 	if err != nil {
 		log.Printf("error creating request: %s", err.Error())
-		return nil, err
+		return err
 	}
 
 	// Generate JWT for authentication
 	jwtToken, err := s.generateJWT()
 	if err != nil {
 		log.Printf("error generating JWT: %s", err.Error())
-		return nil, err
+		return err
 	}
 
 	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", jwtToken))
 
 	// Make the HTTP request
 	res, err := s.client.Do(req)
 	if err != nil {
 		log.Printf("error getting response from doordash: %s", err.Error())
-		return nil, err
+		return err
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		bodyReader, _ := io.ReadAll(res.Body)
-		log.Printf("DoorDash API error: status=%d, body=%s", res.StatusCode,
-			string(bodyReader))
-		return nil, fmt.Errorf("doordash API returned status %d: %s", res.StatusCode,
-			string(bodyReader))
-	}
-
 	// Read response body
 	bodyReader, err := io.ReadAll(res.Body)
 	if err != nil {
 		log.Printf("error reading response body: %s", err.Error())
-		return nil, err
+		return err
 	}
 
+	if res.StatusCode == http.StatusNotFound {
+		return ErrDeliveryNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		log.Printf("DoorDash API error: status=%d, body=%s", res.StatusCode,
+			string(bodyReader))
+		return &APIError{StatusCode: res.StatusCode, Body: string(bodyReader)}
+	}
+
+	if out == nil {
+		return nil
+	}
 	// Unmarshal the response
-	createQuoteRes := new(CreateQuoteResponse)
-	if err := json.Unmarshal(bodyReader, createQuoteRes); err != nil {
+	if err := json.Unmarshal(bodyReader, out); err != nil {
 		log.Printf("error unmarshaling response: %s", err.Error())
-		return nil, err
+		return err
 	}
-
-	log.Printf("created quote with id: %v", createQuoteReq.ExternalDeliveryID)
-	return createQuoteRes, nil
+	return nil
 }
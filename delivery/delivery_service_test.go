@@ -1,37 +1,47 @@
-package delivery
+package delivery_test
 
 import (
 	"context"
-	"os"
+	"errors"
+	"net/http"
 	"testing"
 	"time"
 
-	"github.com/joho/godotenv"
+	"folo/delivery"
+	"folo/delivery/doordashsim"
 )
 
+var testQuoteParams = delivery.DeliveryQuoteParams{
+	PickupAddress:      "303 2nd Street, San Francisco, CA 94105",
+	PickupPhoneNumber:  "+14155551234",
+	DropoffAddress:     "5 Embarcadero Ctr, San Francisco, CA 94111",
+	DropoffPhoneNumber: "+14155555678",
+	OrderValue:         2000,
+}
+
+// newSimulatedService starts a DoorDash simulator and a service pointed at it
+func newSimulatedService(t *testing.T, config doordashsim.Config) (*delivery.DoorDashService, *doordashsim.Simulator) {
+	t.Helper()
+	sim := doordashsim.New(config)
+	t.Cleanup(sim.Close)
+	return delivery.NewDoorDashService(sim.DoorDashConfig()), sim
+}
+
 func TestRequestQuote_RespectsContextCancellation(t *testing.T) {
-	config := DoorDashConfig{
+	config := delivery.DoorDashConfig{
 		DeveloperID:   "test-dev-id",
 		KeyID:         "test-key-id",
 		SigningSecret: "dGVzdC1zaWduaW5nLXNlY3JldA==",
 	}
 
-	service := NewDoorDashService(config)
+	service := delivery.NewDoorDashService(config)
 
 	// Create a context that's already cancelled
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	params := DeliveryQuoteParams{
-		PickupAddress:      "123 Test St",
-		PickupPhoneNumber:  "+14155551234",
-		DropoffAddress:     "456 Test Ave",
-		DropoffPhoneNumber: "+14155555678",
-		OrderValue:         2000,
-	}
-
 	// Call your function
-	_, err := service.RequestQuote(ctx, params)
+	_, err := service.RequestQuote(ctx, testQuoteParams)
 
 	// Assert that it returned context.Canceled error
 	if err != context.Canceled {
@@ -40,13 +50,7 @@ func TestRequestQuote_RespectsContextCancellation(t *testing.T) {
 }
 
 func TestRequestQuote_RespectsTimeout(t *testing.T) {
-	godotenv.Load(".env")
-	doorDashConfig := DoorDashConfig{
-		DeveloperID:   os.Getenv("DOORDASH_DEVELOPER_ID"),
-		KeyID:         os.Getenv("DOORDASH_KEY_ID"),
-		SigningSecret: os.Getenv("DOORDASH_SIGNING_SECRET"),
-	}
-	service := NewDoorDashService(doorDashConfig)
+	service, _ := newSimulatedService(t, doordashsim.Config{})
 
 	// Context with very short timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Nanosecond)
@@ -54,15 +58,7 @@ func TestRequestQuote_RespectsTimeout(t *testing.T) {
 
 	time.Sleep(10 * time.Millisecond) // Ensure timeout happens
 
-	params := DeliveryQuoteParams{
-		PickupAddress:      "123 Test St",
-		PickupPhoneNumber:  "+14155551234",
-		DropoffAddress:     "456 Test Ave",
-		DropoffPhoneNumber: "+14155555678",
-		OrderValue:         2000,
-	}
-
-	_, err := service.RequestQuote(ctx, params)
+	_, err := service.RequestQuote(ctx, testQuoteParams)
 
 	// Assert timeout error
 	if err != context.DeadlineExceeded {
@@ -70,32 +66,129 @@ func TestRequestQuote_RespectsTimeout(t *testing.T) {
 	}
 }
 
-func TestRequestQuote_Succeeds(t *testing.T) {
-	godotenv.Load("../.env")
-	doorDashConfig := DoorDashConfig{
-		DeveloperID:   os.Getenv("DOORDASH_DEVELOPER_ID"),
-		KeyID:         os.Getenv("DOORDASH_KEY_ID"),
-		SigningSecret: os.Getenv("DOORDASH_SIGNING_SECRET"),
+func TestRequestQuote_TimesOutOnSlowProvider(t *testing.T) {
+	service, _ := newSimulatedService(t, doordashsim.Config{Latency: 200 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := service.RequestQuote(ctx, testQuoteParams)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
 	}
-	service := NewDoorDashService(doorDashConfig)
+}
+
+func TestRequestQuote_Succeeds(t *testing.T) {
+	service, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 1250})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	params := DeliveryQuoteParams{
-		PickupAddress:      "303 2nd Street, San Francisco, CA 94105",
-		PickupPhoneNumber:  "+14155551234",
-		DropoffAddress:     "5 Embarcadero Ctr, San Francisco, CA 94111",
-		DropoffPhoneNumber: "+14155555678",
-		OrderValue:         2000,
+	deliveryQuote, err := service.RequestQuote(ctx, testQuoteParams)
+	if err != nil {
+		t.Fatalf("Expected happy path, got %v", err)
 	}
 
+	t.Logf("response id from doordash %v", deliveryQuote.ID)
+	if deliveryQuote.Fee != 1250 || deliveryQuote.ExternalDeliveryID == "" {
+		t.Errorf("unexpected quote %+v", deliveryQuote)
+	}
+}
+
+func TestRequestQuote_SendsPickupTime(t *testing.T) {
+	service, _ := newSimulatedService(t, doordashsim.Config{QuoteFee: 1250})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pickupTime := time.Now().Add(time.Hour).Truncate(time.Second)
+	params := testQuoteParams
+	params.PickupTime = &pickupTime
 	deliveryQuote, err := service.RequestQuote(ctx, params)
+	if err != nil {
+		t.Fatalf("Expected happy path, got %v", err)
+	}
 
-	t.Logf("response id from doordash %v", deliveryQuote.ID)
+	dropoff, err := time.Parse(time.RFC3339, deliveryQuote.DropoffTimeEstimated)
+	if err != nil || dropoff.Before(pickupTime) {
+		t.Errorf("expected dropoff after the %s pickup, got %q", pickupTime, deliveryQuote.DropoffTimeEstimated)
+	}
+}
 
-	// Assert timeout error
+func TestRequestQuote_RejectedWithWrongCredentials(t *testing.T) {
+	sim := doordashsim.New(doordashsim.Config{})
+	t.Cleanup(sim.Close)
+
+	config := sim.DoorDashConfig()
+	config.KeyID = "someone-elses-key"
+	service := delivery.NewDoorDashService(config)
+
+	_, err := service.RequestQuote(context.Background(), testQuoteParams)
+	var apiErr *delivery.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 APIError, got %v", err)
+	}
+}
+
+func TestRequestQuote_SurfacesProviderFaults(t *testing.T) {
+	service, sim := newSimulatedService(t, doordashsim.Config{})
+
+	sim.InjectFault(doordashsim.Fault{Status: http.StatusServiceUnavailable, Body: `{"code":"service_unavailable"}`})
+	_, err := service.RequestQuote(context.Background(), testQuoteParams)
+	var apiErr *delivery.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 APIError, got %v", err)
+	}
+
+	sim.InjectFault(doordashsim.Fault{Malformed: true})
+	if _, err := service.RequestQuote(context.Background(), testQuoteParams); err == nil {
+		t.Errorf("expected an error for a malformed response")
+	}
+
+	// Faults are used up, so the next request goes through
+	if _, err := service.RequestQuote(context.Background(), testQuoteParams); err != nil {
+		t.Errorf("expected the request after the faults to succeed, got %v", err)
+	}
+}
+
+func TestDeliveryLifecycle(t *testing.T) {
+	service, sim := newSimulatedService(t, doordashsim.Config{})
+	ctx := context.Background()
+
+	params := testQuoteParams
+	params.ExternalDeliveryID = "order-42"
+	if _, err := service.RequestQuote(ctx, params); err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+
+	accepted, err := service.AcceptQuote(ctx, "order-42", delivery.AcceptQuoteRequest{Tip: 300})
 	if err != nil {
-		t.Errorf("Expected happy path, got %v", err)
+		t.Fatalf("unexpected error accepting quote: %v", err)
+	}
+	if accepted.DeliveryStatus != "created" || accepted.SupportReference == "" || accepted.Tip != 300 {
+		t.Errorf("unexpected accepted delivery %+v", accepted)
+	}
+
+	tip := 500
+	updated, err := service.UpdateDelivery(ctx, "order-42", delivery.UpdateDeliveryRequest{Tip: &tip})
+	if err != nil || updated.Tip != 500 {
+		t.Fatalf("expected tip to be updated, got %+v (err %v)", updated, err)
+	}
+
+	if err := sim.EmitEvent(ctx, "order-42", "DASHER_PICKED_UP"); err != nil {
+		t.Fatalf("unexpected error emitting event: %v", err)
+	}
+	fetched, err := service.GetDelivery(ctx, "order-42")
+	if err != nil || fetched.DeliveryStatus != "picked_up" {
+		t.Fatalf("expected picked_up, got %+v (err %v)", fetched, err)
+	}
+
+	// A picked up delivery can't be cancelled any more
+	var apiErr *delivery.APIError
+	if err := service.CancelDelivery(ctx, "order-42"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("expected a 409 APIError, got %v", err)
+	}
+	if err := service.CancelDelivery(ctx, "unknown"); !errors.Is(err, delivery.ErrDeliveryNotFound) {
+		t.Errorf("expected ErrDeliveryNotFound, got %v", err)
 	}
 }
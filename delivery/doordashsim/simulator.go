@@ -0,0 +1,538 @@
+// Package doordashsim is an in-process stand-in for the DoorDash Drive API.
+// It serves the quote and delivery endpoints DoorDashService uses from an
+// httptest server, checks the JWT the way DoorDash does, and can inject
+// latency, error responses and malformed bodies, or post webhooks, so the
+// delivery flow can be exercised without network access or real credentials.
+package doordashsim
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"folo/delivery"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Config configures a simulator. Zero values get usable defaults.
+type Config struct {
+	// DeveloperID, KeyID and SigningSecret are the credentials requests must be
+	// signed with
+	DeveloperID   string
+	KeyID         string
+	SigningSecret string
+
+	// QuoteFee is the fee in cents returned for every quote, defaults to 975
+	QuoteFee int64
+
+	// QuoteTTL is how long a quote can be accepted, defaults to 5 minutes
+	QuoteTTL time.Duration
+
+	// Latency is added to every request
+	Latency time.Duration
+
+	// WebhookURL receives events sent with EmitEvent
+	WebhookURL string
+
+	// WebhookAuth is sent as the Authorization header of webhooks
+	WebhookAuth string
+}
+
+// Fault makes a request fail instead of being served normally
+type Fault struct {
+	// Status and Body are returned as the response when Status is set
+	Status int
+	Body   string
+
+	// Malformed returns 200 with a body that is not valid JSON
+	Malformed bool
+
+	// Latency delays the response on top of the configured latency
+	Latency time.Duration
+}
+
+type quote struct {
+	request   delivery.CreateQuoteRequest
+	fee       int64
+	expiresAt time.Time
+}
+
+// Simulator is a fake DoorDash Drive API backed by an httptest server
+type Simulator struct {
+	config Config
+	server *httptest.Server
+
+	mu         sync.Mutex
+	faults     []Fault
+	quotes     map[string]*quote
+	deliveries map[string]*delivery.DeliveryResponse
+	requests   []string
+}
+
+// New starts a simulator. Call Close when done with it.
+func New(config Config) *Simulator {
+	if config.DeveloperID == "" {
+		config.DeveloperID = "sim-developer"
+	}
+	if config.KeyID == "" {
+		config.KeyID = "sim-key"
+	}
+	if config.SigningSecret == "" {
+		config.SigningSecret = base64.RawURLEncoding.EncodeToString([]byte("doordash-simulator-secret"))
+	}
+	if config.QuoteFee == 0 {
+		config.QuoteFee = 975
+	}
+	if config.QuoteTTL == 0 {
+		config.QuoteTTL = 5 * time.Minute
+	}
+
+	s := &Simulator{
+		config:     config,
+		quotes:     make(map[string]*quote),
+		deliveries: make(map[string]*delivery.DeliveryResponse),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /drive/v2/quotes", s.createQuote)
+	mux.HandleFunc("POST /drive/v2/quotes/{id}/accept", s.acceptQuote)
+	mux.HandleFunc("POST /drive/v2/deliveries", s.createDelivery)
+	mux.HandleFunc("GET /drive/v2/deliveries/{id}", s.getDelivery)
+	mux.HandleFunc("PATCH /drive/v2/deliveries/{id}", s.updateDelivery)
+	mux.HandleFunc("PUT /drive/v2/deliveries/{id}/cancel", s.cancelDelivery)
+
+	s.server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// Close shuts the server down
+func (s *Simulator) Close() {
+	s.server.Close()
+}
+
+// URL is the base URL of the simulated API
+func (s *Simulator) URL() string {
+	return s.server.URL
+}
+
+// DoorDashConfig returns a config that points DoorDashService at the simulator
+// with matching credentials
+func (s *Simulator) DoorDashConfig() delivery.DoorDashConfig {
+	return delivery.DoorDashConfig{
+		DeveloperID:   s.config.DeveloperID,
+		KeyID:         s.config.KeyID,
+		SigningSecret: s.config.SigningSecret,
+		BaseURL:       s.server.URL,
+		HTTPClient:    s.server.Client(),
+	}
+}
+
+// InjectFault queues a fault for the next request that reaches the simulator.
+// Queued faults are used up one request at a time, in order.
+func (s *Simulator) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, f)
+}
+
+// Requests lists the requests received so far as "METHOD /path"
+func (s *Simulator) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Delivery returns the simulator's copy of a delivery
+func (s *Simulator) Delivery(externalDeliveryID string) (delivery.DeliveryResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[externalDeliveryID]
+	if !ok {
+		return delivery.DeliveryResponse{}, false
+	}
+	return *d, true
+}
+
+// eventStatuses is the delivery_status each emitted event moves a delivery to
+var eventStatuses = map[string]string{
+	"DELIVERY_CREATED":                 "created",
+	"DASHER_CONFIRMED":                 "confirmed",
+	"DASHER_CONFIRMED_PICKUP_ARRIVAL":  "arrived_at_pickup",
+	"DASHER_PICKED_UP":                 "picked_up",
+	"DASHER_CONFIRMED_DROPOFF_ARRIVAL": "arrived_at_dropoff",
+	"DASHER_DROPPED_OFF":               "delivered",
+	"DELIVERY_CANCELLED":               "cancelled",
+	"DELIVERY_RETURNED":                "returned",
+}
+
+// EmitEvent moves a delivery along as eventName describes and posts the
+// matching webhook to the configured WebhookURL
+func (s *Simulator) EmitEvent(ctx context.Context, externalDeliveryID, eventName string) error {
+	s.mu.Lock()
+	d, ok := s.deliveries[externalDeliveryID]
+	if !ok {
+		s.mu.Unlock()
+		return delivery.ErrDeliveryNotFound
+	}
+	if status, ok := eventStatuses[eventName]; ok {
+		d.DeliveryStatus = status
+	}
+	if eventName == "DASHER_CONFIRMED" && d.DasherID == 0 {
+		d.DasherID = rand.Int64N(900000) + 100000
+		d.DasherName = "Sim Dasher"
+		d.DasherDropoffPhoneNumber = "+14155550100"
+	}
+	event := delivery.WebhookEvent{
+		EventName:                eventName,
+		CreatedAt:                time.Now().UTC().Format(time.RFC3339),
+		ExternalDeliveryID:       d.ExternalDeliveryID,
+		SupportReference:         d.SupportReference,
+		TrackingURL:              d.TrackingURL,
+		DasherID:                 d.DasherID,
+		DasherName:               d.DasherName,
+		DasherDropoffPhoneNumber: d.DasherDropoffPhoneNumber,
+		CancellationReason:       d.CancellationReason,
+	}
+	s.mu.Unlock()
+
+	if s.config.WebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.WebhookAuth != "" {
+		req.Header.Set("Authorization", s.config.WebhookAuth)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// middleware records the request, applies latency and faults, and checks the JWT
+func (s *Simulator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		var fault *Fault
+		if len(s.faults) > 0 {
+			f := s.faults[0]
+			fault = &f
+			s.faults = s.faults[1:]
+		}
+		s.mu.Unlock()
+
+		latency := s.config.Latency
+		if fault != nil {
+			latency += fault.Latency
+		}
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		if fault != nil {
+			switch {
+			case fault.Malformed:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"external_delivery_id": `))
+				return
+			case fault.Status != 0:
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(fault.Status)
+				w.Write([]byte(fault.Body))
+				return
+			}
+		}
+
+		if err := s.authenticate(r); err != nil {
+			writeError(w, http.StatusUnauthorized, "authentication_error", err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate checks the bearer token the way DoorDash does: an HS256 JWT
+// with the dd-ver header, the doordash audience and our developer and key IDs
+func (s *Simulator) authenticate(r *http.Request) error {
+	tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return fmt.Errorf("missing bearer token")
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(s.config.SigningSecret)
+	if err != nil {
+		return fmt.Errorf("simulator signing secret is not valid base64: %w", err)
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		if t.Header["dd-ver"] != "DD-JWT-V1" {
+			return nil, fmt.Errorf("dd-ver header must be DD-JWT-V1")
+		}
+		return secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience("doordash"),
+		jwt.WithIssuer(s.config.DeveloperID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return fmt.Errorf("invalid token: %v", err)
+	}
+	if claims["kid"] != s.config.KeyID {
+		return fmt.Errorf("unknown key id")
+	}
+	return nil
+}
+
+func (s *Simulator) createQuote(w http.ResponseWriter, r *http.Request) {
+	var req delivery.CreateQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", "invalid JSON body")
+		return
+	}
+	if missing := firstMissing(
+		field{"external_delivery_id", req.ExternalDeliveryID},
+		field{"pickup_address", req.PickupAddress},
+		field{"pickup_phone_number", req.PickupPhoneNumber},
+		field{"dropoff_address", req.DropoffAddress},
+		field{"dropoff_phone_number", req.DropoffPhoneNumber},
+	); missing != "" {
+		writeError(w, http.StatusBadRequest, "validation_error", missing+" is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.deliveries[req.ExternalDeliveryID]; exists {
+		writeError(w, http.StatusConflict, "duplicate_delivery_id", "a delivery with this external_delivery_id already exists")
+		return
+	}
+	q := &quote{
+		request:   req,
+		fee:       s.config.QuoteFee,
+		expiresAt: time.Now().Add(s.config.QuoteTTL),
+	}
+	s.quotes[req.ExternalDeliveryID] = q
+
+	// The dasher arrives in 15 minutes, or at the pickup time if that's later
+	pickup := time.Now().UTC().Add(15 * time.Minute)
+	if requested, err := time.Parse(time.RFC3339, req.PickupTime); err == nil && requested.After(pickup) {
+		pickup = requested.UTC()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":                     uuid.New().String(),
+		"external_delivery_id":   req.ExternalDeliveryID,
+		"currency":               "USD",
+		"delivery_status":        "quote",
+		"fee":                    q.fee,
+		"order_value":            req.OrderValue,
+		"pickup_address":         req.PickupAddress,
+		"dropoff_address":        req.DropoffAddress,
+		"pickup_time_estimated":  pickup.Format(time.RFC3339),
+		"dropoff_time_estimated": pickup.Add(20 * time.Minute).Format(time.RFC3339),
+		"expires_at":             q.expiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Simulator) acceptQuote(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var req delivery.AcceptQuoteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "validation_error", "invalid JSON body")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.quotes[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "quote not found")
+		return
+	}
+	if time.Now().After(q.expiresAt) {
+		writeError(w, http.StatusBadRequest, "quote_expired", "quote has expired")
+		return
+	}
+	delete(s.quotes, id)
+
+	dropoffPhone := q.request.DropoffPhoneNumber
+	if req.DropoffPhoneNumber != "" {
+		dropoffPhone = req.DropoffPhoneNumber
+	}
+	d := s.newDelivery(delivery.CreateDeliveryRequest{
+		ExternalDeliveryID: id,
+		PickupAddress:      q.request.PickupAddress,
+		PickupPhoneNumber:  q.request.PickupPhoneNumber,
+		DropoffAddress:     q.request.DropoffAddress,
+		DropoffPhoneNumber: dropoffPhone,
+		OrderValue:         q.request.OrderValue,
+		Tip:                req.Tip,
+	}, q.fee)
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Simulator) createDelivery(w http.ResponseWriter, r *http.Request) {
+	var req delivery.CreateDeliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", "invalid JSON body")
+		return
+	}
+	if missing := firstMissing(
+		field{"external_delivery_id", req.ExternalDeliveryID},
+		field{"pickup_address", req.PickupAddress},
+		field{"pickup_phone_number", req.PickupPhoneNumber},
+		field{"dropoff_address", req.DropoffAddress},
+		field{"dropoff_phone_number", req.DropoffPhoneNumber},
+	); missing != "" {
+		writeError(w, http.StatusBadRequest, "validation_error", missing+" is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.deliveries[req.ExternalDeliveryID]; exists {
+		writeError(w, http.StatusConflict, "duplicate_delivery_id", "a delivery with this external_delivery_id already exists")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.newDelivery(req, s.config.QuoteFee))
+}
+
+func (s *Simulator) getDelivery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "delivery not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Simulator) updateDelivery(w http.ResponseWriter, r *http.Request) {
+	var req delivery.UpdateDeliveryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", "invalid JSON body")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "delivery not found")
+		return
+	}
+	if pickedUp(d.DeliveryStatus) {
+		writeError(w, http.StatusBadRequest, "delivery_in_progress", "delivery can no longer be updated")
+		return
+	}
+	if req.DropoffAddress != "" {
+		d.DropoffAddress = req.DropoffAddress
+	}
+	if req.Tip != nil {
+		d.Tip = *req.Tip
+	}
+	writeJSON(w, http.StatusOK, d)
+}
+
+func (s *Simulator) cancelDelivery(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not_found", "delivery not found")
+		return
+	}
+	if pickedUp(d.DeliveryStatus) {
+		writeError(w, http.StatusConflict, "cannot_be_cancelled", "delivery has already been picked up")
+		return
+	}
+	d.DeliveryStatus = "cancelled"
+	d.CancellationReason = "cancelled_by_creator"
+	writeJSON(w, http.StatusOK, d)
+}
+
+// newDelivery stores a delivery in the created state. Callers hold the lock.
+func (s *Simulator) newDelivery(req delivery.CreateDeliveryRequest, fee int64) *delivery.DeliveryResponse {
+	now := time.Now().UTC()
+	d := &delivery.DeliveryResponse{
+		ExternalDeliveryID:   req.ExternalDeliveryID,
+		SupportReference:     fmt.Sprintf("%d", rand.Int64N(9_000_000_000)+1_000_000_000),
+		DeliveryStatus:       "created",
+		Currency:             "USD",
+		Fee:                  fee,
+		Tip:                  req.Tip,
+		OrderValue:           req.OrderValue,
+		PickupAddress:        req.PickupAddress,
+		DropoffAddress:       req.DropoffAddress,
+		TrackingURL:          "https://track.doordash.com/share/" + req.ExternalDeliveryID + "/track",
+		PickupTimeEstimated:  now.Add(15 * time.Minute).Format(time.RFC3339),
+		DropoffTimeEstimated: now.Add(35 * time.Minute).Format(time.RFC3339),
+	}
+	s.deliveries[req.ExternalDeliveryID] = d
+	return d
+}
+
+// pickedUp reports whether a delivery is past the point it can be changed
+func pickedUp(status string) bool {
+	switch status {
+	case "picked_up", "arrived_at_dropoff", "delivered", "cancelled", "returned":
+		return true
+	}
+	return false
+}
+
+type field struct {
+	name  string
+	value string
+}
+
+// firstMissing returns the name of the first empty field
+func firstMissing(fields ...field) string {
+	for _, f := range fields {
+		if f.value == "" {
+			return f.name
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{"code": code, "message": message})
+}
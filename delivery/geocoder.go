@@ -0,0 +1,150 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrAddressNotFound is returned when an address can't be located
+	ErrAddressNotFound = errors.New("address not found")
+	// ErrAmbiguousAddress is returned when an address matches more than one place
+	ErrAmbiguousAddress = errors.New("address is ambiguous, add the city or ZIP code")
+)
+
+// Geocoder turns a customer-entered address into a normalized, located one
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (*Address, error)
+}
+
+// Address is a normalized street address
+type Address struct {
+	Street              string  `json:"street"`
+	Unit                string  `json:"unit,omitempty"`
+	City                string  `json:"city"`
+	State               string  `json:"state"`
+	ZIP                 string  `json:"zip"`
+	Lat                 float64 `json:"lat"`
+	Lng                 float64 `json:"lng"`
+	DropoffInstructions string  `json:"dropoffInstructions,omitempty"`
+}
+
+// String formats the address on one line, as delivery providers expect it
+func (a Address) String() string {
+	parts := []string{a.Street}
+	if a.Unit != "" {
+		parts = append(parts, a.Unit)
+	}
+	if a.City != "" {
+		parts = append(parts, a.City)
+	}
+	stateZIP := strings.TrimSpace(a.State + " " + a.ZIP)
+	if stateZIP != "" {
+		parts = append(parts, stateZIP)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Point returns where the address is
+func (a Address) Point() Point {
+	return Point{Lat: a.Lat, Lng: a.Lng}
+}
+
+// addressQuery is a free-text address split into its parts. Any part may be empty.
+type addressQuery struct {
+	Street string
+	Unit   string
+	City   string
+	State  string
+	ZIP    string
+}
+
+var (
+	unitPattern     = regexp.MustCompile(`(?i)^(?:(?:apt|apartment|unit|suite|ste|fl|floor)\.?\s*|#\s*)([\w-]+)$`)
+	unitSuffix      = regexp.MustCompile(`(?i)\s+(?:(?:apt|apartment|unit|suite|ste)\.?\s+|#\s*)([\w-]*\d[\w-]*|[a-z])$`)
+	stateZIPPattern = regexp.MustCompile(`^(?:([A-Za-z]{2})\s*)?(\d{5})?(?:-\d{4})?$`)
+)
+
+// parseAddress splits "345 Spear St Apt 5, San Francisco, CA 94105" into its parts
+func parseAddress(address string) addressQuery {
+	var q addressQuery
+	var parts []string
+	for _, p := range strings.Split(address, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		return q
+	}
+
+	q.Street = parts[0]
+	if m := unitSuffix.FindStringSubmatchIndex(q.Street); m != nil {
+		q.Unit = q.Street[m[0]:]
+		q.Street = q.Street[:m[0]]
+	}
+	for _, part := range parts[1:] {
+		if unitPattern.MatchString(part) {
+			q.Unit = part
+			continue
+		}
+		if m := stateZIPPattern.FindStringSubmatch(part); m != nil && (m[1] != "" || m[2] != "") {
+			q.State = strings.ToUpper(m[1])
+			q.ZIP = m[2]
+			continue
+		}
+		if q.City == "" {
+			q.City = part
+		}
+	}
+	q.Unit = formatUnit(q.Unit)
+	return q
+}
+
+// formatUnit writes units the same way however they were entered, e.g. "apt. 5" as "Apt 5"
+func formatUnit(unit string) string {
+	unit = strings.TrimSpace(unit)
+	m := unitPattern.FindStringSubmatch(unit)
+	if m == nil {
+		return unit
+	}
+	designator := strings.ToLower(strings.TrimRight(strings.TrimSpace(strings.TrimSuffix(unit, m[1])), "."))
+	switch designator {
+	case "suite", "ste":
+		return "Suite " + m[1]
+	case "fl", "floor":
+		return "Floor " + m[1]
+	case "unit":
+		return "Unit " + m[1]
+	}
+	return "Apt " + m[1]
+}
+
+// streetAbbreviations are the USPS abbreviations streets are compared with
+var streetAbbreviations = map[string]string{
+	"street": "st", "avenue": "ave", "av": "ave", "boulevard": "blvd", "road": "rd",
+	"drive": "dr", "lane": "ln", "court": "ct", "place": "pl", "terrace": "ter",
+	"highway": "hwy", "parkway": "pkwy", "center": "ctr", "square": "sq", "way": "way",
+	"north": "n", "south": "s", "east": "e", "west": "w",
+}
+
+// normalizeStreet reduces a street line to a comparable key, e.g.
+// "345 Spear Street." to "345 spear st"
+func normalizeStreet(street string) string {
+	street = strings.ToLower(street)
+	street = strings.Map(func(r rune) rune {
+		if r == '.' || r == ',' || r == '#' {
+			return ' '
+		}
+		return r
+	}, street)
+	words := strings.Fields(street)
+	for i, w := range words {
+		if abbr, ok := streetAbbreviations[w]; ok {
+			words[i] = abbr
+		}
+	}
+	return strings.Join(words, " ")
+}
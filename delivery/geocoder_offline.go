@@ -0,0 +1,94 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OfflineGeocoder looks addresses up in a fixed dataset, for tests and
+// offline development, or for a delivery area small enough to list
+type OfflineGeocoder struct {
+	// byStreet indexes the dataset by normalized street line
+	byStreet map[string][]Address
+}
+
+// NewOfflineGeocoder creates a geocoder that knows only the given addresses
+func NewOfflineGeocoder(addresses []Address) *OfflineGeocoder {
+	g := &OfflineGeocoder{byStreet: make(map[string][]Address)}
+	for _, a := range addresses {
+		key := normalizeStreet(a.Street)
+		g.byStreet[key] = append(g.byStreet[key], a)
+	}
+	return g
+}
+
+// LoadOfflineGeocoder reads the dataset from a JSON array of addresses
+func LoadOfflineGeocoder(path string) (*OfflineGeocoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []Address
+	if err := json.Unmarshal(data, &addresses); err != nil {
+		return nil, fmt.Errorf("invalid address dataset %s: %w", path, err)
+	}
+	return NewOfflineGeocoder(addresses), nil
+}
+
+// Geocode matches the street line against the dataset, narrowing by ZIP code,
+// city and state when given. Units are kept from the query.
+func (g *OfflineGeocoder) Geocode(ctx context.Context, address string) (*Address, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	q := parseAddress(address)
+	if q.Street == "" {
+		return nil, ErrAddressNotFound
+	}
+
+	candidates := g.byStreet[normalizeStreet(q.Street)]
+	if len(candidates) == 0 {
+		// Without commas the city and ZIP are still on the street line
+		candidates = g.prefixMatches(normalizeStreet(q.Street))
+	}
+
+	var matches []Address
+	for _, c := range candidates {
+		if q.ZIP != "" && c.ZIP != q.ZIP {
+			continue
+		}
+		if q.City != "" && !strings.EqualFold(c.City, q.City) {
+			continue
+		}
+		if q.State != "" && !strings.EqualFold(c.State, q.State) {
+			continue
+		}
+		matches = append(matches, c)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrAddressNotFound, address)
+	case 1:
+		match := matches[0]
+		if q.Unit != "" {
+			match.Unit = q.Unit
+		}
+		return &match, nil
+	}
+	return nil, ErrAmbiguousAddress
+}
+
+// prefixMatches finds addresses whose street starts the query
+func (g *OfflineGeocoder) prefixMatches(query string) []Address {
+	var matches []Address
+	for street, addresses := range g.byStreet {
+		if strings.HasPrefix(query, street+" ") {
+			matches = append(matches, addresses...)
+		}
+	}
+	return matches
+}
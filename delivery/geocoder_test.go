@@ -0,0 +1,48 @@
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"folo/delivery"
+)
+
+func TestOfflineGeocoder_NormalizesAddresses(t *testing.T) {
+	geocoder, err := delivery.LoadOfflineGeocoder("testdata/addresses.json")
+	if err != nil {
+		t.Fatalf("unexpected error loading dataset: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+		err   error
+	}{
+		{"345 Spear Street, San Francisco, CA 94105", "345 Spear St, San Francisco, CA 94105", nil},
+		{"345 spear st. apt. 5, san francisco", "345 Spear St, Apt 5, San Francisco, CA 94105", nil},
+		{"303 2nd St, #400, 94107", "303 2nd St, Apt 400, San Francisco, CA 94107", nil},
+		{"5 Embarcadero Center San Francisco CA", "5 Embarcadero Ctr, San Francisco, CA 94111", nil},
+		{"2000 Mission St, Santa Cruz", "2000 Mission St, Santa Cruz, CA 95060", nil},
+		{"2000 Mission St", "", delivery.ErrAmbiguousAddress},
+		{"345 Spear St, Oakland", "", delivery.ErrAddressNotFound},
+		{"10 Nowhere Ln, San Francisco, CA 94105", "", delivery.ErrAddressNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			address, err := geocoder.Geocode(context.Background(), tt.query)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if address.String() != tt.want || address.Lat == 0 {
+				t.Errorf("expected %q with a location, got %q at %v", tt.want, address.String(), address.Point())
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// DeliveryStatus is our provider-independent view of where a delivery is
+type DeliveryStatus string
+
+const (
+	Pending      DeliveryStatus = "PENDING"
+	Dispatched   DeliveryStatus = "DISPATCHED"
+	Interacted   DeliveryStatus = "INTERACTED"
+	Delivered    DeliveryStatus = "DELIVERED"
+	NotDelivered DeliveryStatus = "NOT_DELIVERED"
+)
+
+// deliveryStatusRank orders statuses so late or replayed webhooks can't move
+// a delivery backwards. DELIVERED and NOT_DELIVERED are both final.
+var deliveryStatusRank = map[DeliveryStatus]int{
+	"":           0,
+	Pending:      1,
+	Dispatched:   2,
+	Interacted:   3,
+	Delivered:    4,
+	NotDelivered: 4,
+}
+
+// CanAdvance reports whether a delivery may move from one status to another
+func (from DeliveryStatus) CanAdvance(to DeliveryStatus) bool {
+	return deliveryStatusRank[to] > deliveryStatusRank[from]
+}
+
+// doorDashEventStatuses maps Drive webhook event names to delivery statuses.
+// Names are matched case-insensitively, with or without the DASHER_ or
+// DELIVERY_ prefix DoorDash puts on them.
+var doorDashEventStatuses = map[string]DeliveryStatus{
+	"DELIVERY_CREATED":                 Pending,
+	"DASHER_CONFIRMED":                 Dispatched,
+	"DASHER_ENROUTE_TO_PICKUP":         Dispatched,
+	"DASHER_CONFIRMED_PICKUP_ARRIVAL":  Interacted,
+	"DASHER_PICKED_UP":                 Interacted,
+	"DASHER_ENROUTE_TO_DROPOFF":        Interacted,
+	"DASHER_CONFIRMED_DROPOFF_ARRIVAL": Interacted,
+	"DASHER_DROPPED_OFF":               Delivered,
+	"DELIVERY_CANCELLED":               NotDelivered,
+	"DELIVERY_RETURN_INITIALIZED":      NotDelivered,
+	"DASHER_CONFIRMED_RETURN_ARRIVAL":  NotDelivered,
+	"DELIVERY_RETURNED":                NotDelivered,
+
+	// Short forms
+	"PICKED_UP": Interacted,
+	"DELIVERED": Delivered,
+	"CANCELLED": NotDelivered,
+	"RETURNED":  NotDelivered,
+}
+
+// WebhookEvent is a delivery event posted by DoorDash Drive
+type WebhookEvent struct {
+	// EventName is the kind of event, e.g. "DASHER_CONFIRMED" or "DASHER_DROPPED_OFF"
+	EventName string `json:"event_name"`
+
+	// CreatedAt is the ISO 8601 timestamp of the event
+	CreatedAt string `json:"created_at"`
+
+	// ExternalDeliveryID is the delivery ID we sent when quoting or creating
+	ExternalDeliveryID string `json:"external_delivery_id"`
+
+	// SupportReference is DoorDash's own identifier for the delivery
+	SupportReference string `json:"support_reference"`
+
+	// TrackingURL is a page where the customer can follow the delivery
+	TrackingURL string `json:"tracking_url"`
+
+	// Dasher details, set once a dasher has accepted the delivery
+	DasherID                 int64  `json:"dasher_id,omitempty"`
+	DasherName               string `json:"dasher_name,omitempty"`
+	DasherDropoffPhoneNumber string `json:"dasher_dropoff_phone_number,omitempty"`
+
+	// CancellationReason is set on cancellation events
+	CancellationReason string `json:"cancellation_reason,omitempty"`
+}
+
+// Status maps the event to a delivery status. Events from our own drivers
+// are named after the status itself. The second return value is false for
+// events that don't change the status, e.g. ETA updates.
+func (e WebhookEvent) Status() (DeliveryStatus, bool) {
+	name := strings.ToUpper(strings.TrimSpace(e.EventName))
+	if status, ok := doorDashEventStatuses[name]; ok {
+		return status, true
+	}
+	if _, ok := deliveryStatusRank[DeliveryStatus(name)]; ok && name != "" {
+		return DeliveryStatus(name), true
+	}
+	for _, prefix := range []string{"DASHER_", "DELIVERY_"} {
+		if status, ok := doorDashEventStatuses[prefix+name]; ok {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// VerifyWebhookAuth reports whether the Authorization header of a webhook
+// matches the value configured for the webhook in the DoorDash portal. An
+// empty expected value rejects every request.
+func VerifyWebhookAuth(authorization, expected string) bool {
+	if expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization), []byte(expected)) == 1
+}
@@ -0,0 +1,180 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+)
+
+var (
+	// ErrOutsideDeliveryZone is returned for a dropoff outside every delivery zone
+	ErrOutsideDeliveryZone = errors.New("address is outside the delivery area")
+	// ErrBelowZoneMinimum is returned when the order is too small for the dropoff's zone
+	ErrBelowZoneMinimum = errors.New("order is below the delivery minimum")
+	// ErrDropoffLocationRequired is returned when zones are configured but the dropoff has no coordinates
+	ErrDropoffLocationRequired = errors.New("dropoff location is required")
+	// ErrStoreLocationRequired is returned when a zone measures distance from a store without coordinates
+	ErrStoreLocationRequired = errors.New("store location is required for delivery zones")
+)
+
+// Point is a position in degrees
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DistanceKm is the great-circle distance to another point
+func (p Point) DistanceKm(to Point) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(to.Lat - p.Lat)
+	dLng := toRad(to.Lng - p.Lng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(p.Lat))*math.Cos(toRad(to.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// FeeTier charges Fee for dropoffs up to UpToKm from the store making the order
+type FeeTier struct {
+	UpToKm float64 `json:"upToKm"`
+	Fee    int64   `json:"fee"`
+}
+
+// ZoneFee decides what the customer pays for delivery in a zone. A flat fee
+// or matching tier replaces the provider's fee; otherwise the provider's fee
+// is charged less the subsidy we cover, never below zero. A zone with tiers
+// only delivers as far as its last tier reaches.
+type ZoneFee struct {
+	Flat    *int64    `json:"flat,omitempty"`
+	Tiers   []FeeTier `json:"tiers,omitempty"`
+	Subsidy int64     `json:"subsidy,omitempty"`
+}
+
+// Zone is an area we deliver to, either a radius around the store or a polygon
+type Zone struct {
+	Name string `json:"name"`
+	// RadiusKm makes the zone a circle around the store making the order
+	RadiusKm float64 `json:"radiusKm,omitempty"`
+	// Polygon makes the zone the area inside these points
+	Polygon []Point `json:"polygon,omitempty"`
+	// MinOrderValue is the smallest basket total in cents delivered to the zone
+	MinOrderValue int     `json:"minOrderValue,omitempty"`
+	Fee           ZoneFee `json:"fee"`
+}
+
+// ZoneConfig is the delivery area as loaded from configuration. It applies
+// to every location, with radii and fee tiers measured from the location
+// making the order.
+type ZoneConfig struct {
+	// Zones are checked in order and the first containing the dropoff applies,
+	// so list inner zones before the ones around them
+	Zones []Zone `json:"zones"`
+}
+
+// Zones checks dropoffs against the configured delivery area
+type Zones struct {
+	config ZoneConfig
+}
+
+// ZoneMatch is the zone a dropoff falls in
+type ZoneMatch struct {
+	Zone       Zone
+	DistanceKm float64
+}
+
+// NewZones validates the configuration and returns the delivery area
+func NewZones(config ZoneConfig) (*Zones, error) {
+	for _, z := range config.Zones {
+		switch {
+		case z.RadiusKm > 0 && len(z.Polygon) > 0:
+			return nil, fmt.Errorf("zone %q has both a radius and a polygon", z.Name)
+		case z.RadiusKm > 0, len(z.Polygon) >= 3:
+		default:
+			return nil, fmt.Errorf("zone %q needs a radius or a polygon of at least 3 points", z.Name)
+		}
+	}
+	return &Zones{config: config}, nil
+}
+
+// LoadZones reads a ZoneConfig from a JSON file
+func LoadZones(path string) (*Zones, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config ZoneConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid zone file %s: %w", path, err)
+	}
+	return NewZones(config)
+}
+
+// Match finds the zone for a dropoff from a store and checks the order meets
+// its minimum. The store may be nil while no zone needs the distance from it.
+func (z *Zones) Match(store *Point, dropoff Point, orderValue int) (*ZoneMatch, error) {
+	for _, zone := range z.config.Zones {
+		var distance float64
+		if store != nil {
+			distance = store.DistanceKm(dropoff)
+		} else if zone.RadiusKm > 0 || len(zone.Fee.Tiers) > 0 {
+			return nil, fmt.Errorf("%w: zone %s is measured from the store", ErrStoreLocationRequired, zone.Name)
+		}
+		inside := false
+		if zone.RadiusKm > 0 {
+			inside = distance <= zone.RadiusKm
+		} else {
+			inside = containsPoint(zone.Polygon, dropoff)
+		}
+		if _, priced := zone.Fee.tierFee(distance); !inside || !priced {
+			continue
+		}
+		if orderValue < zone.MinOrderValue {
+			return nil, fmt.Errorf("%w: orders to %s must be at least %d cents", ErrBelowZoneMinimum, zone.Name, zone.MinOrderValue)
+		}
+		return &ZoneMatch{Zone: zone, DistanceKm: distance}, nil
+	}
+	return nil, ErrOutsideDeliveryZone
+}
+
+// Fee is what the customer pays for delivery given the provider's fee
+func (m *ZoneMatch) Fee(providerFee int64) int64 {
+	fee := m.Zone.Fee
+	if fee.Flat != nil {
+		return *fee.Flat
+	}
+	if len(fee.Tiers) > 0 {
+		// Match only returns dropoffs within a tier
+		tierFee, _ := fee.tierFee(m.DistanceKm)
+		return tierFee
+	}
+	return max(providerFee-fee.Subsidy, 0)
+}
+
+// tierFee is the fee of the first tier reaching distanceKm. It is false when
+// the fee has tiers and the distance is past every one of them.
+func (f ZoneFee) tierFee(distanceKm float64) (int64, bool) {
+	if f.Flat != nil || len(f.Tiers) == 0 {
+		return 0, true
+	}
+	for _, tier := range f.Tiers {
+		if distanceKm <= tier.UpToKm {
+			return tier.Fee, true
+		}
+	}
+	return 0, false
+}
+
+// containsPoint reports whether p is inside the polygon, by ray casting
+func containsPoint(polygon []Point, p Point) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
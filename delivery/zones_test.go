@@ -0,0 +1,79 @@
+package delivery_test
+
+import (
+	"errors"
+	"testing"
+
+	"folo/delivery"
+)
+
+func TestZones_MatchAndFee(t *testing.T) {
+	flat := int64(299)
+	store := delivery.Point{Lat: 37.7897, Lng: -122.3972}
+	zones, err := delivery.NewZones(delivery.ZoneConfig{
+		Zones: []delivery.Zone{
+			{Name: "core", RadiusKm: 2, Fee: delivery.ZoneFee{Flat: &flat}},
+			{Name: "city", RadiusKm: 8, MinOrderValue: 2500, Fee: delivery.ZoneFee{Subsidy: 300}},
+			{Name: "east bay", Polygon: []delivery.Point{
+				{Lat: 37.76, Lng: -122.30}, {Lat: 37.86, Lng: -122.30},
+				{Lat: 37.86, Lng: -122.20}, {Lat: 37.76, Lng: -122.20},
+			}, Fee: delivery.ZoneFee{Tiers: []delivery.FeeTier{{UpToKm: 12, Fee: 599}, {UpToKm: 15, Fee: 899}}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building zones: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		dropoff delivery.Point
+		value   int
+		zone    string
+		fee     int64
+		err     error
+	}{
+		{"flat fee near the store", delivery.Point{Lat: 37.7890, Lng: -122.3990}, 500, "core", 299, nil},
+		{"subsidized across town", delivery.Point{Lat: 37.7599, Lng: -122.4148}, 3000, "city", 600, nil},
+		{"below the zone minimum", delivery.Point{Lat: 37.7599, Lng: -122.4148}, 2000, "", 0, delivery.ErrBelowZoneMinimum},
+		{"tiered fee in the polygon", delivery.Point{Lat: 37.80, Lng: -122.27}, 500, "east bay", 599, nil},
+		{"past the last fee tier", delivery.Point{Lat: 37.80, Lng: -122.21}, 5000, "", 0, delivery.ErrOutsideDeliveryZone},
+		{"outside every zone", delivery.Point{Lat: 37.44, Lng: -122.16}, 5000, "", 0, delivery.ErrOutsideDeliveryZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, err := zones.Match(&store, tt.dropoff, tt.value)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if match.Zone.Name != tt.zone || match.Fee(900) != tt.fee {
+				t.Errorf("expected %s at %d, got %s at %d", tt.zone, tt.fee, match.Zone.Name, match.Fee(900))
+			}
+		})
+	}
+}
+
+func TestZones_MatchNeedsStoreForDistances(t *testing.T) {
+	zones, err := delivery.NewZones(delivery.ZoneConfig{Zones: []delivery.Zone{
+		{Name: "downtown", Polygon: []delivery.Point{
+			{Lat: 37.78, Lng: -122.41}, {Lat: 37.80, Lng: -122.41},
+			{Lat: 37.80, Lng: -122.39}, {Lat: 37.78, Lng: -122.39},
+		}},
+		{Name: "city", RadiusKm: 8},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error building zones: %v", err)
+	}
+
+	if match, err := zones.Match(nil, delivery.Point{Lat: 37.79, Lng: -122.40}, 500); err != nil || match.Zone.Name != "downtown" {
+		t.Errorf("expected a polygon to match without the store, got %+v, %v", match, err)
+	}
+	if _, err := zones.Match(nil, delivery.Point{Lat: 37.7599, Lng: -122.4148}, 500); !errors.Is(err, delivery.ErrStoreLocationRequired) {
+		t.Errorf("expected ErrStoreLocationRequired for a radius zone, got %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package fleet
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"folo/delivery"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterAdminRoutes registers the endpoints for managing drivers under
+// /admin/fleet, behind requireAdmin
+func RegisterAdminRoutes(router fiber.Router, handler *Handler, requireAdmin fiber.Handler) {
+	fleet := router.Group("/admin/fleet", requireAdmin)
+
+	fleet.Post("/drivers", handler.CreateDriver)
+	fleet.Get("/drivers", handler.ListDrivers)
+	fleet.Post("/drivers/:id/token", handler.ReissueToken)
+	fleet.Get("/deliveries/:externalId", handler.GetDelivery)
+	fleet.Post("/deliveries/:externalId/assign", handler.AssignDelivery)
+}
+
+// RegisterDriverRoutes registers the endpoints drivers use under /drivers/:id.
+// Each takes the driver's token as a bearer token and only serves the
+// driver it was issued to.
+func RegisterDriverRoutes(router fiber.Router, handler *Handler) {
+	drivers := router.Group("/drivers/:id", handler.AuthenticateDriver)
+
+	drivers.Post("/clock-in", handler.ClockIn)
+	drivers.Post("/clock-out", handler.ClockOut)
+	drivers.Put("/location", handler.UpdateLocation)
+	drivers.Get("/deliveries", handler.ListDriverDeliveries)
+	drivers.Put("/deliveries/:externalId/status", handler.UpdateDeliveryStatus)
+}
+
+// CreateDriver adds a driver
+func (h *Handler) CreateDriver(c fiber.Ctx) error {
+	var req DriverReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	driver, err := h.service.CreateDriver(req)
+	if err != nil {
+		log.Printf("error creating driver: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to create driver",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    driver,
+	})
+}
+
+// ReissueToken gives a driver a new token, for one that was lost
+func (h *Handler) ReissueToken(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	driver, err := h.service.ReissueToken(uint(id))
+	if err != nil {
+		return deliveryError(c, err, "failed to issue token")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    driver,
+	})
+}
+
+// AuthenticateDriver checks the bearer token belongs to the driver in the path
+func (h *Handler) AuthenticateDriver(c fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	driver, err := h.service.Authenticate(strings.TrimSpace(token))
+	if !ok || errors.Is(err, ErrInvalidDriverToken) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   ErrInvalidDriverToken.Error(),
+		})
+	}
+	if err != nil {
+		return deliveryError(c, err, "failed to authenticate driver")
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+	if driver.ID != uint(id) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"error":   "token was not issued to this driver",
+		})
+	}
+	return c.Next()
+}
+
+// ListDrivers returns every driver, on shift first
+func (h *Handler) ListDrivers(c fiber.Ctx) error {
+	drivers, err := h.service.Drivers()
+	if err != nil {
+		log.Printf("error retrieving drivers: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve drivers",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    drivers,
+	})
+}
+
+// GetDelivery returns an in-house delivery with its driver
+func (h *Handler) GetDelivery(c fiber.Ctx) error {
+	d, err := h.service.findDelivery(c.Params("externalId"))
+	if err != nil {
+		return deliveryError(c, err, "failed to retrieve delivery")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    d,
+	})
+}
+
+// AssignDelivery gives a delivery to a driver by hand
+func (h *Handler) AssignDelivery(c fiber.Ctx) error {
+	var req AssignReq
+	if err := c.Bind().Body(&req); err != nil || req.DriverID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "driverId is required",
+		})
+	}
+
+	d, err := h.service.Assign(c.Params("externalId"), req.DriverID)
+	if err != nil {
+		return deliveryError(c, err, "failed to assign delivery")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    d,
+	})
+}
+
+// ClockIn puts the driver on shift
+func (h *Handler) ClockIn(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	driver, err := h.service.ClockIn(uint(id))
+	if err != nil {
+		return deliveryError(c, err, "failed to clock in")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    driver,
+	})
+}
+
+// ClockOut takes the driver off shift
+func (h *Handler) ClockOut(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	driver, err := h.service.ClockOut(uint(id))
+	if err != nil {
+		return deliveryError(c, err, "failed to clock out")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    driver,
+	})
+}
+
+// UpdateLocation records the driver's position
+func (h *Handler) UpdateLocation(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	var req LocationReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	driver, err := h.service.UpdateLocation(uint(id), req)
+	if err != nil {
+		return deliveryError(c, err, "failed to update location")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    driver,
+	})
+}
+
+// ListDriverDeliveries returns the driver's unfinished deliveries
+func (h *Handler) ListDriverDeliveries(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	deliveries, err := h.service.DriverDeliveries(uint(id))
+	if err != nil {
+		return deliveryError(c, err, "failed to retrieve deliveries")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    deliveries,
+	})
+}
+
+// UpdateDeliveryStatus records the driver's progress on a delivery
+func (h *Handler) UpdateDeliveryStatus(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidDriverID(c)
+	}
+
+	var req StatusReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	d, err := h.service.UpdateStatus(c.Params("externalId"), uint(id), req)
+	if err != nil {
+		return deliveryError(c, err, "failed to update delivery")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    d,
+	})
+}
+
+func invalidDriverID(c fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"error":   "invalid driver ID",
+	})
+}
+
+// deliveryError maps service errors to responses, logging unexpected ones
+func deliveryError(c fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, delivery.ErrDeliveryNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, ErrNotAssignedDriver):
+		status = fiber.StatusForbidden
+	case errors.Is(err, ErrDriverBusy), errors.Is(err, ErrDriverOffShift),
+		errors.Is(err, ErrAlreadyPickedUp), errors.Is(err, ErrInvalidStatus):
+		status = fiber.StatusConflict
+	case errors.Is(err, ErrEventNotHandled):
+		status = fiber.StatusServiceUnavailable
+	default:
+		log.Printf("%s: %s", message, err.Error())
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   message,
+		})
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
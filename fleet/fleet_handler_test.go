@@ -0,0 +1,95 @@
+package fleet
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"folo/auth"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func clockIn(t *testing.T, app *fiber.App, driverID uint, token string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, fmt.Sprintf("/drivers/%d/clock-in", driverID), nil)
+	if token != "" {
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDriverRoutes_OnlyServeTheTokensDriver(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)), Config{})
+	sam, err := service.CreateDriver(DriverReq{Name: "Sam"})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	alex, err := service.CreateDriver(DriverReq{Name: "Alex"})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if sam.Token == "" || sam.TokenHash == sam.Token {
+		t.Fatalf("expected a token issued and only its hash stored, got %+v", sam)
+	}
+
+	app := fiber.New()
+	RegisterDriverRoutes(app, NewHandler(service))
+
+	if status := clockIn(t, app, sam.ID, ""); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", status)
+	}
+	if status := clockIn(t, app, sam.ID, "not-a-token"); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", status)
+	}
+	if status := clockIn(t, app, alex.ID, sam.Token); status != fiber.StatusForbidden {
+		t.Errorf("expected 403 for another driver's path, got %d", status)
+	}
+	if status := clockIn(t, app, sam.ID, sam.Token); status != fiber.StatusOK {
+		t.Errorf("expected 200 for the driver's own token, got %d", status)
+	}
+
+	reissued, err := service.ReissueToken(sam.ID)
+	if err != nil {
+		t.Fatalf("unexpected error reissuing token: %v", err)
+	}
+	if status := clockIn(t, app, sam.ID, sam.Token); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 for a replaced token, got %d", status)
+	}
+	if status := clockIn(t, app, sam.ID, reissued.Token); status != fiber.StatusOK {
+		t.Errorf("expected 200 for the new token, got %d", status)
+	}
+}
+
+func TestAdminRoutes_RequireAdmin(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)), Config{})
+	driver, err := service.CreateDriver(DriverReq{Name: "Sam"})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	app := fiber.New()
+	RegisterAdminRoutes(app, NewHandler(service), auth.RequireAdmin("secret"))
+
+	reissue := func(authorization string) int {
+		req := httptest.NewRequest(fiber.MethodPost, fmt.Sprintf("/admin/fleet/drivers/%d/token", driver.ID), nil)
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := reissue("Bearer " + driver.Token); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 reissuing a token without the admin token, got %d", status)
+	}
+	if status := reissue("Bearer secret"); status != fiber.StatusOK {
+		t.Errorf("expected 200 with the admin token, got %d", status)
+	}
+}
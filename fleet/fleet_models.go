@@ -0,0 +1,196 @@
+package fleet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"folo/delivery"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNoDriversOnShift is returned when quoting while nobody is clocked in
+	ErrNoDriversOnShift = errors.New("no drivers on shift")
+	// ErrDriverBusy is returned when clocking out a driver with an unfinished delivery
+	ErrDriverBusy = errors.New("driver has an unfinished delivery")
+	// ErrDriverOffShift is returned when assigning a delivery to a driver who is clocked out
+	ErrDriverOffShift = errors.New("driver is not on shift")
+	// ErrNotAssignedDriver is returned when a driver updates a delivery that isn't theirs
+	ErrNotAssignedDriver = errors.New("delivery is not assigned to this driver")
+	// ErrQuoteExpired is returned when accepting a quote after it expired
+	ErrQuoteExpired = errors.New("delivery quote expired")
+	// ErrAlreadyPickedUp is returned when changing or canceling a delivery that left the store
+	ErrAlreadyPickedUp = errors.New("delivery already picked up")
+	// ErrInvalidStatus is returned for a status update a driver can't make
+	ErrInvalidStatus = errors.New("invalid delivery status update")
+	// ErrEventNotHandled is returned when a status update was stored but the
+	// order couldn't be brought in line with it. Sending the same update
+	// again retries the order.
+	ErrEventNotHandled = errors.New("delivery status recorded but the order was not updated")
+	// ErrInvalidDriverToken is returned when a driver's token is missing or unknown
+	ErrInvalidDriverToken = errors.New("invalid driver token")
+)
+
+// Driver is one of our own delivery drivers
+type Driver struct {
+	gorm.Model
+	Name        string `gorm:"not null"`
+	PhoneNumber string
+	OnShift     bool `gorm:"index"`
+	ClockedInAt *time.Time
+	// Lat and Lng are the driver's last reported position, if any
+	Lat       *float64
+	Lng       *float64
+	LocatedAt *time.Time
+	// TokenHash is the SHA-256 of the token the driver signs in with. The
+	// token itself is only handed out in Token, when it is issued.
+	TokenHash string `gorm:"index" json:"-"`
+	Token     string `gorm:"-" json:"Token,omitempty"`
+}
+
+func (Driver) TableName() string {
+	return "drivers"
+}
+
+// HasLocation reports whether the driver has reported a position
+func (d *Driver) HasLocation() bool {
+	return d.Lat != nil && d.Lng != nil
+}
+
+// Delivery is a delivery run by one of our drivers
+type Delivery struct {
+	gorm.Model
+	ExternalDeliveryID string `gorm:"uniqueIndex;not null"`
+	// DriverID is nil until a driver is assigned
+	DriverID *uint `gorm:"index"`
+	Driver   *Driver
+	// Status uses the same statuses as every other provider
+	Status             delivery.DeliveryStatus `gorm:"index"`
+	PickupAddress      string
+	PickupPhoneNumber  string
+	PickupInstructions string
+	// PickupLat and PickupLng locate the pickup, if known
+	PickupLat           *float64
+	PickupLng           *float64
+	DropoffAddress      string
+	DropoffPhoneNumber  string
+	DropoffInstructions string
+	OrderValue          int
+	Fee                 int64
+	Tip                 int
+	AssignedAt          *time.Time
+	PickedUpAt          *time.Time
+	DroppedOffAt        *time.Time
+	CancellationReason  string
+}
+
+func (Delivery) TableName() string {
+	return "fleet_deliveries"
+}
+
+// Active reports whether the delivery still needs a driver's attention
+func (d *Delivery) Active() bool {
+	return d.Status == delivery.Pending || d.Status == delivery.Dispatched || d.Status == delivery.Interacted
+}
+
+// Response returns the delivery in the shape every provider returns
+func (d *Delivery) Response() *delivery.DeliveryResponse {
+	res := &delivery.DeliveryResponse{
+		ExternalDeliveryID: d.ExternalDeliveryID,
+		SupportReference:   d.SupportReference(),
+		DeliveryStatus:     string(d.Status),
+		Currency:           "USD",
+		Fee:                d.Fee,
+		Tip:                d.Tip,
+		OrderValue:         d.OrderValue,
+		PickupAddress:      d.PickupAddress,
+		DropoffAddress:     d.DropoffAddress,
+		CancellationReason: d.CancellationReason,
+	}
+	if d.Driver != nil {
+		res.DasherID = int64(d.Driver.ID)
+		res.DasherName = d.Driver.Name
+		res.DasherDropoffPhoneNumber = d.Driver.PhoneNumber
+	}
+	return res
+}
+
+// SupportReference is the ID staff use to look the delivery up
+func (d *Delivery) SupportReference() string {
+	return fmt.Sprintf("FLEET-%d", d.ID)
+}
+
+// Event describes the delivery's current status as a provider event
+func (d *Delivery) Event() delivery.WebhookEvent {
+	event := delivery.WebhookEvent{
+		EventName:          string(d.Status),
+		CreatedAt:          time.Now().UTC().Format(time.RFC3339),
+		ExternalDeliveryID: d.ExternalDeliveryID,
+		SupportReference:   d.SupportReference(),
+		CancellationReason: d.CancellationReason,
+	}
+	if d.Driver != nil {
+		event.DasherID = int64(d.Driver.ID)
+		event.DasherName = d.Driver.Name
+		event.DasherDropoffPhoneNumber = d.Driver.PhoneNumber
+	}
+	return event
+}
+
+// StatusReq is a driver's update on a delivery
+type StatusReq struct {
+	// Status is INTERACTED once picked up, then DELIVERED or NOT_DELIVERED
+	Status delivery.DeliveryStatus `json:"status"`
+	// Reason explains a NOT_DELIVERED update
+	Reason string `json:"reason"`
+}
+
+// Validate checks the update is one a driver can make
+func (r StatusReq) Validate() error {
+	switch r.Status {
+	case delivery.Interacted, delivery.Delivered:
+		return nil
+	case delivery.NotDelivered:
+		if strings.TrimSpace(r.Reason) == "" {
+			return errors.New("reason is required when a delivery fails")
+		}
+		return nil
+	}
+	return ErrInvalidStatus
+}
+
+// DriverReq creates a driver
+type DriverReq struct {
+	Name        string `json:"name"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+// Validate checks the driver has a name
+func (r DriverReq) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// LocationReq is a driver's position
+type LocationReq struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// Validate checks the coordinates are on the globe
+func (r LocationReq) Validate() error {
+	if r.Lat < -90 || r.Lat > 90 || r.Lng < -180 || r.Lng > 180 {
+		return errors.New("coordinates out of range")
+	}
+	return nil
+}
+
+// AssignReq assigns a delivery to a driver by hand
+type AssignReq struct {
+	DriverID uint `json:"driverId"`
+}
@@ -0,0 +1,136 @@
+package fleet
+
+import (
+	"folo/delivery"
+
+	"gorm.io/gorm"
+)
+
+// activeStatuses are the statuses of deliveries a driver is still working on
+var activeStatuses = []delivery.DeliveryStatus{delivery.Dispatched, delivery.Interacted}
+
+// Repository handles database operations for drivers and their deliveries
+type Repository interface {
+	CreateDriver(driver *Driver) error
+	FindDriverByID(id uint) (*Driver, error)
+	FindDriverByTokenHash(hash string) (*Driver, error)
+	FindDrivers() ([]Driver, error)
+	UpdateDriver(driver *Driver) error
+	CountOnShift() (int64, error)
+	FindAvailableDrivers() ([]Driver, error)
+	HasActiveDelivery(driverID uint) (bool, error)
+	CreateDelivery(d *Delivery) error
+	FindDelivery(externalDeliveryID string) (*Delivery, error)
+	FindDeliveriesByDriver(driverID uint) ([]Delivery, error)
+	FindOldestUnassigned() (*Delivery, error)
+	UpdateDelivery(d *Delivery) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new fleet repository
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+// CreateDriver creates a new driver
+func (r *repository) CreateDriver(driver *Driver) error {
+	return r.db.Create(driver).Error
+}
+
+// FindDriverByID finds a driver by ID
+func (r *repository) FindDriverByID(id uint) (*Driver, error) {
+	var driver Driver
+	err := r.db.First(&driver, id).Error
+	return &driver, err
+}
+
+// FindDriverByTokenHash finds the driver a token was issued to
+func (r *repository) FindDriverByTokenHash(hash string) (*Driver, error) {
+	var driver Driver
+	err := r.db.Where("token_hash = ?", hash).First(&driver).Error
+	return &driver, err
+}
+
+// FindDrivers returns every driver, on shift first
+func (r *repository) FindDrivers() ([]Driver, error) {
+	var drivers []Driver
+	err := r.db.Order("on_shift DESC, name").Find(&drivers).Error
+	return drivers, err
+}
+
+// UpdateDriver updates a driver
+func (r *repository) UpdateDriver(driver *Driver) error {
+	return r.db.Save(driver).Error
+}
+
+// CountOnShift counts the drivers clocked in
+func (r *repository) CountOnShift() (int64, error) {
+	var count int64
+	err := r.db.Model(&Driver{}).Where("on_shift = ?", true).Count(&count).Error
+	return count, err
+}
+
+// FindAvailableDrivers returns drivers on shift without an unfinished delivery,
+// longest clocked in first
+func (r *repository) FindAvailableDrivers() ([]Driver, error) {
+	busy := r.db.Model(&Delivery{}).
+		Select("driver_id").
+		Where("driver_id IS NOT NULL AND status IN ?", activeStatuses)
+
+	var drivers []Driver
+	err := r.db.
+		Where("on_shift = ?", true).
+		Where("id NOT IN (?)", busy).
+		Order("clocked_in_at, id").
+		Find(&drivers).Error
+	return drivers, err
+}
+
+// HasActiveDelivery reports whether the driver has an unfinished delivery
+func (r *repository) HasActiveDelivery(driverID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&Delivery{}).
+		Where("driver_id = ? AND status IN ?", driverID, activeStatuses).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CreateDelivery creates a new delivery
+func (r *repository) CreateDelivery(d *Delivery) error {
+	return r.db.Create(d).Error
+}
+
+// FindDelivery finds a delivery with its driver by our external delivery ID
+func (r *repository) FindDelivery(externalDeliveryID string) (*Delivery, error) {
+	var d Delivery
+	err := r.db.Preload("Driver").Where("external_delivery_id = ?", externalDeliveryID).First(&d).Error
+	return &d, err
+}
+
+// FindDeliveriesByDriver returns a driver's unfinished deliveries, oldest first
+func (r *repository) FindDeliveriesByDriver(driverID uint) ([]Delivery, error) {
+	var deliveries []Delivery
+	err := r.db.
+		Where("driver_id = ? AND status IN ?", driverID, activeStatuses).
+		Order("id").
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+// FindOldestUnassigned returns the longest waiting delivery without a driver
+func (r *repository) FindOldestUnassigned() (*Delivery, error) {
+	var d Delivery
+	err := r.db.
+		Where("driver_id IS NULL AND status = ?", delivery.Pending).
+		Order("id").
+		First(&d).Error
+	return &d, err
+}
+
+// UpdateDelivery updates a delivery
+func (r *repository) UpdateDelivery(d *Delivery) error {
+	return r.db.Omit("Driver").Save(d).Error
+}
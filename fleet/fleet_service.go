@@ -0,0 +1,616 @@
+package fleet
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"folo/delivery"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Config holds the in-house delivery settings
+type Config struct {
+	// Fee is the flat delivery fee in cents, defaults to 500
+	Fee int64
+	// QuoteTTL is how long a quote can be accepted for, defaults to 5 minutes
+	QuoteTTL time.Duration
+	// DeliveryTime is the usual time from quote to dropoff, defaults to 45 minutes
+	DeliveryTime time.Duration
+	// PickupLat and PickupLng locate the store, used to find the nearest driver
+	// for deliveries quoted without a pickup location. Without either drivers
+	// are assigned longest clocked in first.
+	PickupLat *float64
+	PickupLng *float64
+}
+
+// quote is an unaccepted delivery. Quotes are kept in memory only: they are
+// requested before the order is placed, and they expire in minutes.
+type quote struct {
+	params    delivery.DeliveryQuoteParams
+	fee       int64
+	expiresAt time.Time
+}
+
+// Service is a delivery provider backed by our own drivers. It implements
+// delivery.DeliveryService, and reports the status changes drivers make as
+// provider events to the handler set with OnEvent.
+type Service struct {
+	repo   Repository
+	config Config
+
+	// mu guards quotes and serializes assignment so two deliveries can't
+	// claim the same driver
+	mu      sync.Mutex
+	quotes  map[string]quote
+	onEvent func(delivery.WebhookEvent) error
+}
+
+// NewService creates a new in-house delivery service
+func NewService(repo Repository, config Config) *Service {
+	if config.Fee == 0 {
+		config.Fee = 500
+	}
+	if config.QuoteTTL == 0 {
+		config.QuoteTTL = 5 * time.Minute
+	}
+	if config.DeliveryTime == 0 {
+		config.DeliveryTime = 45 * time.Minute
+	}
+	return &Service{
+		repo:   repo,
+		config: config,
+		quotes: make(map[string]quote),
+	}
+}
+
+// OnEvent sets the handler for delivery status changes, usually the order
+// service's HandleDeliveryEvent
+func (s *Service) OnEvent(fn func(delivery.WebhookEvent) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEvent = fn
+}
+
+// RequestQuote quotes the flat fee while at least one driver is on shift
+func (s *Service) RequestQuote(ctx context.Context, params delivery.DeliveryQuoteParams) (*delivery.CreateQuoteResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	onShift, err := s.repo.CountOnShift()
+	if err != nil {
+		return nil, err
+	}
+	if onShift == 0 {
+		return nil, ErrNoDriversOnShift
+	}
+
+	if params.ExternalDeliveryID == "" {
+		params.ExternalDeliveryID = uuid.New().String()
+	}
+	now := time.Now()
+	q := quote{params: params, fee: s.config.Fee, expiresAt: now.Add(s.config.QuoteTTL)}
+
+	s.mu.Lock()
+	s.purgeExpiredQuotes(now)
+	s.quotes[params.ExternalDeliveryID] = q
+	s.mu.Unlock()
+
+	return &delivery.CreateQuoteResponse{
+		ExternalDeliveryID:   params.ExternalDeliveryID,
+		Currency:             "USD",
+		Fee:                  q.fee,
+		ID:                   "fleet_quote_" + params.ExternalDeliveryID,
+		ExpiresAt:            q.expiresAt.UTC().Format(time.RFC3339),
+		DropoffTimeEstimated: now.Add(s.config.DeliveryTime).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// AcceptQuote creates the delivery and assigns it to the nearest available
+// driver. With nobody free it waits for the next driver to finish.
+func (s *Service) AcceptQuote(ctx context.Context, externalDeliveryID string, req delivery.AcceptQuoteRequest) (*delivery.DeliveryResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	q, ok := s.quotes[externalDeliveryID]
+	if ok {
+		delete(s.quotes, externalDeliveryID)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil, delivery.ErrDeliveryNotFound
+	}
+	if time.Now().After(q.expiresAt) {
+		return nil, ErrQuoteExpired
+	}
+
+	d := &Delivery{
+		ExternalDeliveryID:  externalDeliveryID,
+		PickupAddress:       q.params.PickupAddress,
+		PickupPhoneNumber:   q.params.PickupPhoneNumber,
+		PickupInstructions:  q.params.PickupInstructions,
+		PickupLat:           q.params.PickupLat,
+		PickupLng:           q.params.PickupLng,
+		DropoffAddress:      q.params.DropoffAddress,
+		DropoffPhoneNumber:  q.params.DropoffPhoneNumber,
+		DropoffInstructions: q.params.DropoffInstructions,
+		OrderValue:          q.params.OrderValue,
+		Fee:                 q.fee,
+		Tip:                 req.Tip,
+	}
+	if req.DropoffPhoneNumber != "" {
+		d.DropoffPhoneNumber = req.DropoffPhoneNumber
+	}
+	return s.create(d)
+}
+
+// CreateDelivery creates a delivery without a prior quote
+func (s *Service) CreateDelivery(ctx context.Context, req delivery.CreateDeliveryRequest) (*delivery.DeliveryResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.ExternalDeliveryID == "" {
+		req.ExternalDeliveryID = uuid.New().String()
+	}
+	return s.create(&Delivery{
+		ExternalDeliveryID:  req.ExternalDeliveryID,
+		PickupAddress:       req.PickupAddress,
+		PickupPhoneNumber:   req.PickupPhoneNumber,
+		PickupInstructions:  req.PickupInstructions,
+		DropoffAddress:      req.DropoffAddress,
+		DropoffPhoneNumber:  req.DropoffPhoneNumber,
+		DropoffInstructions: req.DropoffInstructions,
+		OrderValue:          req.OrderValue,
+		Fee:                 s.config.Fee,
+		Tip:                 req.Tip,
+	})
+}
+
+// create stores a new delivery and assigns it if a driver is free. No event
+// is sent: the caller learns the status from the response.
+func (s *Service) create(d *Delivery) (*delivery.DeliveryResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.Status = delivery.Pending
+	if err := s.repo.CreateDelivery(d); err != nil {
+		return nil, err
+	}
+	drivers, err := s.repo.FindAvailableDrivers()
+	if err != nil {
+		return nil, err
+	}
+	if len(drivers) > 0 {
+		if err := s.assign(d, s.nearest(d, drivers)); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("created in-house delivery %s (%s)", d.ExternalDeliveryID, d.Status)
+	return d.Response(), nil
+}
+
+// GetDelivery returns a delivery with its driver
+func (s *Service) GetDelivery(ctx context.Context, externalDeliveryID string) (*delivery.DeliveryResponse, error) {
+	d, err := s.findDelivery(externalDeliveryID)
+	if err != nil {
+		return nil, err
+	}
+	return d.Response(), nil
+}
+
+// UpdateDelivery changes the dropoff details or tip before pickup
+func (s *Service) UpdateDelivery(ctx context.Context, externalDeliveryID string, req delivery.UpdateDeliveryRequest) (*delivery.DeliveryResponse, error) {
+	d, err := s.findDelivery(externalDeliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if !d.Status.CanAdvance(delivery.Interacted) {
+		return nil, ErrAlreadyPickedUp
+	}
+	if req.DropoffAddress != "" {
+		d.DropoffAddress = req.DropoffAddress
+	}
+	if req.DropoffPhoneNumber != "" {
+		d.DropoffPhoneNumber = req.DropoffPhoneNumber
+	}
+	if req.DropoffInstructions != "" {
+		d.DropoffInstructions = req.DropoffInstructions
+	}
+	if req.PickupInstructions != "" {
+		d.PickupInstructions = req.PickupInstructions
+	}
+	if req.Tip != nil {
+		d.Tip = *req.Tip
+	}
+	if err := s.repo.UpdateDelivery(d); err != nil {
+		return nil, err
+	}
+	return d.Response(), nil
+}
+
+// CancelDelivery cancels a delivery that hasn't been picked up. Its driver,
+// if any, moves on to the next waiting delivery.
+func (s *Service) CancelDelivery(ctx context.Context, externalDeliveryID string) error {
+	d, err := s.findDelivery(externalDeliveryID)
+	if err != nil {
+		return err
+	}
+	if d.Status == delivery.NotDelivered {
+		return nil
+	}
+	if !d.Status.CanAdvance(delivery.Interacted) {
+		return ErrAlreadyPickedUp
+	}
+	d.Status = delivery.NotDelivered
+	d.CancellationReason = "canceled by store"
+	if err := s.repo.UpdateDelivery(d); err != nil {
+		return err
+	}
+	log.Printf("canceled in-house delivery %s", externalDeliveryID)
+	if d.DriverID != nil {
+		s.dispatchNext(*d.DriverID)
+	}
+	return nil
+}
+
+// CreateDriver adds a driver, clocked out, with a token to sign in with
+func (s *Service) CreateDriver(req DriverReq) (*Driver, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	driver := &Driver{Name: req.Name, PhoneNumber: req.PhoneNumber}
+	if err := issueToken(driver); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateDriver(driver); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+// ReissueToken gives a driver a new token, signing out the old one
+func (s *Service) ReissueToken(driverID uint) (*Driver, error) {
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := issueToken(driver); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateDriver(driver); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+// Authenticate returns the driver a token was issued to
+func (s *Service) Authenticate(token string) (*Driver, error) {
+	if token == "" {
+		return nil, ErrInvalidDriverToken
+	}
+	driver, err := s.repo.FindDriverByTokenHash(hashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidDriverToken
+	}
+	return driver, err
+}
+
+// issueToken sets a new random token on the driver, keeping only its hash
+func issueToken(driver *Driver) error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("failed to generate driver token: %w", err)
+	}
+	driver.Token = hex.EncodeToString(b)
+	driver.TokenHash = hashToken(driver.Token)
+	return nil
+}
+
+// hashToken hashes a token for storage. Tokens are random, so a fast hash
+// is enough and lets a driver be looked up by theirs.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Drivers returns every driver, on shift first
+func (s *Service) Drivers() ([]Driver, error) {
+	return s.repo.FindDrivers()
+}
+
+// ClockIn puts a driver on shift and hands them the longest waiting delivery
+func (s *Service) ClockIn(driverID uint) (*Driver, error) {
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		return nil, err
+	}
+	if driver.OnShift {
+		return driver, nil
+	}
+	now := time.Now()
+	driver.OnShift = true
+	driver.ClockedInAt = &now
+	if err := s.repo.UpdateDriver(driver); err != nil {
+		return nil, err
+	}
+	log.Printf("driver %d clocked in", driver.ID)
+	s.dispatchNext(driver.ID)
+	return driver, nil
+}
+
+// ClockOut takes a driver off shift once their deliveries are finished
+func (s *Service) ClockOut(driverID uint) (*Driver, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		return nil, err
+	}
+	busy, err := s.repo.HasActiveDelivery(driver.ID)
+	if err != nil {
+		return nil, err
+	}
+	if busy {
+		return driver, ErrDriverBusy
+	}
+	driver.OnShift = false
+	driver.ClockedInAt = nil
+	if err := s.repo.UpdateDriver(driver); err != nil {
+		return nil, err
+	}
+	log.Printf("driver %d clocked out", driver.ID)
+	return driver, nil
+}
+
+// UpdateLocation records a driver's position for nearest-driver assignment
+func (s *Service) UpdateLocation(driverID uint, req LocationReq) (*Driver, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	driver.Lat = &req.Lat
+	driver.Lng = &req.Lng
+	driver.LocatedAt = &now
+	if err := s.repo.UpdateDriver(driver); err != nil {
+		return nil, err
+	}
+	return driver, nil
+}
+
+// DriverDeliveries returns a driver's unfinished deliveries
+func (s *Service) DriverDeliveries(driverID uint) ([]Delivery, error) {
+	if _, err := s.repo.FindDriverByID(driverID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindDeliveriesByDriver(driverID)
+}
+
+// Assign gives a delivery to a driver by hand, taking it from any driver who
+// had it but hasn't picked it up yet
+func (s *Service) Assign(externalDeliveryID string, driverID uint) (*Delivery, error) {
+	s.mu.Lock()
+	d, err := s.findDelivery(externalDeliveryID)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if !d.Status.CanAdvance(delivery.Interacted) {
+		s.mu.Unlock()
+		return d, ErrAlreadyPickedUp
+	}
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	if !driver.OnShift {
+		s.mu.Unlock()
+		return d, ErrDriverOffShift
+	}
+	previous := d.DriverID
+	err = s.assign(d, driver)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	emitErr := s.emit(d)
+	if previous != nil && *previous != driver.ID {
+		s.dispatchNext(*previous)
+	}
+	return d, emitErr
+}
+
+// UpdateStatus records a driver's progress on their delivery. Once it is
+// finished the driver gets the next waiting delivery. An ErrEventNotHandled
+// means the order wasn't updated; the driver sends the same status again to
+// retry it.
+func (s *Service) UpdateStatus(externalDeliveryID string, driverID uint, req StatusReq) (*Delivery, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	d, err := s.recordStatus(externalDeliveryID, driverID, req)
+	if err != nil {
+		return d, err
+	}
+	log.Printf("in-house delivery %s is now %s", d.ExternalDeliveryID, d.Status)
+
+	emitErr := s.emit(d)
+	if !d.Active() {
+		s.dispatchNext(driverID)
+	}
+	return d, emitErr
+}
+
+// recordStatus checks the driver may make the update and stores it. The
+// delivery's current status is accepted again, unchanged, so a driver can
+// retry an update whose event wasn't handled.
+func (s *Service) recordStatus(externalDeliveryID string, driverID uint, req StatusReq) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, err := s.findDelivery(externalDeliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if d.DriverID == nil || *d.DriverID != driverID {
+		return d, ErrNotAssignedDriver
+	}
+	if d.Status == req.Status {
+		return d, nil
+	}
+	if !d.Status.CanAdvance(req.Status) {
+		return d, fmt.Errorf("%w: %s to %s", ErrInvalidStatus, d.Status, req.Status)
+	}
+
+	now := time.Now()
+	d.Status = req.Status
+	switch req.Status {
+	case delivery.Interacted:
+		d.PickedUpAt = &now
+	case delivery.Delivered:
+		d.DroppedOffAt = &now
+	case delivery.NotDelivered:
+		d.CancellationReason = req.Reason
+	}
+	if err := s.repo.UpdateDelivery(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// assign sets the delivery's driver. Callers hold s.mu.
+func (s *Service) assign(d *Delivery, driver *Driver) error {
+	now := time.Now()
+	d.DriverID = &driver.ID
+	d.Driver = driver
+	d.AssignedAt = &now
+	d.Status = delivery.Dispatched
+	if err := s.repo.UpdateDelivery(d); err != nil {
+		return err
+	}
+	log.Printf("assigned in-house delivery %s to driver %d", d.ExternalDeliveryID, driver.ID)
+	return nil
+}
+
+// nearest picks the driver closest to the delivery's pickup. Drivers without
+// a position, or every driver when the pickup has none, keep the longest
+// clocked in order.
+func (s *Service) nearest(d *Delivery, drivers []Driver) *Driver {
+	lat, lng := d.PickupLat, d.PickupLng
+	if lat == nil || lng == nil {
+		lat, lng = s.config.PickupLat, s.config.PickupLng
+	}
+	if lat == nil || lng == nil {
+		return &drivers[0]
+	}
+	pickup := delivery.Point{Lat: *lat, Lng: *lng}
+	distance := func(d *Driver) float64 {
+		if !d.HasLocation() {
+			return -1
+		}
+		return pickup.DistanceKm(delivery.Point{Lat: *d.Lat, Lng: *d.Lng})
+	}
+	sort.SliceStable(drivers, func(i, j int) bool {
+		di, dj := distance(&drivers[i]), distance(&drivers[j])
+		if di < 0 || dj < 0 {
+			return dj < 0 && di >= 0
+		}
+		return di < dj
+	})
+	return &drivers[0]
+}
+
+// dispatchNext gives a free driver the longest waiting unassigned delivery
+func (s *Service) dispatchNext(driverID uint) {
+	s.mu.Lock()
+	d, err := s.nextFor(driverID)
+	s.mu.Unlock()
+	if err != nil {
+		log.Printf("failed to hand driver %d their next delivery: %v", driverID, err)
+		return
+	}
+	if d != nil {
+		if err := s.emit(d); err != nil {
+			log.Printf("failed to report in-house delivery %s: %v", d.ExternalDeliveryID, err)
+		}
+	}
+}
+
+// nextFor assigns the next waiting delivery to the driver if they are free.
+// It returns nil when there is nothing to do. Callers hold s.mu.
+func (s *Service) nextFor(driverID uint) (*Delivery, error) {
+	driver, err := s.repo.FindDriverByID(driverID)
+	if err != nil {
+		return nil, err
+	}
+	if !driver.OnShift {
+		return nil, nil
+	}
+	busy, err := s.repo.HasActiveDelivery(driverID)
+	if err != nil || busy {
+		return nil, err
+	}
+	d, err := s.repo.FindOldestUnassigned()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.assign(d, driver); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// emit reports the delivery's status to the event handler. The delivery's
+// update already stands, so a failing handler is returned as
+// ErrEventNotHandled for the caller to retry.
+func (s *Service) emit(d *Delivery) error {
+	s.mu.Lock()
+	onEvent := s.onEvent
+	s.mu.Unlock()
+	if onEvent == nil {
+		return nil
+	}
+	if err := onEvent(d.Event()); err != nil {
+		log.Printf("failed to handle event for in-house delivery %s: %v", d.ExternalDeliveryID, err)
+		return fmt.Errorf("%w: %v", ErrEventNotHandled, err)
+	}
+	return nil
+}
+
+// findDelivery finds a delivery, reporting a missing one as delivery.ErrDeliveryNotFound
+func (s *Service) findDelivery(externalDeliveryID string) (*Delivery, error) {
+	d, err := s.repo.FindDelivery(externalDeliveryID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, delivery.ErrDeliveryNotFound
+	}
+	return d, err
+}
+
+// purgeExpiredQuotes drops quotes nobody accepted. Callers hold s.mu.
+func (s *Service) purgeExpiredQuotes(now time.Time) {
+	for id, q := range s.quotes {
+		if now.After(q.expiresAt) {
+			delete(s.quotes, id)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package fleet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"folo/database/databasetest"
+	"folo/delivery"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory SQLite database with the fleet tables migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Open(t, &Driver{}, &Delivery{})
+}
+
+// clockedInDriver creates a driver at the given position and clocks them in
+func clockedInDriver(t *testing.T, service *Service, name string, lat, lng float64) *Driver {
+	t.Helper()
+	driver, err := service.CreateDriver(DriverReq{Name: name, PhoneNumber: "+14155550111"})
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+	if _, err := service.UpdateLocation(driver.ID, LocationReq{Lat: lat, Lng: lng}); err != nil {
+		t.Fatalf("unexpected error updating location: %v", err)
+	}
+	if _, err := service.ClockIn(driver.ID); err != nil {
+		t.Fatalf("unexpected error clocking in: %v", err)
+	}
+	return driver
+}
+
+// quoteAndAccept dispatches a delivery the way the order service does
+func quoteAndAccept(t *testing.T, service *Service, externalID string) *delivery.DeliveryResponse {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := service.RequestQuote(ctx, delivery.DeliveryQuoteParams{
+		ExternalDeliveryID: externalID,
+		DropoffAddress:     "345 Spear St",
+		DropoffPhoneNumber: "+18773934448",
+		OrderValue:         2000,
+	}); err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+	res, err := service.AcceptQuote(ctx, externalID, delivery.AcceptQuoteRequest{Tip: 200})
+	if err != nil {
+		t.Fatalf("unexpected error accepting quote: %v", err)
+	}
+	return res
+}
+
+func TestService_QuotesOnlyWithDriversOnShiftAndAssignsNearest(t *testing.T) {
+	storeLat, storeLng := 37.7897, -122.3972
+	service := NewService(NewRepository(newTestDB(t)), Config{Fee: 400, PickupLat: &storeLat, PickupLng: &storeLng})
+
+	if _, err := service.RequestQuote(context.Background(), delivery.DeliveryQuoteParams{}); !errors.Is(err, ErrNoDriversOnShift) {
+		t.Fatalf("expected ErrNoDriversOnShift, got %v", err)
+	}
+
+	clockedInDriver(t, service, "Far", 37.7599, -122.4148)
+	near := clockedInDriver(t, service, "Near", 37.7890, -122.3990)
+
+	res := quoteAndAccept(t, service, "ext-1")
+	if res.DeliveryStatus != string(delivery.Dispatched) || res.DasherID != int64(near.ID) || res.Fee != 400 {
+		t.Errorf("expected the nearest driver to be dispatched at the flat fee, got %+v", res)
+	}
+
+	if _, err := service.AcceptQuote(context.Background(), "ext-1", delivery.AcceptQuoteRequest{}); !errors.Is(err, delivery.ErrDeliveryNotFound) {
+		t.Errorf("expected an accepted quote to be used up, got %v", err)
+	}
+}
+
+func TestService_AssignsNearestToTheQuotedPickup(t *testing.T) {
+	// The configured store is in SoMa, but this delivery leaves from the Mission
+	storeLat, storeLng := 37.7897, -122.3972
+	service := NewService(NewRepository(newTestDB(t)), Config{PickupLat: &storeLat, PickupLng: &storeLng})
+	clockedInDriver(t, service, "SoMa", 37.7890, -122.3990)
+	mission := clockedInDriver(t, service, "Mission", 37.7640, -122.4190)
+
+	ctx := context.Background()
+	pickupLat, pickupLng := 37.7637, -122.4194
+	if _, err := service.RequestQuote(ctx, delivery.DeliveryQuoteParams{
+		ExternalDeliveryID: "ext-1",
+		PickupAddress:      "2128 Mission St, San Francisco, CA 94110",
+		PickupLat:          &pickupLat,
+		PickupLng:          &pickupLng,
+		DropoffAddress:     "345 Spear St",
+	}); err != nil {
+		t.Fatalf("unexpected error quoting: %v", err)
+	}
+	res, err := service.AcceptQuote(ctx, "ext-1", delivery.AcceptQuoteRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error accepting quote: %v", err)
+	}
+	if res.DasherID != int64(mission.ID) {
+		t.Errorf("expected the driver nearest the pickup, got driver %d", res.DasherID)
+	}
+}
+
+func TestService_DriverUpdatesProduceDeliveryEvents(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)), Config{})
+	var events []delivery.DeliveryStatus
+	service.OnEvent(func(e delivery.WebhookEvent) error {
+		status, ok := e.Status()
+		if !ok {
+			t.Errorf("event %q does not map to a delivery status", e.EventName)
+		}
+		events = append(events, status)
+		return nil
+	})
+
+	driver := clockedInDriver(t, service, "Sam", 37.78, -122.40)
+	quoteAndAccept(t, service, "ext-1")
+	// Nobody is free for the second delivery, so it waits
+	if res := quoteAndAccept(t, service, "ext-2"); res.DeliveryStatus != string(delivery.Pending) {
+		t.Fatalf("expected the second delivery to wait, got %s", res.DeliveryStatus)
+	}
+
+	if _, err := service.ClockOut(driver.ID); !errors.Is(err, ErrDriverBusy) {
+		t.Errorf("expected ErrDriverBusy, got %v", err)
+	}
+	if _, err := service.UpdateStatus("ext-2", driver.ID, StatusReq{Status: delivery.Interacted}); !errors.Is(err, ErrNotAssignedDriver) {
+		t.Errorf("expected ErrNotAssignedDriver, got %v", err)
+	}
+	if err := service.CancelDelivery(context.Background(), "ext-1"); err != nil {
+		t.Fatalf("unexpected error canceling before pickup: %v", err)
+	}
+
+	// Canceling freed the driver, who now has the waiting delivery
+	if _, err := service.UpdateStatus("ext-2", driver.ID, StatusReq{Status: delivery.Interacted}); err != nil {
+		t.Fatalf("unexpected error picking up: %v", err)
+	}
+	if err := service.CancelDelivery(context.Background(), "ext-2"); !errors.Is(err, ErrAlreadyPickedUp) {
+		t.Errorf("expected ErrAlreadyPickedUp, got %v", err)
+	}
+	if _, err := service.UpdateStatus("ext-2", driver.ID, StatusReq{Status: delivery.Delivered}); err != nil {
+		t.Fatalf("unexpected error dropping off: %v", err)
+	}
+	if _, err := service.UpdateStatus("ext-2", driver.ID, StatusReq{Status: delivery.Interacted}); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected a finished delivery to stay finished, got %v", err)
+	}
+
+	want := []delivery.DeliveryStatus{delivery.Dispatched, delivery.Interacted, delivery.Delivered}
+	if len(events) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("expected events %v, got %v", want, events)
+			break
+		}
+	}
+	if _, err := service.ClockOut(driver.ID); err != nil {
+		t.Errorf("unexpected error clocking out: %v", err)
+	}
+}
+
+func TestService_RetriesAnUnhandledDeliveryEvent(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)), Config{})
+	failing := true
+	var delivered int
+	service.OnEvent(func(e delivery.WebhookEvent) error {
+		if status, _ := e.Status(); status != delivery.Delivered {
+			return nil
+		}
+		if failing {
+			return errors.New("capture failed")
+		}
+		delivered++
+		return nil
+	})
+
+	driver := clockedInDriver(t, service, "Sam", 37.78, -122.40)
+	quoteAndAccept(t, service, "ext-1")
+	if _, err := service.UpdateStatus("ext-1", driver.ID, StatusReq{Status: delivery.Interacted}); err != nil {
+		t.Fatalf("unexpected error picking up: %v", err)
+	}
+	if _, err := service.UpdateStatus("ext-1", driver.ID, StatusReq{Status: delivery.Delivered}); !errors.Is(err, ErrEventNotHandled) {
+		t.Fatalf("expected ErrEventNotHandled, got %v", err)
+	}
+
+	// Sending the same status again retries the event
+	failing = false
+	d, err := service.UpdateStatus("ext-1", driver.ID, StatusReq{Status: delivery.Delivered})
+	if err != nil {
+		t.Fatalf("unexpected error retrying: %v", err)
+	}
+	if d.Status != delivery.Delivered || delivered != 1 {
+		t.Errorf("expected the delivered event handled once on retry, got %s and %d", d.Status, delivered)
+	}
+}
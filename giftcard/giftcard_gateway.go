@@ -0,0 +1,167 @@
+package giftcard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"folo/payment"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Gateway redeems gift cards as a payment.PaymentGateway. The card code is
+// read from PaymentData.CardNumber and the PIN from PaymentData.Cvv.
+//
+// Authorizing debits the card straight away, so a hold can't be spent twice.
+// Capture settles the difference against the final amount and Void or Refund
+// credit the card back. What an authorization holds is the sum of its ledger
+// entries.
+type Gateway struct {
+	repo Repository
+}
+
+// NewGateway creates a gift card payment gateway
+func NewGateway(repo Repository) *Gateway {
+	return &Gateway{repo: repo}
+}
+
+// WithDB returns a gateway that records redemptions through db, so they commit
+// or roll back with the caller's transaction
+func (g *Gateway) WithDB(db *gorm.DB) payment.PaymentGateway {
+	return NewGateway(NewRepository(db))
+}
+
+// Authorize debits the request amount from the card. With AllowPartial, a
+// card that can't cover the amount is drained instead and the result carries
+// the amount actually taken.
+func (g *Gateway) Authorize(ctx context.Context, req payment.PaymentRequest) payment.PaymentResult {
+	if err := ctx.Err(); err != nil {
+		return payment.PaymentResult{Status: payment.TimedOut, Error: err}
+	}
+	if req.Card == nil || req.Card.CardNumber == "" {
+		return payment.PaymentResult{Status: payment.Declined, DeclineCode: "missing_card"}
+	}
+	if req.Amount <= 0 {
+		return payment.PaymentResult{Status: payment.Errored, Error: fmt.Errorf("invalid amount %d", req.Amount)}
+	}
+
+	card, err := g.repo.FindByCode(req.Card.CardNumber)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return payment.PaymentResult{Status: payment.Declined, DeclineCode: "invalid_card"}
+		}
+		return payment.PaymentResult{Status: payment.Errored, Error: err}
+	}
+	if !card.CheckPIN(req.Card.Cvv) {
+		return payment.PaymentResult{Status: payment.Declined, DeclineCode: "incorrect_pin"}
+	}
+	if card.IsExpired(time.Now()) {
+		return payment.PaymentResult{Status: payment.Declined, DeclineCode: "expired_card"}
+	}
+	if req.Currency != "" && req.Currency != card.Currency {
+		return payment.PaymentResult{Status: payment.Declined, DeclineCode: "currency_mismatch"}
+	}
+
+	amount := req.Amount
+	if card.Balance < amount {
+		if !req.AllowPartial || card.Balance == 0 {
+			return payment.PaymentResult{Status: payment.Declined, DeclineCode: "insufficient_funds"}
+		}
+		amount = card.Balance
+	}
+
+	authorizationID := "gc_" + uuid.New().String()
+	if _, err := g.repo.Debit(card.ID, amount, authorizationID, req.Reference); err != nil {
+		// Another redemption spent the balance since it was read
+		if errors.Is(err, ErrInsufficientBalance) {
+			return payment.PaymentResult{Status: payment.Declined, DeclineCode: "insufficient_funds"}
+		}
+		return payment.PaymentResult{Status: payment.Errored, Error: err}
+	}
+
+	return payment.PaymentResult{AuthorizationID: authorizationID, Status: payment.Approved, Amount: amount}
+}
+
+// Capture settles an authorization at amount, debiting or crediting the
+// card for any difference from what was taken at authorization
+func (g *Gateway) Capture(ctx context.Context, authorizationID string, amount int) payment.PaymentResult {
+	if amount <= 0 {
+		return payment.PaymentResult{AuthorizationID: authorizationID, Status: payment.Declined, DeclineCode: "invalid_amount"}
+	}
+	result := g.settle(ctx, authorizationID, func(held int) (int, bool) {
+		return held - amount, true
+	})
+	if result.Approved() {
+		result.Amount = amount
+	}
+	return result
+}
+
+// Void credits everything still held by an authorization back to the card
+func (g *Gateway) Void(ctx context.Context, authorizationID string) payment.PaymentResult {
+	return g.settle(ctx, authorizationID, func(held int) (int, bool) {
+		return held, true
+	})
+}
+
+// Refund credits up to the amount held by an authorization back to the card
+func (g *Gateway) Refund(ctx context.Context, authorizationID string, amount int) payment.PaymentResult {
+	if amount <= 0 {
+		return payment.PaymentResult{AuthorizationID: authorizationID, Status: payment.Declined, DeclineCode: "invalid_amount"}
+	}
+	return g.settle(ctx, authorizationID, func(held int) (int, bool) {
+		return amount, amount <= held
+	})
+}
+
+// settle works out what an authorization currently holds and credits the card
+// with the amount returned by fn, or debits it when that amount is negative
+func (g *Gateway) settle(ctx context.Context, authorizationID string, fn func(held int) (credit int, ok bool)) payment.PaymentResult {
+	result := payment.PaymentResult{AuthorizationID: authorizationID}
+	if err := ctx.Err(); err != nil {
+		result.Status, result.Error = payment.TimedOut, err
+		return result
+	}
+
+	entries, err := g.repo.FindEntriesByAuthorization(authorizationID)
+	if err != nil {
+		result.Status, result.Error = payment.Errored, err
+		return result
+	}
+	if len(entries) == 0 {
+		result.Status, result.Error = payment.Errored, payment.ErrUnknownAuthorization
+		return result
+	}
+	held := 0
+	for _, entry := range entries {
+		held -= entry.Amount
+	}
+
+	credit, ok := fn(held)
+	if !ok {
+		result.Status, result.DeclineCode = payment.Declined, "amount_too_large"
+		return result
+	}
+
+	cardID, reference := entries[0].CardID, entries[0].Reference
+	switch {
+	case credit > 0:
+		_, err = g.repo.Credit(cardID, credit, EntryRefund, authorizationID, reference)
+	case credit < 0:
+		_, err = g.repo.Debit(cardID, -credit, authorizationID, reference)
+	}
+	if errors.Is(err, ErrInsufficientBalance) {
+		result.Status, result.DeclineCode = payment.Declined, "insufficient_funds"
+		return result
+	}
+	if err != nil {
+		result.Status, result.Error = payment.Errored, err
+		return result
+	}
+
+	result.Status, result.Amount = payment.Approved, max(credit, -credit)
+	return result
+}
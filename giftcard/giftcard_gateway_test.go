@@ -0,0 +1,161 @@
+package giftcard
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"folo/database/databasetest"
+	"folo/payment"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory SQLite database with the gift card tables migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Open(t, &Card{}, &LedgerEntry{})
+}
+
+// issueCard issues a card with the PIN 1234 and the given balance
+func issueCard(t *testing.T, repo Repository, balance int) *Card {
+	t.Helper()
+	card, err := IssueReq{Pin: "1234", Amount: balance}.NewCard()
+	if err != nil {
+		t.Fatalf("failed to build card: %v", err)
+	}
+	if err := repo.Issue(card, balance, "test"); err != nil {
+		t.Fatalf("failed to issue card: %v", err)
+	}
+	return card
+}
+
+func balanceOf(t *testing.T, repo Repository, code string) int {
+	t.Helper()
+	card, err := repo.FindByCode(code)
+	if err != nil {
+		t.Fatalf("failed to find card: %v", err)
+	}
+	return card.Balance
+}
+
+func TestGateway_RedeemCaptureRefund(t *testing.T) {
+	repo := NewRepository(newTestDB(t))
+	gateway := NewGateway(repo)
+	card := issueCard(t, repo, 2000)
+	ctx := context.Background()
+
+	result := gateway.Authorize(ctx, payment.PaymentRequest{
+		Amount: 1200,
+		Card:   &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+	})
+	if !result.Approved() || result.Amount != 1200 {
+		t.Fatalf("expected approval for 1200, got %+v", result)
+	}
+	if got := balanceOf(t, repo, card.Code); got != 800 {
+		t.Errorf("expected balance 800 after authorization, got %d", got)
+	}
+
+	// Capturing less than was held puts the difference back
+	if result := gateway.Capture(ctx, result.AuthorizationID, 1000); !result.Approved() {
+		t.Fatalf("unexpected capture failure: %+v", result)
+	}
+	if got := balanceOf(t, repo, card.Code); got != 1000 {
+		t.Errorf("expected balance 1000 after capture, got %d", got)
+	}
+
+	if result := gateway.Refund(ctx, result.AuthorizationID, 1500); result.Approved() {
+		t.Errorf("expected refund above the captured amount to be declined")
+	}
+	if result := gateway.Refund(ctx, result.AuthorizationID, 1000); !result.Approved() {
+		t.Fatalf("unexpected refund failure: %+v", result)
+	}
+	if got := balanceOf(t, repo, card.Code); got != 2000 {
+		t.Errorf("expected balance 2000 after refund, got %d", got)
+	}
+
+	stored, err := repo.FindByCodeWithLedger(card.Code)
+	if err != nil {
+		t.Fatalf("unexpected error loading ledger: %v", err)
+	}
+	wantTypes := []EntryType{EntryIssue, EntryRedemption, EntryRefund, EntryRefund}
+	if len(stored.Ledger) != len(wantTypes) {
+		t.Fatalf("expected %d ledger entries, got %+v", len(wantTypes), stored.Ledger)
+	}
+	for i, entry := range stored.Ledger {
+		if entry.Type != wantTypes[i] {
+			t.Errorf("entry %d: expected %s, got %s", i, wantTypes[i], entry.Type)
+		}
+	}
+}
+
+func TestGateway_Declines(t *testing.T) {
+	repo := NewRepository(newTestDB(t))
+	gateway := NewGateway(repo)
+	card := issueCard(t, repo, 500)
+
+	tests := []struct {
+		name string
+		data payment.PaymentData
+		want string
+	}{
+		{"unknown card", payment.PaymentData{CardNumber: "NOPE", Cvv: "1234"}, "invalid_card"},
+		{"wrong pin", payment.PaymentData{CardNumber: card.Code, Cvv: "0000"}, "incorrect_pin"},
+		{"insufficient", payment.PaymentData{CardNumber: card.Code, Cvv: "1234"}, "insufficient_funds"},
+	}
+	for _, tt := range tests {
+		result := gateway.Authorize(context.Background(), payment.PaymentRequest{Amount: 1000, Card: &tt.data})
+		if result.Approved() || result.DeclineCode != tt.want {
+			t.Errorf("%s: expected decline %q, got %+v", tt.name, tt.want, result)
+		}
+	}
+	if got := balanceOf(t, repo, card.Code); got != 500 {
+		t.Errorf("expected declines to leave the balance alone, got %d", got)
+	}
+}
+
+func TestGateway_PartialAuthorizationDrainsCard(t *testing.T) {
+	repo := NewRepository(newTestDB(t))
+	gateway := NewGateway(repo)
+	card := issueCard(t, repo, 700)
+
+	result := gateway.Authorize(context.Background(), payment.PaymentRequest{
+		Amount:       1000,
+		Card:         &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+		AllowPartial: true,
+	})
+	if !result.Approved() || result.Amount != 700 {
+		t.Fatalf("expected partial approval for 700, got %+v", result)
+	}
+	if got := balanceOf(t, repo, card.Code); got != 0 {
+		t.Errorf("expected card to be drained, got %d", got)
+	}
+}
+
+func TestRepository_DebitNeverOverdraws(t *testing.T) {
+	repo := NewRepository(newTestDB(t))
+	card := issueCard(t, repo, 1000)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	approved := 0
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Debit(card.ID, 300, "", "test"); err == nil {
+				mu.Lock()
+				approved++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if approved != 3 {
+		t.Errorf("expected 3 debits to succeed, got %d", approved)
+	}
+	if got := balanceOf(t, repo, card.Code); got != 100 {
+		t.Errorf("expected balance 100, got %d", got)
+	}
+}
@@ -0,0 +1,95 @@
+package giftcard
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	repo Repository
+}
+
+func NewHandler(repo Repository) *Handler {
+	return &Handler{
+		repo: repo,
+	}
+}
+
+// RegisterAdminRoutes registers the gift card admin endpoints under
+// /admin/giftcards, behind requireAdmin
+func RegisterAdminRoutes(router fiber.Router, handler *Handler, requireAdmin fiber.Handler) {
+	giftCards := router.Group("/admin/giftcards", requireAdmin)
+
+	giftCards.Post("/", handler.IssueCard)
+	giftCards.Get("/:code", handler.GetCard)
+}
+
+// IssueCard creates a card with an opening balance
+func (h *Handler) IssueCard(c fiber.Ctx) error {
+	var req IssueReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	card, err := req.NewCard()
+	if err != nil {
+		log.Printf("error preparing gift card: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to issue gift card",
+		})
+	}
+	if _, err := h.repo.FindByCode(card.Code); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "a gift card with this code already exists",
+		})
+	}
+	if err := h.repo.Issue(card, req.Amount, "issued by admin"); err != nil {
+		log.Printf("error issuing gift card: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to issue gift card",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    card,
+	})
+}
+
+// GetCard returns a card with its balance and ledger
+func (h *Handler) GetCard(c fiber.Ctx) error {
+	card, err := h.repo.FindByCodeWithLedger(c.Params("code"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "gift card not found",
+			})
+		}
+		log.Printf("error retrieving gift card: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve gift card",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    card,
+	})
+}
@@ -0,0 +1,35 @@
+package giftcard
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"folo/auth"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestAdminRoutes_RequireAdmin(t *testing.T) {
+	repo := NewRepository(newTestDB(t))
+	app := fiber.New()
+	RegisterAdminRoutes(app, NewHandler(repo), auth.RequireAdmin("secret"))
+
+	issue := func(authorization string) int {
+		req := httptest.NewRequest(fiber.MethodPost, "/admin/giftcards", strings.NewReader(`{"pin":"1234","amount":2500}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := issue(""); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 issuing a card without the admin token, got %d", status)
+	}
+	if status := issue("Bearer secret"); status != fiber.StatusCreated {
+		t.Errorf("expected 201 with the admin token, got %d", status)
+	}
+}
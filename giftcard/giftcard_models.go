@@ -0,0 +1,141 @@
+package giftcard
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"folo/payment"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInsufficientBalance is returned when a debit would take a card below zero
+	ErrInsufficientBalance = errors.New("insufficient gift card balance")
+	// ErrInvalidIssueRequest is returned when a request to issue a card is malformed
+	ErrInvalidIssueRequest = errors.New("invalid gift card request")
+)
+
+// Card is a stored-value gift card. Balance is in cents and only changes
+// together with a LedgerEntry.
+type Card struct {
+	gorm.Model
+	Code      string     `gorm:"column:code;not null;uniqueIndex" json:"code"`
+	PinHash   string     `gorm:"column:pin_hash;not null" json:"-"`
+	Balance   int        `gorm:"column:balance;not null" json:"balance"`
+	Currency  string     `gorm:"column:currency;not null" json:"currency"`
+	ExpiresAt *time.Time `gorm:"column:expires_at" json:"expiresAt,omitempty"`
+
+	Ledger []LedgerEntry `json:"ledger,omitempty"`
+}
+
+// TableName keeps gift cards apart from any other kind of card
+func (Card) TableName() string {
+	return "gift_cards"
+}
+
+// CheckPIN reports whether pin matches the card's PIN
+func (c *Card) CheckPIN(pin string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(c.PinHash), []byte(pin)) == nil
+}
+
+// IsExpired reports whether the card can no longer be redeemed at now
+func (c *Card) IsExpired(now time.Time) bool {
+	return c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)
+}
+
+// EntryType is the kind of balance change a ledger entry records
+type EntryType string
+
+const (
+	EntryIssue      EntryType = "ISSUE"
+	EntryRedemption EntryType = "REDEMPTION"
+	EntryRefund     EntryType = "REFUND"
+)
+
+// LedgerEntry is an append-only record of a change to a card's balance.
+// Amount is signed: redemptions are negative, issues and refunds positive.
+type LedgerEntry struct {
+	ID              uint      `gorm:"primarykey" json:"id"`
+	CreatedAt       time.Time `json:"createdAt"`
+	CardID          uint      `gorm:"column:card_id;not null;index" json:"cardId"`
+	Type            EntryType `gorm:"column:type;not null" json:"type"`
+	Amount          int       `gorm:"column:amount;not null" json:"amount"`
+	BalanceAfter    int       `gorm:"column:balance_after;not null" json:"balanceAfter"`
+	AuthorizationID string    `gorm:"column:authorization_id;index" json:"authorizationId,omitempty"`
+	Reference       string    `gorm:"column:reference" json:"reference,omitempty"`
+}
+
+// TableName groups the ledger with the gift_cards table rather than naming it
+// after the generic ledger_entries
+func (LedgerEntry) TableName() string {
+	return "gift_card_ledger"
+}
+
+// IssueReq is the admin request to issue a new gift card
+type IssueReq struct {
+	// Code is generated when empty
+	Code      string     `json:"code"`
+	Pin       string     `json:"pin"`
+	Amount    int        `json:"amount"`
+	Currency  string     `json:"currency"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// Validate checks the request before a card is issued
+func (r IssueReq) Validate() error {
+	if len(r.Pin) < 4 {
+		return fmt.Errorf("%w: pin must be at least 4 characters", ErrInvalidIssueRequest)
+	}
+	if r.Amount <= 0 {
+		return fmt.Errorf("%w: amount must be positive", ErrInvalidIssueRequest)
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidIssueRequest)
+	}
+	return nil
+}
+
+// NewCard builds an unsaved card from the request with its PIN hashed. The
+// balance is left at zero; issuing credits it through the ledger.
+func (r IssueReq) NewCard() (*Card, error) {
+	pinHash, err := bcrypt.GenerateFromPassword([]byte(r.Pin), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	code := normalizeCode(r.Code)
+	if code == "" {
+		code = generateCode()
+	}
+	currency := r.Currency
+	if currency == "" {
+		currency = payment.DefaultCurrency
+	}
+	return &Card{
+		Code:      code,
+		PinHash:   string(pinHash),
+		Currency:  currency,
+		ExpiresAt: r.ExpiresAt,
+	}, nil
+}
+
+// codeAlphabet leaves out characters that are easy to misread on a printed card
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// generateCode returns a random 16 character code grouped as XXXX-XXXX-XXXX-XXXX
+func generateCode() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	var b strings.Builder
+	for i, v := range buf {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(codeAlphabet[int(v)%len(codeAlphabet)])
+	}
+	return b.String()
+}
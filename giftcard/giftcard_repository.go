@@ -0,0 +1,118 @@
+package giftcard
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for gift cards and their ledger
+type Repository interface {
+	Issue(card *Card, amount int, reference string) error
+	FindByCode(code string) (*Card, error)
+	FindByCodeWithLedger(code string) (*Card, error)
+	Debit(cardID uint, amount int, authorizationID, reference string) (*LedgerEntry, error)
+	Credit(cardID uint, amount int, entryType EntryType, authorizationID, reference string) (*LedgerEntry, error)
+	FindEntriesByAuthorization(authorizationID string) ([]LedgerEntry, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new gift card repository
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+// Issue creates a card and credits its opening balance in one transaction
+func (r *repository) Issue(card *Card, amount int, reference string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		card.Balance = amount
+		if err := tx.Omit("Ledger").Create(card).Error; err != nil {
+			return err
+		}
+		entry := LedgerEntry{
+			CardID:       card.ID,
+			Type:         EntryIssue,
+			Amount:       amount,
+			BalanceAfter: amount,
+			Reference:    reference,
+		}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		card.Ledger = []LedgerEntry{entry}
+		return nil
+	})
+}
+
+// FindByCode finds a card by its code, ignoring case and surrounding spaces
+func (r *repository) FindByCode(code string) (*Card, error) {
+	var card Card
+	err := r.db.Where("code = ?", normalizeCode(code)).First(&card).Error
+	return &card, err
+}
+
+// FindByCodeWithLedger finds a card with its ledger, oldest entry first
+func (r *repository) FindByCodeWithLedger(code string) (*Card, error) {
+	var card Card
+	err := r.db.
+		Preload("Ledger", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("code = ?", normalizeCode(code)).
+		First(&card).Error
+	return &card, err
+}
+
+// Debit takes amount off a card. The balance check and the update are a single
+// conditional statement, so concurrent redemptions can't overdraw the card.
+func (r *repository) Debit(cardID uint, amount int, authorizationID, reference string) (*LedgerEntry, error) {
+	return r.apply(cardID, -amount, EntryRedemption, authorizationID, reference)
+}
+
+// Credit puts amount back on a card
+func (r *repository) Credit(cardID uint, amount int, entryType EntryType, authorizationID, reference string) (*LedgerEntry, error) {
+	return r.apply(cardID, amount, entryType, authorizationID, reference)
+}
+
+// FindEntriesByAuthorization returns the ledger entries made under an authorization
+func (r *repository) FindEntriesByAuthorization(authorizationID string) ([]LedgerEntry, error) {
+	var entries []LedgerEntry
+	err := r.db.Where("authorization_id = ?", authorizationID).Order("id").Find(&entries).Error
+	return entries, err
+}
+
+// apply changes a card's balance by delta and appends the matching ledger entry
+func (r *repository) apply(cardID uint, delta int, entryType EntryType, authorizationID, reference string) (*LedgerEntry, error) {
+	var entry *LedgerEntry
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Card{}).
+			Where("id = ? AND balance + ? >= 0", cardID, delta).
+			Update("balance", gorm.Expr("balance + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientBalance
+		}
+
+		var card Card
+		if err := tx.Select("balance").First(&card, cardID).Error; err != nil {
+			return err
+		}
+		entry = &LedgerEntry{
+			CardID:          cardID,
+			Type:            entryType,
+			Amount:          delta,
+			BalanceAfter:    card.Balance,
+			AuthorizationID: authorizationID,
+			Reference:       reference,
+		}
+		return tx.Create(entry).Error
+	})
+	return entry, err
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,240 @@
+package kitchen
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// heartbeat is how often an idle stream is pinged, so proxies keep it open
+// and closed screens are noticed
+const heartbeat = 15 * time.Second
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the kitchen screen endpoints under /kitchen
+func RegisterRoutes(router fiber.Router, handler *Handler) {
+	kitchen := router.Group("/kitchen")
+
+	kitchen.Get("/tickets", handler.ListTickets)
+	kitchen.Get("/tickets/:id", handler.GetTicket)
+	kitchen.Post("/tickets/:id/bump", handler.BumpTicket)
+	kitchen.Put("/tickets/:id/status", handler.UpdateTicketStatus)
+	kitchen.Get("/stream", handler.Stream)
+}
+
+// ListTickets returns the open tickets, optionally for one location_id
+func (h *Handler) ListTickets(c fiber.Ctx) error {
+	storeID, err := locationFilter(c)
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	tickets, err := h.service.Open(storeID)
+	if err != nil {
+		return ticketError(c, err, "failed to retrieve tickets")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    tickets,
+	})
+}
+
+// GetTicket returns a ticket
+func (h *Handler) GetTicket(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidTicketID(c)
+	}
+
+	ticket, err := h.service.Ticket(uint(id))
+	if err != nil {
+		return ticketError(c, err, "failed to retrieve ticket")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    ticket,
+	})
+}
+
+// BumpTicket moves a ticket on to the next station
+func (h *Handler) BumpTicket(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidTicketID(c)
+	}
+
+	ticket, err := h.service.Bump(uint(id))
+	if err != nil {
+		return ticketError(c, err, "failed to bump ticket")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    ticket,
+	})
+}
+
+// UpdateTicketStatus moves a ticket to the given station
+func (h *Handler) UpdateTicketStatus(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidTicketID(c)
+	}
+
+	var req StatusReq
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	ticket, err := h.service.SetStatus(uint(id), req.Status)
+	if err != nil {
+		return ticketError(c, err, "failed to update ticket")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    ticket,
+	})
+}
+
+// Stream sends ticket changes as Server-Sent Events, optionally for one
+// location_id. The open tickets come first as a "snapshot" event, then each
+// change as a "ticket.created" or "ticket.updated" event.
+func (h *Handler) Stream(c fiber.Ctx) error {
+	storeID, err := locationFilter(c)
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	// Subscribe before reading the snapshot so no change falls in between
+	events, unsubscribe := h.service.Subscribe(storeID)
+	tickets, err := h.service.Open(storeID)
+	if err != nil {
+		unsubscribe()
+		return ticketError(c, err, "failed to retrieve tickets")
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+		ping := time.NewTicker(heartbeat)
+		defer ping.Stop()
+
+		if err := writeEvent(w, "snapshot", tickets); err != nil {
+			return
+		}
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := writeEvent(w, string(event.Type), event.Ticket); err != nil {
+					return
+				}
+			case <-ping.C:
+				if _, err := w.WriteString(": ping\n\n"); err != nil {
+					return
+				}
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+}
+
+// writeEvent writes one Server-Sent Event and flushes it to the screen. An
+// error means the screen has gone.
+func writeEvent(w *bufio.Writer, name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to encode %s event: %v", name, err)
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// locationFilter reads the optional location_id query parameter
+func locationFilter(c fiber.Ctx) (*uint, error) {
+	raw := c.Query("location_id")
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return nil, errors.New("invalid location ID")
+	}
+	storeID := uint(id)
+	return &storeID, nil
+}
+
+func invalidTicketID(c fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"error":   "invalid ticket ID",
+	})
+}
+
+func invalidLocationID(c fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"error":   "invalid location ID",
+	})
+}
+
+// ticketError maps service errors to responses, logging unexpected ones
+func ticketError(c fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrTicketNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, ErrTicketClosed):
+		status = fiber.StatusConflict
+	case errors.Is(err, ErrInvalidStatus):
+		status = fiber.StatusBadRequest
+	default:
+		log.Printf("%s: %s", message, err.Error())
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"error":   message,
+		})
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"success": false,
+		"error":   err.Error(),
+	})
+}
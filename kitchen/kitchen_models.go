@@ -0,0 +1,131 @@
+package kitchen
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrTicketNotFound is returned when no ticket has the given ID
+	ErrTicketNotFound = errors.New("ticket not found")
+	// ErrTicketClosed is returned when bumping a ticket that is done or voided
+	ErrTicketClosed = errors.New("ticket is closed")
+	// ErrInvalidStatus is returned when moving a ticket to a status it can't take
+	ErrInvalidStatus = errors.New("invalid ticket status")
+)
+
+// Status is the station a ticket is at
+type Status string
+
+const (
+	// Received tickets are waiting for the kitchen to start them
+	Received Status = "RECEIVED"
+	// InPrep tickets are being made
+	InPrep Status = "IN_PREP"
+	// Ready tickets are waiting for the customer or driver
+	Ready Status = "READY"
+	// Done tickets have been handed over and leave the screens
+	Done Status = "DONE"
+	// Voided tickets belong to canceled orders
+	Voided Status = "VOIDED"
+)
+
+// stations are the statuses a ticket is bumped through, in order
+var stations = []Status{Received, InPrep, Ready, Done}
+
+// next returns the station after s, or "" when there is none
+func (s Status) next() Status {
+	for i, station := range stations[:len(stations)-1] {
+		if station == s {
+			return stations[i+1]
+		}
+	}
+	return ""
+}
+
+// IsOpen reports whether a ticket at this status is still on the screens
+func (s Status) IsOpen() bool {
+	return s == Received || s == InPrep || s == Ready
+}
+
+// Ticket is an order as the kitchen sees it
+type Ticket struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// OrderID is the order the ticket was fired for; an order has one ticket
+	OrderID    uint         `gorm:"uniqueIndex;not null" json:"orderId"`
+	StoreID    uint         `gorm:"index" json:"storeId"`
+	Status     Status       `gorm:"index" json:"status"`
+	IsDelivery bool         `json:"isDelivery"`
+	DueAt      time.Time    `json:"dueAt"`
+	Notes      string       `json:"notes,omitempty"`
+	Items      []TicketItem `gorm:"constraint:OnDelete:CASCADE" json:"items"`
+	StartedAt  *time.Time   `json:"startedAt,omitempty"`
+	ReadyAt    *time.Time   `json:"readyAt,omitempty"`
+	DoneAt     *time.Time   `json:"doneAt,omitempty"`
+	VoidReason string       `json:"voidReason,omitempty"`
+}
+
+func (Ticket) TableName() string {
+	return "kitchen_tickets"
+}
+
+// moveTo puts the ticket at a station, stamping when it got there and
+// clearing the stamps of the stations after it
+func (t *Ticket) moveTo(status Status, now time.Time) {
+	t.Status = status
+	switch status {
+	case Received:
+		t.StartedAt, t.ReadyAt, t.DoneAt = nil, nil, nil
+	case InPrep:
+		t.StartedAt, t.ReadyAt, t.DoneAt = &now, nil, nil
+	case Ready:
+		t.ReadyAt, t.DoneAt = &now, nil
+	case Done:
+		t.DoneAt = &now
+	}
+}
+
+// TicketItem is one basket line to make
+type TicketItem struct {
+	ID        uint     `gorm:"primarykey" json:"-"`
+	TicketID  uint     `gorm:"index;not null" json:"-"`
+	Name      string   `json:"name"`
+	Quantity  int      `json:"quantity"`
+	Modifiers []string `gorm:"serializer:json" json:"modifiers,omitempty"`
+}
+
+func (TicketItem) TableName() string {
+	return "kitchen_ticket_items"
+}
+
+// StatusReq represents the request body for moving a ticket to a station
+type StatusReq struct {
+	Status Status `json:"status"`
+}
+
+// Validate checks the status is a station a ticket can be moved to
+func (r StatusReq) Validate() error {
+	for _, station := range stations {
+		if r.Status == station {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q, expected one of %v", ErrInvalidStatus, r.Status, stations)
+}
+
+// EventType says what happened to a ticket
+type EventType string
+
+const (
+	TicketCreated EventType = "ticket.created"
+	TicketUpdated EventType = "ticket.updated"
+)
+
+// Event is sent to kitchen screens when a ticket is created or moves
+type Event struct {
+	Type   EventType `json:"type"`
+	Ticket *Ticket   `json:"ticket"`
+}
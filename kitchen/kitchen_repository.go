@@ -0,0 +1,86 @@
+package kitchen
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Repository handles database operations for kitchen tickets
+type Repository interface {
+	Create(ticket *Ticket) (bool, error)
+	FindByID(id uint) (*Ticket, error)
+	FindByOrderID(orderID uint) (*Ticket, error)
+	FindOpen(storeID *uint) ([]Ticket, error)
+	CountQueued(storeID uint) (int64, error)
+	Update(ticket *Ticket) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new kitchen repository
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+// Create stores a ticket with its items. It reports false, creating nothing,
+// when the order already has a ticket.
+func (r *repository) Create(ticket *Ticket) (bool, error) {
+	created := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Omit("Items").Clauses(clause.OnConflict{DoNothing: true}).Create(ticket)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		for i := range ticket.Items {
+			ticket.Items[i].TicketID = ticket.ID
+		}
+		if len(ticket.Items) == 0 {
+			return nil
+		}
+		return tx.Create(&ticket.Items).Error
+	})
+	return created, err
+}
+
+// FindByID finds a ticket with its items
+func (r *repository) FindByID(id uint) (*Ticket, error) {
+	var ticket Ticket
+	err := r.db.Preload("Items").First(&ticket, id).Error
+	return &ticket, err
+}
+
+// FindByOrderID finds the ticket fired for an order
+func (r *repository) FindByOrderID(orderID uint) (*Ticket, error) {
+	var ticket Ticket
+	err := r.db.Preload("Items").Where("order_id = ?", orderID).First(&ticket).Error
+	return &ticket, err
+}
+
+// FindOpen returns the tickets still on the screens, soonest due first,
+// optionally for one location
+func (r *repository) FindOpen(storeID *uint) ([]Ticket, error) {
+	query := r.db.Preload("Items").Where("status IN ?", []Status{Received, InPrep, Ready})
+	if storeID != nil {
+		query = query.Where("store_id = ?", *storeID)
+	}
+	var tickets []Ticket
+	err := query.Order("due_at").Order("id").Find(&tickets).Error
+	return tickets, err
+}
+
+// CountQueued counts a location's tickets waiting for or being made
+func (r *repository) CountQueued(storeID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&Ticket{}).
+		Where("status IN ? AND store_id = ?", []Status{Received, InPrep}, storeID).
+		Count(&count).Error
+	return count, err
+}
+
+// Update saves a ticket's own columns, leaving its items untouched
+func (r *repository) Update(ticket *Ticket) error {
+	return r.db.Omit(clause.Associations).Save(ticket).Error
+}
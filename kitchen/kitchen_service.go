@@ -0,0 +1,169 @@
+package kitchen
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// subscriberBuffer is how many events a slow screen can fall behind by
+// before events to it are dropped
+const subscriberBuffer = 32
+
+// Service keeps the kitchen's tickets and tells subscribed screens about
+// every change
+type Service struct {
+	repo Repository
+
+	mu          sync.Mutex
+	subscribers map[chan Event]*uint
+}
+
+// NewService creates a new kitchen service
+func NewService(repo Repository) *Service {
+	return &Service{
+		repo:        repo,
+		subscribers: make(map[chan Event]*uint),
+	}
+}
+
+// Fire puts a new ticket on the screens. An order is only fired once; firing
+// it again returns the existing ticket.
+func (s *Service) Fire(ticket *Ticket) (*Ticket, error) {
+	ticket.Status = Received
+	// Stored times compare as text, so keep them all in local time
+	ticket.DueAt = ticket.DueAt.Local()
+	created, err := s.repo.Create(ticket)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return s.repo.FindByOrderID(ticket.OrderID)
+	}
+	log.Printf("ticket %d fired for order %d", ticket.ID, ticket.OrderID)
+	s.publish(Event{Type: TicketCreated, Ticket: ticket})
+	return ticket, nil
+}
+
+// Void takes a canceled order's ticket off the screens. Orders that never
+// reached the kitchen are ignored.
+func (s *Service) Void(orderID uint, reason string) error {
+	ticket, err := s.repo.FindByOrderID(orderID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !ticket.Status.IsOpen() {
+		return nil
+	}
+	ticket.Status = Voided
+	ticket.VoidReason = reason
+	return s.update(ticket)
+}
+
+// Open returns the tickets still on the screens, for one location or all
+// when storeID is nil
+func (s *Service) Open(storeID *uint) ([]Ticket, error) {
+	return s.repo.FindOpen(storeID)
+}
+
+// Load is how many tickets a location's kitchen has yet to make, to
+// estimate how long new orders will wait
+func (s *Service) Load(storeID uint) (int64, error) {
+	return s.repo.CountQueued(storeID)
+}
+
+// Ticket returns a ticket by ID
+func (s *Service) Ticket(id uint) (*Ticket, error) {
+	ticket, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTicketNotFound
+	}
+	return ticket, err
+}
+
+// Bump moves a ticket on to the next station
+func (s *Service) Bump(id uint) (*Ticket, error) {
+	ticket, err := s.Ticket(id)
+	if err != nil {
+		return nil, err
+	}
+	next := ticket.Status.next()
+	if next == "" {
+		return ticket, fmt.Errorf("%w: ticket is %s", ErrTicketClosed, ticket.Status)
+	}
+	ticket.moveTo(next, time.Now())
+	return ticket, s.update(ticket)
+}
+
+// SetStatus moves a ticket to any station, e.g. back to in-prep when a ready
+// order has to be remade
+func (s *Service) SetStatus(id uint, status Status) (*Ticket, error) {
+	if err := (StatusReq{Status: status}).Validate(); err != nil {
+		return nil, err
+	}
+	ticket, err := s.Ticket(id)
+	if err != nil {
+		return nil, err
+	}
+	if ticket.Status == Voided {
+		return ticket, fmt.Errorf("%w: ticket is %s", ErrTicketClosed, ticket.Status)
+	}
+	ticket.moveTo(status, time.Now())
+	return ticket, s.update(ticket)
+}
+
+// update saves a ticket and tells the screens
+func (s *Service) update(ticket *Ticket) error {
+	if err := s.repo.Update(ticket); err != nil {
+		return err
+	}
+	s.publish(Event{Type: TicketUpdated, Ticket: ticket})
+	return nil
+}
+
+// Subscribe returns a channel of ticket events, for one location or all when
+// storeID is nil. Call the returned function to unsubscribe.
+func (s *Service) Subscribe(storeID *uint) (<-chan Event, func()) {
+	events := make(chan Event, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[events] = storeID
+	s.mu.Unlock()
+
+	return events, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[events]; ok {
+			delete(s.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// publish sends an event to every interested subscriber without waiting. A
+// screen that has fallen behind misses the event and catches up when it
+// reloads the open tickets.
+func (s *Service) publish(event Event) {
+	// Screens encode the ticket after the caller has moved on, so send a copy
+	ticket := *event.Ticket
+	event.Ticket = &ticket
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for events, storeID := range s.subscribers {
+		if storeID != nil && *storeID != event.Ticket.StoreID {
+			continue
+		}
+		select {
+		case events <- event:
+		default:
+			log.Printf("kitchen screen behind, dropped %s for ticket %d", event.Type, event.Ticket.ID)
+		}
+	}
+}
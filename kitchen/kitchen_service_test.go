@@ -0,0 +1,149 @@
+package kitchen
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"folo/database/databasetest"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory SQLite database with the kitchen tables migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Open(t, &Ticket{}, &TicketItem{})
+}
+
+// fire puts a ticket for the order on the screens
+func fire(t *testing.T, service *Service, orderID, storeID uint) *Ticket {
+	t.Helper()
+	ticket, err := service.Fire(&Ticket{
+		OrderID: orderID,
+		StoreID: storeID,
+		DueAt:   time.Now().Add(20 * time.Minute),
+		Items:   []TicketItem{{Name: "Burrito", Quantity: 2, Modifiers: []string{"No onions"}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error firing ticket: %v", err)
+	}
+	return ticket
+}
+
+func TestFire_OncePerOrder(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	first := fire(t, service, 1, 1)
+
+	again, err := service.Fire(&Ticket{OrderID: 1, StoreID: 1})
+	if err != nil {
+		t.Fatalf("unexpected error firing again: %v", err)
+	}
+	if again.ID != first.ID || len(again.Items) != 1 {
+		t.Errorf("expected the existing ticket back, got %+v", again)
+	}
+
+	open, err := service.Open(nil)
+	if err != nil || len(open) != 1 {
+		t.Fatalf("expected one open ticket, got %d, %v", len(open), err)
+	}
+	if item := open[0].Items[0]; item.Quantity != 2 || len(item.Modifiers) != 1 || item.Modifiers[0] != "No onions" {
+		t.Errorf("expected the items with their modifiers, got %+v", item)
+	}
+}
+
+func TestBump_MovesThroughStations(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	ticket := fire(t, service, 1, 1)
+
+	for _, want := range []Status{InPrep, Ready, Done} {
+		bumped, err := service.Bump(ticket.ID)
+		if err != nil {
+			t.Fatalf("unexpected error bumping to %s: %v", want, err)
+		}
+		if bumped.Status != want {
+			t.Fatalf("expected %s, got %s", want, bumped.Status)
+		}
+	}
+	if _, err := service.Bump(ticket.ID); !errors.Is(err, ErrTicketClosed) {
+		t.Errorf("expected ErrTicketClosed, got %v", err)
+	}
+	if open, _ := service.Open(nil); len(open) != 0 {
+		t.Errorf("expected a done ticket off the screens, got %d open", len(open))
+	}
+
+	stored, _ := service.Ticket(ticket.ID)
+	if stored.StartedAt == nil || stored.ReadyAt == nil || stored.DoneAt == nil {
+		t.Errorf("expected each station to be stamped, got %+v", stored)
+	}
+}
+
+func TestSetStatus_RecallsAReadyTicket(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	ticket := fire(t, service, 1, 1)
+	if _, err := service.SetStatus(ticket.ID, Ready); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	recalled, err := service.SetStatus(ticket.ID, InPrep)
+	if err != nil {
+		t.Fatalf("unexpected error recalling: %v", err)
+	}
+	if recalled.ReadyAt != nil {
+		t.Errorf("expected the ready time cleared, got %v", recalled.ReadyAt)
+	}
+	if _, err := service.SetStatus(ticket.ID, Voided); !errors.Is(err, ErrInvalidStatus) {
+		t.Errorf("expected voiding by status to be rejected, got %v", err)
+	}
+}
+
+func TestSetStatus_ReopensADoneTicket(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	ticket := fire(t, service, 1, 1)
+	if _, err := service.SetStatus(ticket.ID, Done); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reopened, err := service.SetStatus(ticket.ID, Ready)
+	if err != nil {
+		t.Fatalf("unexpected error reopening: %v", err)
+	}
+	stored, _ := service.Ticket(reopened.ID)
+	if stored.DoneAt != nil || stored.ReadyAt == nil {
+		t.Errorf("expected the done time cleared and a new ready time, got done %v ready %v", stored.DoneAt, stored.ReadyAt)
+	}
+}
+
+func TestSubscribe_ReceivesEventsForItsLocation(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	storeID := uint(2)
+	events, unsubscribe := service.Subscribe(&storeID)
+	defer unsubscribe()
+
+	fire(t, service, 1, 1)
+	ticket := fire(t, service, 2, storeID)
+	if err := service.Void(2, "customer canceled"); err != nil {
+		t.Fatalf("unexpected error voiding: %v", err)
+	}
+
+	for _, want := range []EventType{TicketCreated, TicketUpdated} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.Ticket.ID != ticket.ID {
+				t.Errorf("expected %s for ticket %d, got %s for %d", want, ticket.ID, event.Type, event.Ticket.ID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", want)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("expected no more events, got %s for ticket %d", event.Type, event.Ticket.ID)
+	default:
+	}
+
+	voided, _ := service.Ticket(ticket.ID)
+	if voided.Status != Voided || voided.VoidReason != "customer canceled" {
+		t.Errorf("expected the ticket voided with the reason, got %+v", voided)
+	}
+}
@@ -3,10 +3,18 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"folo/auth"
 	"folo/database"
 	"folo/delivery"
+	"folo/fleet"
+	"folo/giftcard"
+	"folo/kitchen"
 	"folo/ordering"
+	"folo/payment"
+	"folo/store"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/gofiber/fiber/v3/middleware/logger"
@@ -24,30 +32,152 @@ func main() {
 	if err := database.AutoMigrate(
 		&ordering.Basket{},
 		&ordering.BasketItem{},
+		&ordering.BasketItemModifier{},
+		&ordering.MenuCategory{},
 		&ordering.MenuItem{},
+		&ordering.MenuItemOverride{},
+		&ordering.ModifierGroup{},
+		&ordering.Modifier{},
 		&ordering.Order{},
-		&delivery.DeliveryData{}); err != nil {
+		&ordering.OrderStatusHistory{},
+		&delivery.DeliveryData{},
+		&payment.Authorization{},
+		&ordering.IdempotencyRecord{},
+		&giftcard.Card{},
+		&giftcard.LedgerEntry{},
+		&fleet.Driver{},
+		&fleet.Delivery{},
+		&store.Store{},
+		&store.Hours{},
+		&store.Holiday{},
+		&store.TaxRule{},
+		&kitchen.Ticket{},
+		&kitchen.TicketItem{}); err != nil {
 		log.Fatal("Failed to run migrations:", err)
 	}
+	if err := ordering.MigrateOrderTotals(database.DB); err != nil {
+		log.Fatal("Failed to migrate order totals:", err)
+	}
 
 	// Initialize repositories
 	orderRepo := ordering.NewOrderRepository(database.DB)
 	basketRepo := ordering.NewBasketRepository(database.DB)
+	menuRepo := ordering.NewMenuRepository(database.DB)
 	deliveryDataRepo := ordering.NewDeliveryDataRepository(database.DB)
+	paymentRepo := ordering.NewPaymentRepository(database.DB)
+	giftCardRepo := giftcard.NewRepository(database.DB)
+	idempotencyRepo := ordering.NewIdempotencyRepository(database.DB)
+	fleetRepo := fleet.NewRepository(database.DB)
+	storeRepo := store.NewRepository(database.DB)
+	kitchenRepo := kitchen.NewRepository(database.DB)
 
 	// Initialize delivery service
 	godotenv.Load()
+
+	// Load the locations, saving the profiles in STORE_PROFILE_FILE over the stored ones when set
+	storeService := store.NewService(storeRepo)
+	if err := storeService.Load(os.Getenv("STORE_PROFILE_FILE")); err != nil {
+		log.Fatal("Failed to load store profiles (set STORE_PROFILE_FILE, see store/store.example.json):", err)
+	}
+
 	doorDashConfig := delivery.DoorDashConfig{
 		DeveloperID:   os.Getenv("DOORDASH_DEVELOPER_ID"),
 		KeyID:         os.Getenv("DOORDASH_KEY_ID"),
 		SigningSecret: os.Getenv("DOORDASH_SIGNING_SECRET"),
+		BaseURL:       os.Getenv("DOORDASH_BASE_URL"),
 	}
 	doorDashService := delivery.NewDoorDashService(doorDashConfig)
-	orderService := ordering.NewOrderService(orderRepo, basketRepo, deliveryDataRepo, doorDashService)
+
+	// Register delivery providers; orders go with the best quote per DELIVERY_QUOTE_POLICY
+	quotePolicy, err := delivery.ParseQuotePolicy(os.Getenv("DELIVERY_QUOTE_POLICY"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	deliveries := delivery.NewRegistry(quotePolicy)
+	deliveries.Register(delivery.ProviderDoorDash, doorDashService)
+
+	// Our own drivers only quote while someone is clocked in. FLEET_DELIVERY_FEE
+	// is in cents and defaults to free delivery.
+	var fleetFee int64
+	if fee := os.Getenv("FLEET_DELIVERY_FEE"); fee != "" {
+		if fleetFee, err = strconv.ParseInt(fee, 10, 64); err != nil {
+			log.Fatal("FLEET_DELIVERY_FEE must be a whole number of cents:", err)
+		}
+	}
+	fleetService := fleet.NewService(fleetRepo, fleet.Config{Fee: fleetFee})
+	deliveries.Register(delivery.ProviderInHouse, fleetService)
+
+	// Without an address dataset dropoffs go to providers as the customer typed them
+	var geocoder delivery.Geocoder
+	if path := os.Getenv("GEOCODER_ADDRESSES_FILE"); path != "" {
+		offline, err := delivery.LoadOfflineGeocoder(path)
+		if err != nil {
+			log.Fatal("Failed to load address dataset:", err)
+		}
+		geocoder = offline
+	}
+
+	// Without a zone file every dropoff is delivered to at the provider's fee.
+	// Zones are matched on geocoded locations, so they need the address dataset.
+	var zones *delivery.Zones
+	if path := os.Getenv("DELIVERY_ZONES_FILE"); path != "" {
+		if geocoder == nil {
+			log.Fatal("DELIVERY_ZONES_FILE requires GEOCODER_ADDRESSES_FILE to locate dropoffs")
+		}
+		if zones, err = delivery.LoadZones(path); err != nil {
+			log.Fatal("Failed to load delivery zones:", err)
+		}
+	}
+
+	// Initialize payment providers - fake processors until real ones are integrated
+	paymentLatency, _ := time.ParseDuration(os.Getenv("FAKE_PAYMENT_LATENCY"))
+	paymentProviders := ordering.PaymentProviders{
+		Card: payment.NewFakeGateway(payment.FakeGatewayConfig{
+			Rules:                 payment.DefaultFakeRules(),
+			Latency:               paymentLatency,
+			MaxOvercapturePercent: 20,
+		}),
+		Gift:   giftcard.NewGateway(giftCardRepo),
+		Crypto: payment.NewFakeCryptoGateway(payment.FakeCryptoConfig{}),
+	}
+
+	// Orders are sent to the kitchen screens as tickets when they're released
+	kitchenService := kitchen.NewService(kitchenRepo)
+
+	orderService := ordering.NewOrderService(orderRepo, basketRepo, deliveryDataRepo, paymentRepo, ordering.NewUnitOfWork(database.DB), storeService, kitchenService, ordering.DeliveryOptions{
+		Providers: deliveries,
+		Geocoder:  geocoder,
+		Zones:     zones,
+	}, paymentProviders)
+	fleetService.OnEvent(orderService.HandleDeliveryEvent)
 
 	// Initialize handlers
-	orderHandler := ordering.NewOrderHandler(orderService)
-	basketHandler := ordering.NewBasketHandler(basketRepo)
+	orderHandler := ordering.NewOrderHandler(orderService, idempotencyRepo)
+	basketHandler := ordering.NewBasketHandler(basketRepo, menuRepo, orderService, storeService)
+	menuHandler := ordering.NewMenuHandler(menuRepo, storeService)
+	giftCardHandler := giftcard.NewHandler(giftCardRepo)
+	webhookHandler := ordering.NewWebhookHandler(orderService, os.Getenv("DOORDASH_WEBHOOK_AUTH"))
+	fleetHandler := fleet.NewHandler(fleetService)
+	storeHandler := store.NewHandler(storeService)
+	kitchenHandler := kitchen.NewHandler(kitchenService)
+
+	// Purge idempotency keys once their replay window has passed
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := idempotencyRepo.DeleteExpired(time.Now()); err != nil {
+				log.Printf("failed to purge idempotency keys: %v", err)
+			}
+		}
+	}()
+
+	// Release scheduled orders to the kitchen and dispatch their deliveries when they're due
+	go func() {
+		for now := range time.Tick(time.Minute) {
+			if _, err := orderService.ReleaseScheduledOrders(now); err != nil {
+				log.Printf("failed to release scheduled orders: %v", err)
+			}
+		}
+	}()
 
 	// Initialize Fiber app
 	app := fiber.New(fiber.Config{
@@ -59,9 +189,19 @@ func main() {
 
 	api := app.Group("/api")
 
+	// Staff endpoints take ADMIN_API_TOKEN as a bearer token, and are closed without one
+	requireAdmin := auth.RequireAdmin(os.Getenv("ADMIN_API_TOKEN"))
+
 	// Register routes with handlers
 	ordering.RegisterBasketsRoutes(api, basketHandler)
+	ordering.RegisterMenuRoutes(api, menuHandler)
 	ordering.RegisterOrderRoutes(api, orderHandler)
+	giftcard.RegisterAdminRoutes(api, giftCardHandler, requireAdmin)
+	ordering.RegisterWebhookRoutes(api, webhookHandler)
+	fleet.RegisterAdminRoutes(api, fleetHandler, requireAdmin)
+	fleet.RegisterDriverRoutes(api, fleetHandler)
+	store.RegisterRoutes(api, storeHandler, requireAdmin)
+	kitchen.RegisterRoutes(api, kitchenHandler)
 
 	app.Get("/health", func(c fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -1,19 +1,30 @@
 package ordering
 
 import (
+	"errors"
 	"log"
 	"strconv"
 
+	"folo/delivery"
+	"folo/store"
+
 	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
 )
 
 type BasketHandler struct {
-	basketRepo BasketRepository
+	basketRepo   BasketRepository
+	menuRepo     MenuRepository
+	orderService OrderService
+	stores       *store.Service
 }
 
-func NewBasketHandler(basketRepo BasketRepository) *BasketHandler {
+func NewBasketHandler(basketRepo BasketRepository, menuRepo MenuRepository, orderService OrderService, stores *store.Service) *BasketHandler {
 	return &BasketHandler{
-		basketRepo: basketRepo,
+		basketRepo:   basketRepo,
+		menuRepo:     menuRepo,
+		orderService: orderService,
+		stores:       stores,
 	}
 }
 
@@ -25,6 +36,12 @@ func RegisterBasketsRoutes(router fiber.Router, handler *BasketHandler) {
 	baskets.Post("/", handler.CreateBasketWithItems)
 	baskets.Put("/:id", handler.UpdateBasket)
 	baskets.Delete("/:id", handler.DeleteBasket)
+	baskets.Post("/:id/items", handler.AddItem)
+	baskets.Patch("/:id/items/:itemId", handler.UpdateItemQuantity)
+	baskets.Delete("/:id/items/:itemId", handler.RemoveItem)
+	baskets.Get("/:id/delivery-quote", handler.GetDeliveryQuote)
+
+	router.Post("/locations/:locationId/baskets", handler.CreateBasketWithItems)
 }
 
 func (h *BasketHandler) GetBaskets(c fiber.Ctx) error {
@@ -69,6 +86,8 @@ func (h *BasketHandler) GetBasket(c fiber.Ctx) error {
 	})
 }
 
+// CreateBasketWithItems creates a basket at the location in the route or the
+// body's storeId, or at the default location when neither is given
 func (h *BasketHandler) CreateBasketWithItems(c fiber.Ctx) error {
 	basket := new(Basket)
 
@@ -79,6 +98,18 @@ func (h *BasketHandler) CreateBasketWithItems(c fiber.Ctx) error {
 		})
 	}
 
+	var profile *store.Store
+	var err error
+	if c.Params("locationId") != "" {
+		profile, err = findLocation(c, h.stores)
+	} else {
+		profile, err = h.stores.Find(basket.StoreID)
+	}
+	if err != nil {
+		return locationError(c, err)
+	}
+	basket.StoreID = profile.ID
+
 	if err := h.basketRepo.Create(basket); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -92,23 +123,48 @@ func (h *BasketHandler) CreateBasketWithItems(c fiber.Ctx) error {
 	})
 }
 
+// UpdateBasket updates basket-level fields; use the /items routes to change lines
 func (h *BasketHandler) UpdateBasket(c fiber.Ctx) error {
-	id := c.Params("id")
-	basket := new(Basket)
+	idParam := c.Params("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid basket ID",
+		})
+	}
 
-	if err := c.Bind().Body(basket); err != nil {
+	// Fields left out of the body are left as they are
+	req := new(struct {
+		Description *string `json:"description"`
+	})
+	if err := c.Bind().Body(req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
 			"error":   "Invalid request body",
 		})
 	}
 
-	// Mock update - keeping for now
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"success": true,
-		"data":    basket,
-		"id":      id,
-	})
+	basket, err := h.basketRepo.FindByID(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "basket not found",
+		})
+	}
+
+	if req.Description != nil {
+		basket.Description = *req.Description
+	}
+	if err := h.basketRepo.Update(basket); err != nil {
+		log.Printf("error updating basket %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update basket",
+		})
+	}
+
+	return h.basketWithTotal(c, fiber.StatusOK, uint(id))
 }
 
 func (h *BasketHandler) DeleteBasket(c fiber.Ctx) error {
@@ -134,3 +190,300 @@ func (h *BasketHandler) DeleteBasket(c fiber.Ctx) error {
 		"id":      id,
 	})
 }
+
+// AddItem adds a menu item to a basket, merging with an identical existing line
+func (h *BasketHandler) AddItem(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid basket ID",
+		})
+	}
+
+	req := new(BasketItemReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	basket, err := h.basketRepo.FindByIDWithItems(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "basket not found",
+		})
+	}
+
+	var menuItem *MenuItem
+	if req.MenuItemID != 0 {
+		menuItem, err = h.menuRepo.FindByID(req.MenuItemID)
+	} else {
+		menuItem, err = h.menuRepo.FindBySKU(req.SKU)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "menu item not found",
+		})
+	}
+	menuItem.ApplyLocation(basket.StoreID)
+	if !menuItem.IsAvailable() {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"success": false,
+			"error":   ErrItemUnavailable.Error(),
+		})
+	}
+
+	modifiers, err := menuItem.SelectModifiers(req.ModifierIDs)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	line := BasketItem{
+		BasketID:   basket.ID,
+		MenuItemID: menuItem.ID,
+		Quantity:   req.Quantity,
+		Modifiers:  modifiers,
+	}
+	if existing := findMatchingLine(basket, &line); existing != nil {
+		existing.Quantity += req.Quantity
+		err = h.basketRepo.UpdateItem(existing)
+	} else {
+		err = h.basketRepo.AddItem(&line)
+	}
+	if err != nil {
+		log.Printf("error adding item to basket %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to add item to basket",
+		})
+	}
+
+	return h.basketWithTotal(c, fiber.StatusCreated, basket.ID)
+}
+
+// UpdateItemQuantity sets the quantity of a basket line
+func (h *BasketHandler) UpdateItemQuantity(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid basket ID",
+		})
+	}
+	itemID, err := strconv.Atoi(c.Params("itemId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid item ID",
+		})
+	}
+
+	req := new(BasketItemQuantityReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if req.Quantity <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "quantity must be positive",
+		})
+	}
+
+	item, err := h.basketRepo.FindItem(uint(id), uint(itemID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "basket item not found",
+		})
+	}
+
+	item.Quantity = req.Quantity
+	if err := h.basketRepo.UpdateItem(item); err != nil {
+		log.Printf("error updating basket item %d: %s", itemID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update basket item",
+		})
+	}
+
+	return h.basketWithTotal(c, fiber.StatusOK, uint(id))
+}
+
+// RemoveItem removes a line from a basket
+func (h *BasketHandler) RemoveItem(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid basket ID",
+		})
+	}
+	itemID, err := strconv.Atoi(c.Params("itemId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid item ID",
+		})
+	}
+
+	item, err := h.basketRepo.FindItem(uint(id), uint(itemID))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "basket item not found",
+		})
+	}
+
+	if err := h.basketRepo.RemoveItem(item); err != nil {
+		log.Printf("error removing basket item %d: %s", itemID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to remove basket item",
+		})
+	}
+
+	return h.basketWithTotal(c, fiber.StatusOK, uint(id))
+}
+
+// GetDeliveryQuote prices delivering the basket to the dropoff in the query
+// string, so the fee can be shown before checkout. Submitting the order with
+// the same basket and address reuses the quote until it expires.
+func (h *BasketHandler) GetDeliveryQuote(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid basket ID",
+		})
+	}
+
+	dropoff, err := parseDropoffQuery(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	quote, err := h.orderService.QuoteDelivery(uint(id), dropoff)
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "basket not found",
+			})
+		case isUndeliverable(err):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, ErrDeliveryQuoteFailed):
+			log.Printf("error quoting delivery for basket %d: %s", id, err.Error())
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"error":   "could not get a delivery quote",
+			})
+		}
+		log.Printf("error quoting delivery for basket %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to quote delivery",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    quote,
+	})
+}
+
+// parseDropoffQuery reads the dropoff for a delivery quote from the query string
+func parseDropoffQuery(c fiber.Ctx) (*delivery.DeliveryData, error) {
+	dropoff := &delivery.DeliveryData{
+		Address:             c.Query("address"),
+		Unit:                c.Query("unit"),
+		PhoneNumber:         c.Query("phone_number"),
+		DropoffInstructions: c.Query("dropoff_instructions"),
+	}
+	if dropoff.Address == "" {
+		return nil, errors.New("address is required")
+	}
+
+	lat, lng := c.Query("lat"), c.Query("lng")
+	if (lat == "") != (lng == "") {
+		return nil, errors.New("lat and lng must be given together")
+	}
+	if lat != "" {
+		latValue, err := strconv.ParseFloat(lat, 64)
+		if err != nil {
+			return nil, errors.New("lat must be a number")
+		}
+		lngValue, err := strconv.ParseFloat(lng, 64)
+		if err != nil {
+			return nil, errors.New("lng must be a number")
+		}
+		dropoff.Lat, dropoff.Lng = &latValue, &lngValue
+	}
+	return dropoff, nil
+}
+
+// basketWithTotal reloads the basket and responds with it and its recalculated total
+func (h *BasketHandler) basketWithTotal(c fiber.Ctx, status int, id uint) error {
+	basket, err := h.basketRepo.FindByIDWithItems(id)
+	if err != nil {
+		log.Printf("error reloading basket %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve basket",
+		})
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"success": true,
+		"data":    basket,
+		"total":   basket.CalculateTotal(),
+	})
+}
+
+// findMatchingLine returns the existing basket line with the same menu item and
+// modifier selection as line, if any
+func findMatchingLine(basket *Basket, line *BasketItem) *BasketItem {
+	for i := range basket.BasketItems {
+		existing := &basket.BasketItems[i]
+		if existing.MenuItemID != line.MenuItemID || len(existing.Modifiers) != len(line.Modifiers) {
+			continue
+		}
+		selected := make(map[uint]bool, len(existing.Modifiers))
+		for _, modifier := range existing.Modifiers {
+			selected[modifier.ModifierID] = true
+		}
+		matches := true
+		for _, modifier := range line.Modifiers {
+			if !selected[modifier.ModifierID] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return existing
+		}
+	}
+	return nil
+}
@@ -1,23 +1,76 @@
 package ordering
 
-import "gorm.io/gorm"
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"folo/tax"
+
+	"gorm.io/gorm"
+)
 
 // Basket represents a shopping basket
 type Basket struct {
 	gorm.Model
-	Description string       `gorm:"column:description;type:text" json:"description"`
+	Description string `gorm:"column:description;type:text" json:"description"`
+	// StoreID is the location the basket is ordered from. Baskets made before
+	// locations existed have none and are priced from the menu alone.
+	StoreID     uint         `gorm:"column:store_id;index" json:"storeId"`
 	BasketItems []BasketItem `json:"basketItems"`
 }
 
+// applyLocation prices the basket's menu items for its location. Menu item
+// overrides must be preloaded.
+func (b *Basket) applyLocation() {
+	for i := range b.BasketItems {
+		b.BasketItems[i].MenuItem.ApplyLocation(b.StoreID)
+	}
+}
+
+// checkOrderable returns ErrItemUnavailable naming the lines whose menu item
+// was 86'd or deleted after it went in the basket. A deleted item doesn't
+// preload, leaving the line a zero MenuItem priced at 0.
+func (b *Basket) checkOrderable() error {
+	var stale []string
+	for _, item := range b.BasketItems {
+		switch {
+		case item.MenuItem.ID == 0:
+			stale = append(stale, fmt.Sprintf("menu item %d", item.MenuItemID))
+		case !item.MenuItem.IsAvailable():
+			stale = append(stale, item.MenuItem.Name)
+		}
+	}
+	if len(stale) > 0 {
+		return fmt.Errorf("%w: %s", ErrItemUnavailable, strings.Join(stale, ", "))
+	}
+	return nil
+}
+
 // CalculateTotal calculates the total price of a basket
 func (b *Basket) CalculateTotal() int {
 	var total int = 0
 	for _, item := range b.BasketItems {
-		total += int(item.MenuItem.Price * item.Quantity)
+		total += item.UnitPrice() * item.Quantity
 	}
 	return total
 }
 
+// TaxLines returns a line to tax for each basket item, with its menu item's
+// tax category
+func (b *Basket) TaxLines() []tax.Line {
+	lines := make([]tax.Line, 0, len(b.BasketItems))
+	for _, item := range b.BasketItems {
+		lines = append(lines, tax.Line{
+			Name:     item.MenuItem.Name,
+			Category: item.MenuItem.TaxCategory,
+			Exempt:   item.MenuItem.TaxExempt,
+			Amount:   item.UnitPrice() * item.Quantity,
+		})
+	}
+	return lines
+}
+
 // BasketItem represents an item in a basket
 type BasketItem struct {
 	gorm.Model
@@ -25,12 +78,97 @@ type BasketItem struct {
 	MenuItemID uint `json:"-"`
 	MenuItem   MenuItem
 	Quantity   int
+	Modifiers  []BasketItemModifier `json:"modifiers"`
+}
+
+// UnitPrice returns the menu item price plus any selected modifier deltas
+func (bi *BasketItem) UnitPrice() int {
+	price := bi.MenuItem.Price
+	for _, modifier := range bi.Modifiers {
+		price += modifier.PriceDelta
+	}
+	return price
 }
 
-// MenuItem represents a menu item that can be added to a basket
-type MenuItem struct {
+// BasketItemModifier is a modifier selected for a basket line. Name and price are
+// copied from the menu so later menu edits don't change what the customer picked.
+type BasketItemModifier struct {
 	gorm.Model
-	SKU   int    `gorm:"column:sku;not null" json:"sku"`
-	Name  string `gorm:"column:name;not null" json:"name"`
-	Price int    `gorm:"column:price;not null" json:"price"` // Price in cents
+	BasketItemID uint   `gorm:"column:basket_item_id;not null" json:"-"`
+	ModifierID   uint   `gorm:"column:modifier_id" json:"modifierId"`
+	GroupName    string `gorm:"column:group_name" json:"groupName"`
+	Name         string `gorm:"column:name" json:"name"`
+	PriceDelta   int    `gorm:"column:price_delta" json:"priceDelta"`
+}
+
+// BasketItemReq represents the request body for adding an item to a basket.
+// Either MenuItemID or SKU identifies the menu item.
+type BasketItemReq struct {
+	MenuItemID  uint   `json:"menuItemId"`
+	SKU         int    `json:"sku"`
+	Quantity    int    `json:"quantity"`
+	ModifierIDs []uint `json:"modifierIds"`
+}
+
+// Validate checks the request for required fields
+func (r BasketItemReq) Validate() error {
+	if r.MenuItemID == 0 && r.SKU == 0 {
+		return errors.New("menuItemId or sku is required")
+	}
+	if r.Quantity <= 0 {
+		return errors.New("quantity must be positive")
+	}
+	return nil
+}
+
+// BasketItemQuantityReq represents the request body for changing a line quantity
+type BasketItemQuantityReq struct {
+	Quantity int `json:"quantity"`
+}
+
+// ErrItemUnavailable is returned when adding or ordering a menu item that has
+// been 86'd or taken off the menu
+var ErrItemUnavailable = errors.New("menu item is unavailable")
+
+// SelectModifiers validates the chosen modifier IDs against the item's modifier
+// groups and returns them as basket line modifiers
+func (m *MenuItem) SelectModifiers(modifierIDs []uint) ([]BasketItemModifier, error) {
+	selected := make(map[uint]bool, len(modifierIDs))
+	for _, id := range modifierIDs {
+		selected[id] = true
+	}
+
+	var result []BasketItemModifier
+	for _, group := range m.ModifierGroups {
+		count := 0
+		for _, modifier := range group.Modifiers {
+			if !selected[modifier.ID] {
+				continue
+			}
+			count++
+			delete(selected, modifier.ID)
+			result = append(result, BasketItemModifier{
+				ModifierID: modifier.ID,
+				GroupName:  group.Name,
+				Name:       modifier.Name,
+				PriceDelta: modifier.PriceDelta,
+			})
+		}
+
+		minSelect := group.MinSelect
+		if group.Required && minSelect == 0 {
+			minSelect = 1
+		}
+		if count < minSelect {
+			return nil, fmt.Errorf("%s requires at least %d selection(s)", group.Name, minSelect)
+		}
+		if group.MaxSelect > 0 && count > group.MaxSelect {
+			return nil, fmt.Errorf("%s allows at most %d selection(s)", group.Name, group.MaxSelect)
+		}
+	}
+
+	for id := range selected {
+		return nil, fmt.Errorf("modifier %d does not belong to %s", id, m.Name)
+	}
+	return result, nil
 }
@@ -0,0 +1,63 @@
+package ordering
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func pizzaMenuItem() *MenuItem {
+	return &MenuItem{
+		Name:  "Pizza",
+		Price: 1200,
+		ModifierGroups: []ModifierGroup{
+			{
+				Name:      "size",
+				Required:  true,
+				MaxSelect: 1,
+				Modifiers: []Modifier{
+					{Model: gorm.Model{ID: 1}, Name: "small"},
+					{Model: gorm.Model{ID: 2}, Name: "large", PriceDelta: 400},
+				},
+			},
+			{
+				Name: "toppings",
+				Modifiers: []Modifier{
+					{Model: gorm.Model{ID: 3}, Name: "extra cheese", PriceDelta: 150},
+				},
+			},
+		},
+	}
+}
+
+func TestSelectModifiers_Valid(t *testing.T) {
+	modifiers, err := pizzaMenuItem().SelectModifiers([]uint{2, 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	line := BasketItem{MenuItem: *pizzaMenuItem(), Quantity: 2, Modifiers: modifiers}
+	basket := Basket{BasketItems: []BasketItem{line}}
+	if total := basket.CalculateTotal(); total != (1200+400+150)*2 {
+		t.Errorf("expected total 3500, got %d", total)
+	}
+}
+
+func TestSelectModifiers_Rejects(t *testing.T) {
+	tests := []struct {
+		name        string
+		modifierIDs []uint
+	}{
+		{"missing required group", []uint{3}},
+		{"too many in group", []uint{1, 2}},
+		{"unknown modifier", []uint{1, 99}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := pizzaMenuItem().SelectModifiers(tt.modifierIDs); err == nil {
+				t.Errorf("expected error for modifiers %v", tt.modifierIDs)
+			}
+		})
+	}
+}
@@ -14,6 +14,10 @@ type BasketRepository interface {
 	FindAll(limit int) ([]Basket, error)
 	Update(basket *Basket) error
 	Delete(id uint) error
+	AddItem(item *BasketItem) error
+	FindItem(basketID, itemID uint) (*BasketItem, error)
+	UpdateItem(item *BasketItem) error
+	RemoveItem(item *BasketItem) error
 }
 
 type basketRepository struct {
@@ -42,10 +46,15 @@ func (r *basketRepository) FindByID(id uint) (*Basket, error) {
 	return &basket, nil
 }
 
-// FindByIDWithItems finds a basket by ID with all items and menu details preloaded
+// FindByIDWithItems finds a basket by ID with all items and menu details
+// preloaded, priced for the basket's location
 func (r *basketRepository) FindByIDWithItems(id uint) (*Basket, error) {
 	var basket Basket
-	err := r.db.Preload("BasketItems.MenuItem").First(&basket, id).Error
+	err := r.db.
+		Preload("BasketItems.MenuItem.Overrides").
+		Preload("BasketItems.Modifiers").
+		First(&basket, id).Error
+	basket.applyLocation()
 	return &basket, err
 }
 
@@ -54,9 +63,13 @@ func (r *basketRepository) FindAll(limit int) ([]Basket, error) {
 	ctx := context.Background()
 	baskets, err := gorm.G[Basket](r.db).
 		Preload("BasketItems", nil).
-		Preload("BasketItems.MenuItem", nil).
+		Preload("BasketItems.MenuItem.Overrides", nil).
+		Preload("BasketItems.Modifiers", nil).
 		Limit(limit).
 		Find(ctx)
+	for i := range baskets {
+		baskets[i].applyLocation()
+	}
 	return baskets, err
 }
 
@@ -69,3 +82,34 @@ func (r *basketRepository) Update(basket *Basket) error {
 func (r *basketRepository) Delete(id uint) error {
 	return r.db.Delete(&Basket{}, id).Error
 }
+
+// AddItem adds a line, with its selected modifiers, to a basket
+func (r *basketRepository) AddItem(item *BasketItem) error {
+	return r.db.Omit("MenuItem").Create(item).Error
+}
+
+// FindItem finds a basket line that belongs to the given basket
+func (r *basketRepository) FindItem(basketID, itemID uint) (*BasketItem, error) {
+	var item BasketItem
+	err := r.db.
+		Preload("MenuItem").
+		Preload("Modifiers").
+		Where("basket_id = ?", basketID).
+		First(&item, itemID).Error
+	return &item, err
+}
+
+// UpdateItem updates the quantity of a basket line
+func (r *basketRepository) UpdateItem(item *BasketItem) error {
+	return r.db.Model(item).Update("quantity", item.Quantity).Error
+}
+
+// RemoveItem soft deletes a basket line and its modifiers
+func (r *basketRepository) RemoveItem(item *BasketItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("basket_item_id = ?", item.ID).Delete(&BasketItemModifier{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(item).Error
+	})
+}
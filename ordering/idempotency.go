@@ -0,0 +1,56 @@
+package ordering
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make order
+// submission safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyTTL is how long a key and its response are kept for replay
+const IdempotencyTTL = 24 * time.Hour
+
+// IdempotencyRecord stores the response to a request made with an idempotency
+// key. StatusCode is zero while the original request is still in flight.
+type IdempotencyRecord struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Key          string    `gorm:"column:idempotency_key;not null;uniqueIndex" json:"key"`
+	RequestHash  string    `gorm:"column:request_hash;not null" json:"requestHash"`
+	StatusCode   int       `gorm:"column:status_code" json:"statusCode"`
+	ResponseBody []byte    `gorm:"column:response_body" json:"-"`
+	ExpiresAt    time.Time `gorm:"column:expires_at;not null;index" json:"expiresAt"`
+}
+
+// TableName names the table after the keys it holds rather than the record type
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// Completed reports whether the original request has finished and its
+// response can be replayed
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
+
+// Matches reports whether body is the same request the key was first used with
+func (r *IdempotencyRecord) Matches(body []byte) bool {
+	return r.RequestHash == hashRequest(body)
+}
+
+// NewIdempotencyRecord reserves key for a request with the given body
+func NewIdempotencyRecord(key string, body []byte, now time.Time) *IdempotencyRecord {
+	return &IdempotencyRecord{
+		Key:         key,
+		RequestHash: hashRequest(body),
+		ExpiresAt:   now.Add(IdempotencyTTL),
+	}
+}
+
+func hashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+package ordering
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IdempotencyRepository handles database operations for idempotency keys
+type IdempotencyRepository interface {
+	Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error)
+	Complete(record *IdempotencyRecord) error
+	Release(record *IdempotencyRecord) error
+	DeleteExpired(now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+// NewIdempotencyRepository creates a new idempotency key repository
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve stores record unless its key is already taken, in which case the
+// existing record is returned instead. Expired records don't count.
+func (r *idempotencyRepository) Reserve(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	var existing *IdempotencyRecord
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("idempotency_key = ? AND expires_at <= ?", record.Key, time.Now()).
+			Delete(&IdempotencyRecord{}).Error; err != nil {
+			return err
+		}
+
+		var found IdempotencyRecord
+		err := tx.Where("idempotency_key = ?", record.Key).First(&found).Error
+		if err == nil {
+			existing = &found
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		return tx.Create(record).Error
+	})
+	if err != nil {
+		// A concurrent request may have taken the key between the lookup and
+		// the insert; the unique index rejects ours, so return theirs
+		var found IdempotencyRecord
+		if r.db.Where("idempotency_key = ?", record.Key).First(&found).Error == nil {
+			return &found, nil
+		}
+	}
+	return existing, err
+}
+
+// Complete stores the response for a reserved key
+func (r *idempotencyRepository) Complete(record *IdempotencyRecord) error {
+	return r.db.Model(record).Updates(map[string]any{
+		"status_code":   record.StatusCode,
+		"response_body": record.ResponseBody,
+	}).Error
+}
+
+// Release frees a reserved key so the request can be retried
+func (r *idempotencyRepository) Release(record *IdempotencyRecord) error {
+	return r.db.Delete(record).Error
+}
+
+// DeleteExpired removes keys whose replay window has passed
+func (r *idempotencyRepository) DeleteExpired(now time.Time) (int64, error) {
+	result := r.db.Where("expires_at <= ?", now).Delete(&IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,109 @@
+package ordering
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"folo/delivery"
+	"folo/payment"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func submitOrder(t *testing.T, app *fiber.App, key, body string) (int, string, http.Header) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/orders/submit", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(respBody), resp.Header
+}
+
+func TestCreateOrder_IdempotencyKeyReplaysResponse(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	app := fiber.New()
+	RegisterOrderRoutes(app, NewOrderHandler(service, NewIdempotencyRepository(db)))
+
+	body := fmt.Sprintf(`{"basketId": %d, "paymentType": "Cash"}`, basket.ID)
+	status, first, _ := submitOrder(t, app, "checkout-1", body)
+	if status != fiber.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, first)
+	}
+
+	status, replay, header := submitOrder(t, app, "checkout-1", body)
+	if status != fiber.StatusOK || replay != first {
+		t.Errorf("expected the original response to be replayed, got %d: %s", status, replay)
+	}
+	if header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected replayed response to be marked")
+	}
+
+	var orders int64
+	db.Model(&Order{}).Count(&orders)
+	if orders != 1 {
+		t.Errorf("expected a single order, got %d", orders)
+	}
+
+	status, _, _ = submitOrder(t, app, "checkout-1", fmt.Sprintf(`{"basketId": %d, "paymentType": "Cash", "tip": 100}`, basket.ID))
+	if status != fiber.StatusConflict {
+		t.Errorf("expected 409 for a different body, got %d", status)
+	}
+}
+
+func TestIdempotencyRepository_ExpiredKeyCanBeReused(t *testing.T) {
+	repo := NewIdempotencyRepository(newTestDB(t))
+
+	old := NewIdempotencyRecord("checkout-2", []byte("a"), time.Now().Add(-2*IdempotencyTTL))
+	if existing, err := repo.Reserve(old); err != nil || existing != nil {
+		t.Fatalf("unexpected reserve result %+v, %v", existing, err)
+	}
+
+	fresh := NewIdempotencyRecord("checkout-2", []byte("b"), time.Now())
+	existing, err := repo.Reserve(fresh)
+	if err != nil {
+		t.Fatalf("unexpected error reserving key: %v", err)
+	}
+	if existing != nil {
+		t.Errorf("expected the expired key to be released, got %+v", existing)
+	}
+}
+
+func TestCreateOrder_IdempotencyKeyReleasedWhenQuoteFails(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quoteErr: errors.New("provider unavailable")}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	app := fiber.New()
+	RegisterOrderRoutes(app, NewOrderHandler(service, NewIdempotencyRepository(db)))
+
+	body := fmt.Sprintf(`{"basketId": %d, "paymentType": "Credit", "paymentData": {"cardNumber": "4242424242424242"},
+		"deliveryData": {"address": "345 Spear St", "phoneNumber": "+18773934448"}}`, basket.ID)
+	if status, resp, _ := submitOrder(t, app, "checkout-3", body); status != fiber.StatusBadGateway {
+		t.Fatalf("expected 502 for a failed quote, got %d: %s", status, resp)
+	}
+
+	// The provider recovers, and the retry with the same key is processed
+	deliveryService.quoteErr = nil
+	deliveryService.quote = &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-3", Fee: 500}
+	status, resp, header := submitOrder(t, app, "checkout-3", body)
+	if status != fiber.StatusOK || header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected the retry to be processed, got %d: %s", status, resp)
+	}
+}
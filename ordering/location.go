@@ -0,0 +1,36 @@
+package ordering
+
+import (
+	"errors"
+	"strconv"
+
+	"folo/store"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// errInvalidLocationID is returned for a :locationId route parameter that isn't a number
+var errInvalidLocationID = errors.New("invalid location ID")
+
+// findLocation returns the location named by the :locationId route parameter
+func findLocation(c fiber.Ctx, stores *store.Service) (*store.Store, error) {
+	id, err := strconv.Atoi(c.Params("locationId"))
+	if err != nil || id <= 0 {
+		return nil, errInvalidLocationID
+	}
+	return stores.Find(uint(id))
+}
+
+// locationError responds to a location that couldn't be found
+func locationError(c fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidLocationID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+		"success": false,
+		"error":   "location not found",
+	})
+}
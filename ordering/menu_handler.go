@@ -0,0 +1,392 @@
+package ordering
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"folo/store"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type MenuHandler struct {
+	menuRepo MenuRepository
+	stores   *store.Service
+}
+
+func NewMenuHandler(menuRepo MenuRepository, stores *store.Service) *MenuHandler {
+	return &MenuHandler{
+		menuRepo: menuRepo,
+		stores:   stores,
+	}
+}
+
+func RegisterMenuRoutes(router fiber.Router, handler *MenuHandler) {
+	menu := router.Group("/menu")
+
+	menu.Get("/", handler.GetMenu)
+	menu.Get("/categories", handler.GetCategories)
+	menu.Post("/categories", handler.CreateCategory)
+	menu.Get("/:sku", handler.GetMenuItem)
+	menu.Post("/", handler.CreateMenuItem)
+	menu.Put("/:sku", handler.UpdateMenuItem)
+	menu.Delete("/:sku", handler.DeleteMenuItem)
+
+	locationMenu := router.Group("/locations/:locationId/menu")
+	locationMenu.Get("/", handler.GetMenu)
+	locationMenu.Put("/:sku", handler.SetLocationOverride)
+	locationMenu.Delete("/:sku", handler.DeleteLocationOverride)
+}
+
+// GetMenu lists menu items, optionally filtered by ?category=<id> and ?available=true.
+// Under /locations/:locationId the menu is priced for that location.
+func (h *MenuHandler) GetMenu(c fiber.Ctx) error {
+	filter := MenuFilter{
+		AvailableOnly: c.Query("available") == "true",
+	}
+	if c.Params("locationId") != "" {
+		profile, err := findLocation(c, h.stores)
+		if err != nil {
+			return locationError(c, err)
+		}
+		filter.StoreID = &profile.ID
+	}
+	if categoryParam := c.Query("category"); categoryParam != "" {
+		categoryID, err := strconv.Atoi(categoryParam)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"error":   "invalid category ID",
+			})
+		}
+		id := uint(categoryID)
+		filter.CategoryID = &id
+	}
+
+	items, err := h.menuRepo.FindAll(filter)
+	if err != nil {
+		log.Printf("error retrieving menu: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve menu",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    items,
+	})
+}
+
+// GetMenuItem returns a single menu item by SKU
+func (h *MenuHandler) GetMenuItem(c fiber.Ctx) error {
+	sku, err := strconv.Atoi(c.Params("sku"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid SKU",
+		})
+	}
+
+	item, err := h.menuRepo.FindBySKU(sku)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "menu item not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+func (h *MenuHandler) CreateMenuItem(c fiber.Ctx) error {
+	req := new(MenuItemReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	if _, err := h.menuRepo.FindBySKU(req.SKU); err == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"error":   "SKU already exists",
+		})
+	}
+
+	item := new(MenuItem)
+	req.Apply(item)
+	if err := h.menuRepo.Create(item); err != nil {
+		log.Printf("error creating menu item: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create menu item",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+func (h *MenuHandler) UpdateMenuItem(c fiber.Ctx) error {
+	sku, err := strconv.Atoi(c.Params("sku"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid SKU",
+		})
+	}
+
+	item, err := h.menuRepo.FindBySKU(sku)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "menu item not found",
+		})
+	}
+
+	req := new(MenuItemReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if req.SKU == 0 {
+		req.SKU = sku
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+	if req.SKU != sku {
+		if _, err := h.menuRepo.FindBySKU(req.SKU); err == nil {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "SKU already exists",
+			})
+		}
+	}
+
+	req.Apply(item)
+	item.Category = nil
+	if err := h.menuRepo.Update(item); err != nil {
+		log.Printf("error updating menu item %d: %s", sku, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update menu item",
+		})
+	}
+
+	updated, err := h.menuRepo.FindByID(item.ID)
+	if err != nil {
+		updated = item
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+func (h *MenuHandler) DeleteMenuItem(c fiber.Ctx) error {
+	sku, err := strconv.Atoi(c.Params("sku"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid SKU",
+		})
+	}
+
+	item, err := h.menuRepo.FindBySKU(sku)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "menu item not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to delete menu item",
+		})
+	}
+
+	if err := h.menuRepo.Delete(item.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to delete menu item",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "Menu item deleted successfully",
+		"sku":     sku,
+	})
+}
+
+// SetLocationOverride sets a location's own price or availability for a menu item
+func (h *MenuHandler) SetLocationOverride(c fiber.Ctx) error {
+	profile, err := findLocation(c, h.stores)
+	if err != nil {
+		return locationError(c, err)
+	}
+	sku, err := strconv.Atoi(c.Params("sku"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid SKU",
+		})
+	}
+
+	req := new(MenuItemOverrideReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if err := req.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	item, err := h.menuRepo.FindBySKU(sku)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "menu item not found",
+		})
+	}
+
+	override := &MenuItemOverride{
+		MenuItemID: item.ID,
+		StoreID:    profile.ID,
+		Price:      req.Price,
+		Available:  req.Available,
+	}
+	if err := h.menuRepo.SetOverride(override); err != nil {
+		log.Printf("error setting override for menu item %d at location %d: %s", sku, profile.ID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update menu item",
+		})
+	}
+
+	return h.locationMenuItem(c, item.ID, profile.ID)
+}
+
+// DeleteLocationOverride returns a menu item at a location to the menu's price and availability
+func (h *MenuHandler) DeleteLocationOverride(c fiber.Ctx) error {
+	profile, err := findLocation(c, h.stores)
+	if err != nil {
+		return locationError(c, err)
+	}
+	sku, err := strconv.Atoi(c.Params("sku"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid SKU",
+		})
+	}
+
+	item, err := h.menuRepo.FindBySKU(sku)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "menu item not found",
+		})
+	}
+
+	if err := h.menuRepo.DeleteOverride(item.ID, profile.ID); err != nil {
+		log.Printf("error removing override for menu item %d at location %d: %s", sku, profile.ID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update menu item",
+		})
+	}
+
+	return h.locationMenuItem(c, item.ID, profile.ID)
+}
+
+// locationMenuItem reloads a menu item and responds with it as priced at the location
+func (h *MenuHandler) locationMenuItem(c fiber.Ctx, itemID, storeID uint) error {
+	item, err := h.menuRepo.FindByID(itemID)
+	if err != nil {
+		log.Printf("error reloading menu item %d: %s", itemID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve menu item",
+		})
+	}
+	item.ApplyLocation(storeID)
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    item,
+	})
+}
+
+func (h *MenuHandler) GetCategories(c fiber.Ctx) error {
+	categories, err := h.menuRepo.FindAllCategories()
+	if err != nil {
+		log.Printf("error retrieving menu categories: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve categories",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    categories,
+	})
+}
+
+func (h *MenuHandler) CreateCategory(c fiber.Ctx) error {
+	category := new(MenuCategory)
+	if err := c.Bind().Body(category); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "Invalid request body",
+		})
+	}
+	if strings.TrimSpace(category.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "name is required",
+		})
+	}
+
+	if err := h.menuRepo.CreateCategory(category); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "Failed to create category",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    category,
+	})
+}
@@ -0,0 +1,157 @@
+package ordering
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MenuCategory groups menu items for display (e.g. "Drinks", "Mains")
+type MenuCategory struct {
+	gorm.Model
+	Name      string `gorm:"column:name;not null" json:"name"`
+	SortOrder int    `gorm:"column:sort_order" json:"sortOrder"`
+}
+
+// MenuItem represents a menu item that can be added to a basket
+type MenuItem struct {
+	gorm.Model
+	SKU            int             `gorm:"column:sku;not null" json:"sku"`
+	Name           string          `gorm:"column:name;not null" json:"name"`
+	Description    string          `gorm:"column:description;type:text" json:"description"`
+	Price          int             `gorm:"column:price;not null" json:"price"` // Price in cents
+	CategoryID     *uint           `gorm:"column:category_id" json:"categoryId"`
+	Category       *MenuCategory   `json:"category,omitempty"`
+	Available      *bool           `gorm:"column:available;not null;default:true" json:"available"` // false when the item is 86'd
+	PrepMinutes    int             `gorm:"column:prep_minutes" json:"prepMinutes"`                  // 0 uses the location's prep time
+	TaxCategory    string          `gorm:"column:tax_category" json:"taxCategory,omitempty"`        // picks a location's tax rule, e.g. "packaged_beverage"
+	TaxExempt      bool            `gorm:"column:tax_exempt" json:"taxExempt"`
+	ModifierGroups []ModifierGroup `json:"modifierGroups"`
+	// Overrides change the price or availability at particular locations
+	Overrides []MenuItemOverride `json:"overrides,omitempty"`
+}
+
+// IsAvailable reports whether the item can currently be ordered
+func (m *MenuItem) IsAvailable() bool {
+	return m.Available == nil || *m.Available
+}
+
+// ApplyLocation replaces the price and availability with the location's
+// override, if it has one. Overrides must be preloaded.
+func (m *MenuItem) ApplyLocation(storeID uint) {
+	for _, o := range m.Overrides {
+		if o.StoreID != storeID {
+			continue
+		}
+		if o.Price != nil {
+			m.Price = *o.Price
+		}
+		if o.Available != nil {
+			m.Available = o.Available
+		}
+		return
+	}
+}
+
+// MenuItemOverride is a location's own price or availability for a menu item.
+// Nil fields keep the menu's value.
+type MenuItemOverride struct {
+	ID         uint  `gorm:"primarykey" json:"-"`
+	MenuItemID uint  `gorm:"column:menu_item_id;not null;uniqueIndex:idx_menu_item_store" json:"-"`
+	StoreID    uint  `gorm:"column:store_id;not null;uniqueIndex:idx_menu_item_store" json:"storeId"`
+	Price      *int  `gorm:"column:price" json:"price,omitempty"` // Price in cents
+	Available  *bool `gorm:"column:available" json:"available,omitempty"`
+}
+
+// MenuItemOverrideReq represents the request body for setting a location's override
+type MenuItemOverrideReq struct {
+	Price     *int  `json:"price"`
+	Available *bool `json:"available"`
+}
+
+// Validate checks the request overrides something
+func (r MenuItemOverrideReq) Validate() error {
+	if r.Price == nil && r.Available == nil {
+		return errors.New("price or available is required")
+	}
+	if r.Price != nil && *r.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	return nil
+}
+
+// ModifierGroup is a set of options for a menu item, e.g. "size" or "extra cheese"
+type ModifierGroup struct {
+	gorm.Model
+	MenuItemID uint       `gorm:"column:menu_item_id;not null" json:"-"`
+	Name       string     `gorm:"column:name;not null" json:"name"`
+	Required   bool       `gorm:"column:required" json:"required"`
+	MinSelect  int        `gorm:"column:min_select" json:"minSelect"`
+	MaxSelect  int        `gorm:"column:max_select" json:"maxSelect"` // 0 means no limit
+	Modifiers  []Modifier `json:"modifiers"`
+}
+
+// Modifier is a single option within a modifier group
+type Modifier struct {
+	gorm.Model
+	ModifierGroupID uint   `gorm:"column:modifier_group_id;not null" json:"-"`
+	Name            string `gorm:"column:name;not null" json:"name"`
+	PriceDelta      int    `gorm:"column:price_delta" json:"priceDelta"` // Price change in cents
+}
+
+// MenuItemReq represents the request body for creating or updating a menu item
+type MenuItemReq struct {
+	SKU            int             `json:"sku"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	Price          int             `json:"price"`
+	CategoryID     *uint           `json:"categoryId"`
+	Available      *bool           `json:"available"`
+	PrepMinutes    int             `json:"prepMinutes"`
+	TaxCategory    string          `json:"taxCategory"`
+	TaxExempt      bool            `json:"taxExempt"`
+	ModifierGroups []ModifierGroup `json:"modifierGroups"`
+}
+
+// Validate checks the request for required fields
+func (r MenuItemReq) Validate() error {
+	if r.SKU <= 0 {
+		return errors.New("sku must be positive")
+	}
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	if r.PrepMinutes < 0 {
+		return errors.New("prepMinutes cannot be negative")
+	}
+	for _, group := range r.ModifierGroups {
+		if strings.TrimSpace(group.Name) == "" {
+			return errors.New("modifier group name is required")
+		}
+		if group.MaxSelect > 0 && group.MinSelect > group.MaxSelect {
+			return fmt.Errorf("modifier group %q has minSelect greater than maxSelect", group.Name)
+		}
+	}
+	return nil
+}
+
+// Apply copies the request fields onto a menu item
+func (r MenuItemReq) Apply(item *MenuItem) {
+	item.SKU = r.SKU
+	item.Name = r.Name
+	item.Description = r.Description
+	item.Price = r.Price
+	item.CategoryID = r.CategoryID
+	item.PrepMinutes = r.PrepMinutes
+	item.TaxCategory = r.TaxCategory
+	item.TaxExempt = r.TaxExempt
+	if r.Available != nil {
+		item.Available = r.Available
+	}
+	item.ModifierGroups = r.ModifierGroups
+}
@@ -0,0 +1,159 @@
+package ordering
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MenuFilter narrows the menu items returned by FindAll
+type MenuFilter struct {
+	CategoryID    *uint
+	AvailableOnly bool
+	// StoreID prices the menu for a location, applying its overrides
+	StoreID *uint
+}
+
+// MenuRepository handles database operations for menu items and categories
+type MenuRepository interface {
+	Create(item *MenuItem) error
+	FindByID(id uint) (*MenuItem, error)
+	FindBySKU(sku int) (*MenuItem, error)
+	FindAll(filter MenuFilter) ([]MenuItem, error)
+	Update(item *MenuItem) error
+	Delete(id uint) error
+	CreateCategory(category *MenuCategory) error
+	FindAllCategories() ([]MenuCategory, error)
+	SetOverride(override *MenuItemOverride) error
+	DeleteOverride(menuItemID, storeID uint) error
+}
+
+type menuRepository struct {
+	db *gorm.DB
+}
+
+// NewMenuRepository creates a new menu repository
+func NewMenuRepository(db *gorm.DB) MenuRepository {
+	return &menuRepository{db: db}
+}
+
+// Create creates a menu item along with its modifier groups
+func (r *menuRepository) Create(item *MenuItem) error {
+	return r.db.Create(item).Error
+}
+
+// FindByID finds a menu item by ID with category and modifiers preloaded
+func (r *menuRepository) FindByID(id uint) (*MenuItem, error) {
+	var item MenuItem
+	err := r.preloaded().First(&item, id).Error
+	return &item, err
+}
+
+// FindBySKU finds a menu item by SKU with category and modifiers preloaded
+func (r *menuRepository) FindBySKU(sku int) (*MenuItem, error) {
+	var item MenuItem
+	err := r.preloaded().Where("sku = ?", sku).First(&item).Error
+	return &item, err
+}
+
+// FindAll returns menu items matching the filter, ordered by SKU
+func (r *menuRepository) FindAll(filter MenuFilter) ([]MenuItem, error) {
+	var items []MenuItem
+	query := r.preloaded()
+	if filter.CategoryID != nil {
+		query = query.Where("category_id = ?", *filter.CategoryID)
+	}
+	if filter.AvailableOnly && filter.StoreID == nil {
+		query = query.Where("available = ?", true)
+	}
+	if err := query.Order("sku").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if filter.StoreID == nil {
+		return items, nil
+	}
+
+	// A location can bring back an item the menu has 86'd, so availability
+	// is only known once its overrides are applied
+	priced := items[:0]
+	for _, item := range items {
+		item.ApplyLocation(*filter.StoreID)
+		if filter.AvailableOnly && !item.IsAvailable() {
+			continue
+		}
+		priced = append(priced, item)
+	}
+	return priced, nil
+}
+
+// Update saves the menu item and replaces its modifier groups
+func (r *menuRepository) Update(item *MenuItem) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("ModifierGroups", "Category", "Overrides").Save(item).Error; err != nil {
+			return err
+		}
+
+		// Replace modifier groups wholesale so removed options disappear
+		var groupIDs []uint
+		if err := tx.Model(&ModifierGroup{}).Where("menu_item_id = ?", item.ID).Pluck("id", &groupIDs).Error; err != nil {
+			return err
+		}
+		if len(groupIDs) > 0 {
+			if err := tx.Where("modifier_group_id IN ?", groupIDs).Delete(&Modifier{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", groupIDs).Delete(&ModifierGroup{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(item.ModifierGroups) == 0 {
+			return nil
+		}
+		for i := range item.ModifierGroups {
+			group := &item.ModifierGroups[i]
+			group.ID = 0
+			group.MenuItemID = item.ID
+			for j := range group.Modifiers {
+				group.Modifiers[j].ID = 0
+			}
+		}
+		return tx.Create(&item.ModifierGroups).Error
+	})
+}
+
+// Delete soft deletes a menu item
+func (r *menuRepository) Delete(id uint) error {
+	return r.db.Delete(&MenuItem{}, id).Error
+}
+
+// CreateCategory creates a new menu category
+func (r *menuRepository) CreateCategory(category *MenuCategory) error {
+	return r.db.Create(category).Error
+}
+
+// FindAllCategories returns all menu categories in display order
+func (r *menuRepository) FindAllCategories() ([]MenuCategory, error) {
+	var categories []MenuCategory
+	err := r.db.Order("sort_order, name").Find(&categories).Error
+	return categories, err
+}
+
+// SetOverride creates or replaces a location's override for a menu item
+func (r *menuRepository) SetOverride(override *MenuItemOverride) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "menu_item_id"}, {Name: "store_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "available"}),
+	}).Create(override).Error
+}
+
+// DeleteOverride removes a location's override so the menu's values apply
+func (r *menuRepository) DeleteOverride(menuItemID, storeID uint) error {
+	return r.db.Where("menu_item_id = ? AND store_id = ?", menuItemID, storeID).Delete(&MenuItemOverride{}).Error
+}
+
+func (r *menuRepository) preloaded() *gorm.DB {
+	return r.db.
+		Preload("Category").
+		Preload("ModifierGroups.Modifiers").
+		Preload("Overrides")
+}
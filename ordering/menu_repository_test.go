@@ -0,0 +1,120 @@
+package ordering
+
+import (
+	"testing"
+)
+
+func TestMenuRepository_CreateDefaultsToAvailable(t *testing.T) {
+	repo := NewMenuRepository(newTestDB(t))
+
+	if err := repo.Create(&MenuItem{SKU: 100, Name: "Hot Dog", Price: 150}); err != nil {
+		t.Fatalf("unexpected error creating item: %v", err)
+	}
+
+	item, err := repo.FindBySKU(100)
+	if err != nil {
+		t.Fatalf("unexpected error finding item: %v", err)
+	}
+	if !item.IsAvailable() {
+		t.Errorf("expected new item to be available")
+	}
+
+	items, err := repo.FindAll(MenuFilter{AvailableOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error listing items: %v", err)
+	}
+	if len(items) != 1 {
+		t.Errorf("expected 1 available item, got %d", len(items))
+	}
+}
+
+func TestMenuRepository_UpdateReplacesModifierGroups(t *testing.T) {
+	repo := NewMenuRepository(newTestDB(t))
+
+	item := &MenuItem{
+		SKU:   200,
+		Name:  "Pizza",
+		Price: 1200,
+		ModifierGroups: []ModifierGroup{
+			{Name: "size", Modifiers: []Modifier{{Name: "small"}, {Name: "large", PriceDelta: 400}}},
+			{Name: "extra cheese", Modifiers: []Modifier{{Name: "extra cheese", PriceDelta: 150}}},
+		},
+	}
+	if err := repo.Create(item); err != nil {
+		t.Fatalf("unexpected error creating item: %v", err)
+	}
+
+	unavailable := false
+	item.Available = &unavailable
+	item.ModifierGroups = []ModifierGroup{
+		{Name: "crust", Modifiers: []Modifier{{Name: "thin"}}},
+	}
+	if err := repo.Update(item); err != nil {
+		t.Fatalf("unexpected error updating item: %v", err)
+	}
+
+	updated, err := repo.FindByID(item.ID)
+	if err != nil {
+		t.Fatalf("unexpected error finding item: %v", err)
+	}
+	if updated.IsAvailable() {
+		t.Errorf("expected item to be 86'd after update")
+	}
+	if len(updated.ModifierGroups) != 1 || updated.ModifierGroups[0].Name != "crust" {
+		t.Fatalf("expected modifier groups to be replaced, got %+v", updated.ModifierGroups)
+	}
+	if len(updated.ModifierGroups[0].Modifiers) != 1 {
+		t.Errorf("expected 1 modifier, got %d", len(updated.ModifierGroups[0].Modifiers))
+	}
+}
+
+func TestMenuRepository_FindAllAppliesLocationOverrides(t *testing.T) {
+	repo := NewMenuRepository(newTestDB(t))
+	unavailable := false
+	if err := repo.Create(&MenuItem{SKU: 300, Name: "Burrito", Price: 900}); err != nil {
+		t.Fatalf("unexpected error creating item: %v", err)
+	}
+	if err := repo.Create(&MenuItem{SKU: 301, Name: "Horchata", Price: 400, Available: &unavailable}); err != nil {
+		t.Fatalf("unexpected error creating item: %v", err)
+	}
+	burrito, _ := repo.FindBySKU(300)
+	horchata, _ := repo.FindBySKU(301)
+
+	price, available := 1050, true
+	if err := repo.SetOverride(&MenuItemOverride{MenuItemID: burrito.ID, StoreID: 2, Price: &price}); err != nil {
+		t.Fatalf("unexpected error setting override: %v", err)
+	}
+	if err := repo.SetOverride(&MenuItemOverride{MenuItemID: horchata.ID, StoreID: 2, Available: &available}); err != nil {
+		t.Fatalf("unexpected error setting override: %v", err)
+	}
+	// Setting an override again replaces it
+	price = 1100
+	if err := repo.SetOverride(&MenuItemOverride{MenuItemID: burrito.ID, StoreID: 2, Price: &price}); err != nil {
+		t.Fatalf("unexpected error replacing override: %v", err)
+	}
+
+	storeID := uint(2)
+	items, err := repo.FindAll(MenuFilter{AvailableOnly: true, StoreID: &storeID})
+	if err != nil {
+		t.Fatalf("unexpected error listing items: %v", err)
+	}
+	if len(items) != 2 || items[0].Price != 1100 || items[1].Name != "Horchata" {
+		t.Fatalf("expected the burrito at 1100 and the horchata back on, got %+v", items)
+	}
+
+	items, err = repo.FindAll(MenuFilter{AvailableOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error listing items: %v", err)
+	}
+	if len(items) != 1 || items[0].Price != 900 {
+		t.Errorf("expected only the burrito at the menu price elsewhere, got %+v", items)
+	}
+
+	if err := repo.DeleteOverride(burrito.ID, 2); err != nil {
+		t.Fatalf("unexpected error deleting override: %v", err)
+	}
+	items, _ = repo.FindAll(MenuFilter{StoreID: &storeID})
+	if items[0].Price != 900 {
+		t.Errorf("expected the menu price once the override is removed, got %d", items[0].Price)
+	}
+}
@@ -1,25 +1,107 @@
 package ordering
 
 import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"folo/delivery"
+	"folo/store"
+
 	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
 )
 
 type OrderHandler struct {
-	orderService OrderService
+	orderService    OrderService
+	idempotencyRepo IdempotencyRepository
 }
 
-func NewOrderHandler(orderService OrderService) *OrderHandler {
+func NewOrderHandler(orderService OrderService, idempotencyRepo IdempotencyRepository) *OrderHandler {
 	return &OrderHandler{
-		orderService: orderService,
+		orderService:    orderService,
+		idempotencyRepo: idempotencyRepo,
 	}
 }
 
 func RegisterOrderRoutes(router fiber.Router, handler *OrderHandler) {
 	orders := router.Group("/orders")
+	orders.Get("/", handler.ListOrders)
+	orders.Get("/:id", handler.GetOrder)
+	orders.Get("/:id/receipt", handler.GetReceipt)
 	orders.Post("/submit", handler.CreateOrder)
+	orders.Post("/:id/cancel", handler.CancelOrder)
+	orders.Post("/:id/status", handler.UpdateOrderStatus)
+	orders.Post("/:id/capture", handler.CaptureOrderPayment)
+	orders.Post("/:id/payment/confirm", handler.ConfirmCryptoPayment)
+	orders.Post("/:id/dispatch", handler.DispatchOrder)
+
+	router.Get("/locations/:locationId/orders", handler.ListOrders)
 }
 
+// CreateOrder submits an order. Requests carrying an Idempotency-Key header are
+// processed once: repeats within 24 hours get the original response back, and
+// reusing the key with a different body is rejected with 409.
 func (h *OrderHandler) CreateOrder(c fiber.Ctx) error {
+	key := c.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return h.createOrder(c)
+	}
+
+	record := NewIdempotencyRecord(key, c.Body(), time.Now())
+	existing, err := h.idempotencyRepo.Reserve(record)
+	if err != nil {
+		log.Printf("error reserving idempotency key: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to create order",
+		})
+	}
+	if existing != nil {
+		if !existing.Matches(c.Body()) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "idempotency key was already used with a different request",
+			})
+		}
+		if !existing.Completed() {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": "a request with this idempotency key is still being processed",
+			})
+		}
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Status(existing.StatusCode).Send(existing.ResponseBody)
+	}
+
+	if err := h.createOrder(c); err != nil {
+		h.releaseIdempotencyKey(record)
+		return err
+	}
+
+	// A 500 rolled everything back, and a failed quote only kept a FAILED
+	// order that was never charged, so neither can double charge: let the
+	// client retry with the same key rather than replaying the failure.
+	// Every other response is stored once the order is committed.
+	record.StatusCode = c.Response().StatusCode()
+	if record.StatusCode == fiber.StatusInternalServerError || record.StatusCode == fiber.StatusBadGateway {
+		h.releaseIdempotencyKey(record)
+		return nil
+	}
+	record.ResponseBody = append([]byte(nil), c.Response().Body()...)
+	if err := h.idempotencyRepo.Complete(record); err != nil {
+		log.Printf("error storing response for idempotency key %s: %s", key, err.Error())
+	}
+	return nil
+}
+
+func (h *OrderHandler) releaseIdempotencyKey(record *IdempotencyRecord) {
+	if err := h.idempotencyRepo.Release(record); err != nil {
+		log.Printf("error releasing idempotency key %s: %s", record.Key, err.Error())
+	}
+}
+
+func (h *OrderHandler) createOrder(c fiber.Ctx) error {
 	or := new(OrderReq)
 	if err := c.Bind().Body(or); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -30,22 +112,510 @@ func (h *OrderHandler) CreateOrder(c fiber.Ctx) error {
 	order, err := h.orderService.CreateOrder(*or)
 	if err != nil {
 		// Check specific error types
-		if err.Error() == "record not found" {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "basket not found",
 			})
 		}
+		if errors.Is(err, store.ErrClosed) || errors.Is(err, store.ErrPaused) || errors.Is(err, ErrItemUnavailable) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, ErrInvalidOrderRequest) || errors.Is(err, ErrUnsupportedPaymentType) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if isUndeliverable(err) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if errors.Is(err, ErrDeliveryQuoteFailed) {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"error":    "could not get a delivery quote",
+				"order_id": order.ID,
+				"status":   order.OrderStatus,
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to create order",
 			"order": order,
 		})
 	}
 
-	return c.JSON(fiber.Map{
-		"message":     "order created successfully",
-		"order_id":    order.ID,
-		"total":       order.Subtotal,
-		"is_delivery": order.IsDelivery,
-		"status":      order.OrderStatus,
+	response := fiber.Map{
+		"message":      "order created successfully",
+		"order_id":     order.ID,
+		"total":        order.Total,
+		"is_delivery":  order.IsDelivery,
+		"status":       order.OrderStatus,
+		"payment_type": order.PaymentType,
+		"ready_at":     order.ReadyAt,
+	}
+	if order.ScheduledFor != nil {
+		response["scheduled_for"] = order.ScheduledFor
+	}
+	for _, p := range order.Payments {
+		if p.PaymentRequest != "" {
+			response["payment_request"] = p.PaymentRequest
+		}
+	}
+	return c.JSON(response)
+}
+
+// GetOrder returns a single order with its basket items and delivery data
+func (h *OrderHandler) GetOrder(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	order, err := h.orderService.GetOrder(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		}
+		log.Printf("error retrieving order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve order",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    order,
+	})
+}
+
+// GetReceipt returns the customer's receipt for an order
+func (h *OrderHandler) GetReceipt(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	receipt, err := h.orderService.GetReceipt(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		}
+		log.Printf("error building receipt for order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve receipt",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    receipt,
+	})
+}
+
+// ListOrders returns a page of orders. Supported query parameters:
+// status (comma separated), is_delivery, created_from and created_to (RFC 3339),
+// sort (created_at or subtotal, prefix with "-" for descending), cursor and limit.
+// Under /locations/:locationId only that location's orders are listed.
+func (h *OrderHandler) ListOrders(c fiber.Ctx) error {
+	filter, err := parseOrderListFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
+	orders, next, err := h.orderService.ListOrders(*filter)
+	if err != nil {
+		log.Printf("error listing orders: %s", err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to retrieve orders",
+		})
+	}
+
+	response := fiber.Map{
+		"success": true,
+		"data":    orders,
+	}
+	if next != nil {
+		response["nextCursor"] = next.Encode()
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// isUndeliverable reports whether err means we can't deliver to the dropoff
+// as entered, which the customer has to fix
+func isUndeliverable(err error) bool {
+	return errors.Is(err, delivery.ErrOutsideDeliveryZone) || errors.Is(err, delivery.ErrBelowZoneMinimum) ||
+		errors.Is(err, delivery.ErrDropoffLocationRequired) || errors.Is(err, delivery.ErrAddressNotFound) ||
+		errors.Is(err, delivery.ErrAmbiguousAddress)
+}
+
+func parseOrderListFilter(c fiber.Ctx) (*OrderListFilter, error) {
+	filter := new(OrderListFilter)
+
+	if location := c.Params("locationId"); location != "" {
+		id, err := strconv.ParseUint(location, 10, 0)
+		if err != nil {
+			return nil, errInvalidLocationID
+		}
+		storeID := uint(id)
+		filter.StoreID = &storeID
+	}
+
+	if status := c.Query("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			filter.Statuses = append(filter.Statuses, OrderStatus(strings.ToUpper(strings.TrimSpace(s))))
+		}
+	}
+
+	if isDelivery := c.Query("is_delivery"); isDelivery != "" {
+		v, err := strconv.ParseBool(isDelivery)
+		if err != nil {
+			return nil, errors.New("is_delivery must be true or false")
+		}
+		filter.IsDelivery = &v
+	}
+
+	if from := c.Query("created_from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, errors.New("created_from must be an RFC 3339 timestamp")
+		}
+		filter.CreatedFrom = &t
+	}
+	if to := c.Query("created_to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, errors.New("created_to must be an RFC 3339 timestamp")
+		}
+		filter.CreatedTo = &t
+	}
+
+	sortBy, descending, err := ParseOrderSort(c.Query("sort"))
+	if err != nil {
+		return nil, err
+	}
+	filter.SortBy = sortBy
+	filter.Descending = descending
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		filter.Cursor, err = DecodeOrderCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, errors.New("limit must be a number")
+		}
+	}
+
+	return filter, nil
+}
+
+// CancelOrder cancels an order, reversing its payment and delivery
+func (h *OrderHandler) CancelOrder(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	req := new(CancelOrderReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "a cancellation reason is required",
+		})
+	}
+
+	order, err := h.orderService.CancelOrder(uint(id), req.Reason)
+	if err != nil {
+		var transitionErr *InvalidTransitionError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		case errors.As(err, &transitionErr):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "order can no longer be canceled",
+				"status":  transitionErr.From,
+			})
+		case errors.Is(err, ErrRefundFailed), errors.Is(err, ErrDeliveryCancelFailed):
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("error canceling order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to cancel order",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "order canceled",
+		"data":    order,
+	})
+}
+
+// UpdateOrderStatus moves an order along, e.g. a pickup order to PROCESSING
+// when the kitchen starts it and to COMPLETED at handoff, which captures any
+// held payment
+func (h *OrderHandler) UpdateOrderStatus(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	req := new(UpdateOrderStatusReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	status := OrderStatus(strings.ToUpper(strings.TrimSpace(string(req.Status))))
+	if status == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "a status is required",
+		})
+	}
+
+	order, err := h.orderService.UpdateOrderStatus(uint(id), status, req.Reason)
+	if err != nil {
+		var transitionErr *InvalidTransitionError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		case errors.As(err, &transitionErr):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+				"status":  transitionErr.From,
+			})
+		case errors.Is(err, ErrCaptureFailed):
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, ErrRefundFailed), errors.Is(err, ErrDeliveryCancelFailed):
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("error updating status of order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to update order status",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"message": "order status updated",
+		"data":    order,
+	})
+}
+
+// CaptureOrderPayment collects the held payment for an order at handoff, with an
+// optional tip and final delivery fee. Pickup orders are completed by it.
+func (h *OrderHandler) CaptureOrderPayment(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	adj := new(CaptureAdjustment)
+	if err := c.Bind().Body(adj); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+	if (adj.Tip != nil && *adj.Tip < 0) || (adj.DeliveryFee != nil && *adj.DeliveryFee < 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "tip and delivery fee cannot be negative",
+		})
+	}
+
+	order, err := h.orderService.CaptureOrderPayment(uint(id), *adj)
+	if err != nil {
+		var transitionErr *InvalidTransitionError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		case errors.As(err, &transitionErr):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "order is not ready to be handed over",
+				"status":  transitionErr.From,
+			})
+		case errors.Is(err, ErrNoAuthorization):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, ErrCaptureFailed):
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("error capturing payment for order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to capture payment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success":  true,
+		"message":  "payment captured",
+		"order_id": order.ID,
+		"captured": order.Total,
+		"status":   order.OrderStatus,
+	})
+}
+
+// ConfirmCryptoPayment marks a pending crypto payment as received
+func (h *OrderHandler) ConfirmCryptoPayment(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	req := new(ConfirmPaymentReq)
+	if err := c.Bind().Body(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+
+	order, err := h.orderService.ConfirmCryptoPayment(uint(id), req.TransactionHash)
+	if err != nil {
+		var transitionErr *InvalidTransitionError
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		case errors.Is(err, ErrNoAuthorization), errors.As(err, &transitionErr):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   "order has no pending crypto payment",
+			})
+		case errors.Is(err, ErrPaymentDeclined):
+			return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("error confirming payment for order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to confirm payment",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success":  true,
+		"message":  "payment confirmed",
+		"order_id": order.ID,
+		"status":   order.OrderStatus,
+	})
+}
+
+// DispatchOrder sends a dasher for a paid delivery order
+func (h *OrderHandler) DispatchOrder(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid order ID",
+		})
+	}
+
+	order, err := h.orderService.DispatchOrder(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "order not found",
+			})
+		case errors.Is(err, ErrNotDispatchable):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		case errors.Is(err, ErrDispatchFailed):
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+			})
+		}
+		log.Printf("error dispatching order %d: %s", id, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to dispatch order",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    order.DeliveryData,
 	})
 }
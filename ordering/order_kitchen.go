@@ -0,0 +1,60 @@
+package ordering
+
+import (
+	"log"
+	"time"
+
+	"folo/kitchen"
+	"folo/store"
+)
+
+// sendToKitchen fires the ticket for a released order once its payment
+// allows it to be made. The order already stands, so a failure is logged.
+func (s *orderService) sendToKitchen(order *Order) {
+	if order.IsHeld() || !readyForDispatch(order) {
+		return
+	}
+	detailed, err := s.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		log.Printf("failed to load order %d for the kitchen: %v", order.ID, err)
+		return
+	}
+	profile, err := s.stores.Find(order.StoreID)
+	if err != nil {
+		log.Printf("failed to find the location for order %d: %v", order.ID, err)
+		return
+	}
+	if _, err := s.kitchen.Fire(newTicket(detailed, profile)); err != nil {
+		log.Printf("failed to send order %d to the kitchen: %v", order.ID, err)
+	}
+}
+
+// newTicket builds the kitchen ticket for an order loaded with its details.
+// It is due when the order was promised, or for orders placed before ready
+// times were promised, the location's prep time after the order was placed.
+func newTicket(order *Order, profile *store.Store) *kitchen.Ticket {
+	due := order.CreatedAt.Add(time.Duration(profile.PrepMinutes) * time.Minute)
+	if order.ReadyAt != nil {
+		due = *order.ReadyAt
+	}
+
+	ticket := &kitchen.Ticket{
+		OrderID:    order.ID,
+		StoreID:    profile.ID,
+		IsDelivery: order.IsDelivery,
+		DueAt:      due,
+		Notes:      order.Notes,
+	}
+	for i := range order.Basket.BasketItems {
+		item := &order.Basket.BasketItems[i]
+		line := kitchen.TicketItem{
+			Name:     item.MenuItem.Name,
+			Quantity: item.Quantity,
+		}
+		for _, modifier := range item.Modifiers {
+			line.Modifiers = append(line.Modifiers, modifier.Name)
+		}
+		ticket.Items = append(ticket.Items, line)
+	}
+	return ticket
+}
@@ -1,8 +1,13 @@
 package ordering
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"folo/delivery"
 	"folo/payment"
+	"folo/tax"
 
 	"gorm.io/gorm"
 )
@@ -22,23 +27,118 @@ const (
 // Order represents a customer order
 type Order struct {
 	gorm.Model
-	OrderStatus  OrderStatus
-	IsDelivery   bool
-	BasketID     uint `json:"-"`
-	Basket       Basket
-	Subtotal     int
-	DeliveryData delivery.DeliveryData
+	OrderStatus OrderStatus
+	PaymentType PaymentType
+	IsDelivery  bool
+	StoreID     uint `gorm:"index"` // the location that makes the order
+	BasketID    uint `json:"-"`
+	Basket      Basket
+	// Subtotal is the items before tax. Total, what the customer pays, adds
+	// the tax, delivery fee and tip.
+	Subtotal    int
+	Tax         int
+	DeliveryFee int
+	Tip         int
+	Total       int
+	// TaxLines is the tax charged on each item and on the delivery fee
+	TaxLines     []tax.Line              `gorm:"serializer:json" json:"TaxLines,omitempty"`
+	DeliveryData *delivery.DeliveryData  `json:"DeliveryData,omitempty"`
+	Payments     []payment.Authorization `json:"Payments,omitempty"`
+	CancelReason string                  `json:"CancelReason,omitempty"`
+	Notes        string                  `json:"Notes,omitempty"`
+	// ScheduledFor is the pickup or delivery slot of an order placed in advance
+	ScheduledFor *time.Time `json:"ScheduledFor,omitempty"`
+	// ReleaseAt is when a scheduled order is due to go to the kitchen and be
+	// dispatched, and ReleasedAt when it went. Orders for now are released
+	// as they are placed.
+	ReleaseAt  *time.Time `gorm:"index" json:"ReleaseAt,omitempty"`
+	ReleasedAt *time.Time `json:"ReleasedAt,omitempty"`
+	// ReadyAt is when the order is promised ready for pickup or the driver,
+	// estimated at checkout from prep times and the kitchen's load
+	ReadyAt *time.Time `json:"ReadyAt,omitempty"`
+}
+
+// IsHeld reports whether a scheduled order is waiting to be released
+func (o *Order) IsHeld() bool {
+	return o.ReleaseAt != nil && o.ReleasedAt == nil
+}
+
+// price taxes the items and the delivery fee and works out the total
+func (o *Order) price(rules tax.Rules, items []tax.Line) {
+	lines := items
+	if o.DeliveryFee > 0 {
+		lines = append(lines[:len(lines):len(lines)], tax.Line{Name: "Delivery fee", Category: tax.DeliveryFee, Amount: o.DeliveryFee})
+	}
+	breakdown := rules.Calculate(lines)
+	o.TaxLines = breakdown.Lines
+	o.Tax = breakdown.Tax
+	o.Total = o.Subtotal + o.Tax + o.DeliveryFee + o.Tip
+}
+
+// itemTaxLines returns the taxed lines of the order's items, to price it
+// again once its delivery fee is known
+func (o *Order) itemTaxLines() []tax.Line {
+	var items []tax.Line
+	for _, line := range o.TaxLines {
+		if line.Category != tax.DeliveryFee {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// adjust changes the delivery fee and tip after checkout. The items keep the
+// tax charged at checkout, whatever the rules are now; only the delivery fee
+// is taxed again, at the rate it was taxed at then. The rules give the rate
+// of a delivery fee the order didn't have at checkout, and the rounding.
+func (o *Order) adjust(rules tax.Rules, deliveryFee, tip *int) {
+	if tip != nil {
+		o.Tip = *tip
+	}
+	if deliveryFee != nil && *deliveryFee != o.DeliveryFee {
+		o.DeliveryFee = *deliveryFee
+		o.retaxDeliveryFee(rules)
+	}
+	o.Total = o.Subtotal + o.Tax + o.DeliveryFee + o.Tip
+}
+
+// retaxDeliveryFee replaces the delivery fee's tax line for a new fee
+func (o *Order) retaxDeliveryFee(rules tax.Rules) {
+	lines := o.itemTaxLines()
+	fee := tax.Line{Name: "Delivery fee", Category: tax.DeliveryFee}
+	found := false
+	for _, line := range o.TaxLines {
+		if line.Category == tax.DeliveryFee {
+			fee, found = line, true
+			o.Tax -= line.Tax
+		}
+	}
+	switch {
+	case found:
+		rules = tax.Rules{Rate: fee.Rate, Rounding: rules.Rounding, TaxDeliveryFee: true}
+	case len(o.TaxLines) == 0:
+		// Priced before tax was charged
+		rules = tax.Rules{}
+	}
+
+	if o.DeliveryFee > 0 {
+		fee.Amount = o.DeliveryFee
+		taxed := rules.Calculate([]tax.Line{fee})
+		lines = append(lines, taxed.Lines[0])
+		o.Tax += taxed.Tax
+	}
+	o.TaxLines = lines
 }
 
 // DeliveryStatus represents the current status of a delivery
-type DeliveryStatus string
+type DeliveryStatus = delivery.DeliveryStatus
 
 const (
-	Pending      DeliveryStatus = "PENDING"
-	Dispatched   DeliveryStatus = "DISPATCHED"
-	Interacted   DeliveryStatus = "INTERACTED"
-	Delivered    DeliveryStatus = "DELIVERED"
-	NotDelivered DeliveryStatus = "NOT_DELIVERED"
+	Pending      = delivery.Pending
+	Dispatched   = delivery.Dispatched
+	Interacted   = delivery.Interacted
+	Delivered    = delivery.Delivered
+	NotDelivered = delivery.NotDelivered
 )
 
 // DeliveryOrder represents an order with delivery information
@@ -54,13 +154,13 @@ func (do *DeliveryOrder) UpdateStatus(deliveryStatus DeliveryStatus) {
 }
 
 // PaymentType represents the payment method used
-type PaymentType string
+type PaymentType = payment.PaymentType
 
 const (
-	Cash   PaymentType = "Cash"
-	Credit PaymentType = "Credit"
-	Gift   PaymentType = "Gift"
-	Crypto PaymentType = "Crypto"
+	Cash   = payment.Cash
+	Credit = payment.Credit
+	Gift   = payment.Gift
+	Crypto = payment.Crypto
 )
 
 // DeliveryData contains delivery address and contact information
@@ -78,6 +178,66 @@ type OrderReq struct {
 	PaymentType  PaymentType
 	DeliveryData *delivery.DeliveryData
 	PaymentData  *payment.PaymentData
+	Tip          int
+	// ScheduledFor orders for a later slot instead of as soon as possible
+	ScheduledFor *time.Time
+	// Notes are for the kitchen, e.g. an allergy
+	Notes string
+
+	// SplitPaymentData is a card that pays whatever a gift card balance doesn't cover
+	SplitPaymentData *payment.PaymentData
+}
+
+// ErrInvalidOrderRequest is returned when an order request is missing required data
+var ErrInvalidOrderRequest = errors.New("invalid order request")
+
+// maxNotesLength keeps kitchen notes short enough to fit on a ticket
+const maxNotesLength = 500
+
+// Validate checks that the request carries what its payment type needs
+func (or OrderReq) Validate() error {
+	switch or.PaymentType {
+	case Cash, Crypto:
+	case Credit, Gift:
+		if or.PaymentData == nil || or.PaymentData.CardNumber == "" {
+			return fmt.Errorf("%w: paymentData is required for %s payments", ErrInvalidOrderRequest, or.PaymentType)
+		}
+	case "":
+		return fmt.Errorf("%w: paymentType is required", ErrInvalidOrderRequest)
+	default:
+		return fmt.Errorf("%w: unknown paymentType %q", ErrInvalidOrderRequest, or.PaymentType)
+	}
+	if or.SplitPaymentData != nil {
+		if or.PaymentType != Gift {
+			return fmt.Errorf("%w: split payments are only supported for %s payments", ErrInvalidOrderRequest, Gift)
+		}
+		if or.SplitPaymentData.CardNumber == "" {
+			return fmt.Errorf("%w: splitPaymentData requires a card number", ErrInvalidOrderRequest)
+		}
+	}
+	if or.Tip < 0 {
+		return fmt.Errorf("%w: tip cannot be negative", ErrInvalidOrderRequest)
+	}
+	if len(or.Notes) > maxNotesLength {
+		return fmt.Errorf("%w: notes must be at most %d characters", ErrInvalidOrderRequest, maxNotesLength)
+	}
+	return nil
+}
+
+// ConfirmPaymentReq represents the request body for confirming a pending crypto payment
+type ConfirmPaymentReq struct {
+	TransactionHash string `json:"transactionHash"`
+}
+
+// CancelOrderReq represents the request body for canceling an order
+type CancelOrderReq struct {
+	Reason string `json:"reason"`
+}
+
+// UpdateOrderStatusReq represents the request body for moving an order to a new status
+type UpdateOrderStatusReq struct {
+	Status OrderStatus `json:"status"`
+	Reason string      `json:"reason"`
 }
 
 // IsDelivery checks if the order is a delivery order
@@ -0,0 +1,508 @@
+package ordering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"folo/payment"
+)
+
+const paymentTimeout = 10 * time.Second
+
+var (
+	// ErrNoAuthorization is returned when an order has no payment hold to act on
+	ErrNoAuthorization = errors.New("order has no active payment authorization")
+	// ErrCaptureFailed is returned when the gateway refuses to capture an authorization
+	ErrCaptureFailed = errors.New("payment capture failed")
+	// ErrUnsupportedPaymentType is returned when no provider is configured for a payment type
+	ErrUnsupportedPaymentType = errors.New("payment type is not supported")
+)
+
+// PaymentProviders groups the processors behind each payment type. A nil
+// provider disables its payment type.
+type PaymentProviders struct {
+	Card   payment.PaymentGateway
+	Gift   payment.PaymentGateway
+	Crypto payment.CryptoGateway
+}
+
+// CaptureAdjustment changes the amount captured at handoff. Nil fields keep the
+// values set at checkout.
+type CaptureAdjustment struct {
+	Tip         *int `json:"tip"`
+	DeliveryFee *int `json:"deliveryFee"`
+}
+
+// processorHold is what an external processor was asked for before the order
+// was written: a card hold, or a crypto payment request. It is recorded
+// against the order in the order's transaction, and a card hold that isn't
+// is voided.
+type processorHold struct {
+	gateway     payment.PaymentGateway
+	paymentType PaymentType
+	amount      int
+	result      payment.PaymentResult
+	invoice     *payment.CryptoInvoice
+	// recorded is set once the hold has an authorization on the order
+	recorded bool
+}
+
+// placeHold asks the processor for an order's card hold or crypto payment
+// request. A split payment holds the whole total on the card, as what the
+// gift card covers is only known once it is redeemed with the order; the
+// capture at handoff only takes the rest. Cash and gift card orders need
+// nothing up front.
+func (s *orderService) placeHold(order *Order, req OrderReq) (*processorHold, error) {
+	request := payment.PaymentRequest{
+		Amount:    order.Total,
+		Currency:  payment.DefaultCurrency,
+		Reference: fmt.Sprintf("basket-%d", order.BasketID),
+	}
+	switch {
+	case req.PaymentType == Credit:
+		request.Card = req.PaymentData
+	case req.PaymentType == Gift && req.SplitPaymentData != nil:
+		request.Card = req.SplitPaymentData
+	case req.PaymentType == Crypto:
+	default:
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	if req.PaymentType == Crypto {
+		invoice, err := s.payments.Crypto.CreateInvoice(ctx, request)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create crypto payment request: %w", err)
+		}
+		return &processorHold{paymentType: Crypto, amount: order.Total, invoice: invoice}, nil
+	}
+	return &processorHold{
+		gateway:     s.payments.Card,
+		paymentType: Credit,
+		amount:      order.Total,
+		result:      s.payments.Card.Authorize(ctx, request),
+	}, nil
+}
+
+// recordHold records a processor hold against the order
+func (s *orderService) recordHold(order *Order, hold *processorHold) (*payment.Authorization, error) {
+	var auth *payment.Authorization
+	if hold.invoice != nil {
+		auth = &payment.Authorization{
+			OrderID:         order.ID,
+			AuthorizationID: hold.invoice.ID,
+			PaymentType:     Crypto,
+			Status:          payment.AuthorizationPending,
+			Currency:        payment.DefaultCurrency,
+			Amount:          hold.amount,
+			PaymentRequest:  hold.invoice.PaymentURI,
+		}
+	} else {
+		auth = newAuthorization(order, hold.paymentType, hold.amount, hold.result)
+	}
+	if err := s.paymentRepo.Create(auth); err != nil {
+		return nil, fmt.Errorf("failed to record authorization: %w", err)
+	}
+	hold.recorded = true
+	order.Payments = append(order.Payments, *auth)
+	return auth, nil
+}
+
+// abandonPayment voids a card hold that no order records, because the order
+// transaction rolled back or the order turned out not to need it. A crypto
+// payment request can't be withdrawn and is simply never paid.
+func (s *orderService) abandonPayment(hold *processorHold) {
+	if hold == nil || hold.gateway == nil || !hold.result.Approved() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	if result := hold.gateway.Void(ctx, hold.result.AuthorizationID); !result.Approved() {
+		log.Printf("failed to void abandoned hold %s: status=%s decline=%s err=%v",
+			hold.result.AuthorizationID, result.Status, result.DeclineCode, result.Error)
+	}
+}
+
+// paymentStrategy settles a freshly created order for one payment type,
+// inside the order's transaction
+type paymentStrategy func(order *Order, req OrderReq, hold *processorHold) error
+
+func (s *orderService) paymentStrategies() map[PaymentType]paymentStrategy {
+	return map[PaymentType]paymentStrategy{
+		Cash:   s.payAtPickup,
+		Credit: s.payByCard,
+		Gift:   s.payByGiftCard,
+		Crypto: s.payByCrypto,
+	}
+}
+
+// payOrder dispatches to the strategy for the order's payment type
+func (s *orderService) payOrder(order *Order, req OrderReq, hold *processorHold) error {
+	strategy, ok := s.paymentStrategies()[req.PaymentType]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedPaymentType, req.PaymentType)
+	}
+	return strategy(order, req, hold)
+}
+
+// payAtPickup leaves cash orders UNPAID; the customer pays when collecting
+func (s *orderService) payAtPickup(order *Order, req OrderReq, hold *processorHold) error {
+	log.Printf("order %d will be paid in cash at pickup", order.ID)
+	return nil
+}
+
+// payByCard records the hold on the card, captured later at handoff
+func (s *orderService) payByCard(order *Order, req OrderReq, hold *processorHold) error {
+	if _, err := s.recordHold(order, hold); err != nil {
+		return err
+	}
+	if !hold.result.Approved() {
+		return s.failPayment(order, hold.result)
+	}
+	return s.transition(order, Paid, "payment authorized")
+}
+
+// payByGiftCard redeems the gift card at checkout. With SplitPaymentData, a
+// balance that doesn't cover the order is used up and the card hold pays the
+// rest, captured later at handoff.
+func (s *orderService) payByGiftCard(order *Order, req OrderReq, hold *processorHold) error {
+	split := hold != nil
+	// Don't touch the gift card for an order the card can't pay the rest of
+	if split && !hold.result.Approved() {
+		if _, err := s.recordHold(order, hold); err != nil {
+			return err
+		}
+		return s.failPayment(order, hold.result)
+	}
+
+	total := order.Total
+	giftAuth, result, err := s.authorize(s.payments.Gift, order, Gift, req.PaymentData, total, split)
+	if err != nil {
+		return err
+	}
+	if !result.Approved() {
+		return s.failPayment(order, result)
+	}
+	if err := s.capture(s.payments.Gift, order, giftAuth, giftAuth.Amount); err != nil {
+		return err
+	}
+
+	// A card hold the gift card made unnecessary goes unrecorded, and is voided
+	if split && total > giftAuth.Amount {
+		if _, err := s.recordHold(order, hold); err != nil {
+			return err
+		}
+	}
+	return s.transition(order, Paid, "payment authorized")
+}
+
+// payByCrypto records the payment request; the order stays UNPAID until the
+// transfer is confirmed through ConfirmCryptoPayment
+func (s *orderService) payByCrypto(order *Order, req OrderReq, hold *processorHold) error {
+	_, err := s.recordHold(order, hold)
+	return err
+}
+
+// ConfirmCryptoPayment marks a pending crypto payment as received and the order as PAID
+func (s *orderService) ConfirmCryptoPayment(orderID uint, transactionHash string) (*Order, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if s.payments.Crypto == nil {
+		return order, fmt.Errorf("%w: %s", ErrUnsupportedPaymentType, Crypto)
+	}
+
+	auths, err := s.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil {
+		return order, err
+	}
+	var auth *payment.Authorization
+	for i := range auths {
+		if auths[i].PaymentType == Crypto && auths[i].Status == payment.AuthorizationPending {
+			auth = &auths[i]
+		}
+	}
+	if auth == nil {
+		return order, ErrNoAuthorization
+	}
+	if err := ValidateTransition(order.OrderStatus, Paid); err != nil {
+		return order, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	result := s.payments.Crypto.ConfirmInvoice(ctx, auth.AuthorizationID, transactionHash)
+	if !result.Approved() {
+		return order, fmt.Errorf("%w: %s", ErrPaymentDeclined, result.DeclineCode)
+	}
+
+	// A confirmed transfer is final, so it is recorded as captured
+	auth.Status = payment.AuthorizationCaptured
+	auth.CapturedAmount = auth.Amount
+	if err := s.paymentRepo.Update(auth); err != nil {
+		return order, err
+	}
+	if err := s.transition(order, Paid, "crypto payment confirmed"); err != nil {
+		return order, err
+	}
+	s.sendToKitchen(order)
+	s.dispatchIfReady(order)
+	return order, nil
+}
+
+// authorize places a hold for amount and records the attempt. It leaves the
+// order status alone so split payments can settle every tender first. A hold
+// that can't be recorded could never be captured or released, so it is
+// voided and the error returned.
+func (s *orderService) authorize(gateway payment.PaymentGateway, o *Order, paymentType PaymentType, p *payment.PaymentData, amount int, allowPartial bool) (*payment.Authorization, payment.PaymentResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	result := gateway.Authorize(ctx, payment.PaymentRequest{
+		Amount:       amount,
+		Currency:     payment.DefaultCurrency,
+		Card:         p,
+		Reference:    fmt.Sprintf("order-%d", o.ID),
+		AllowPartial: allowPartial,
+	})
+
+	auth := newAuthorization(o, paymentType, amount, result)
+	if err := s.paymentRepo.Create(auth); err != nil {
+		if result.Approved() {
+			if void := gateway.Void(ctx, result.AuthorizationID); !void.Approved() {
+				log.Printf("failed to void unrecorded authorization %s for order %d: status=%s err=%v",
+					result.AuthorizationID, o.ID, void.Status, void.Error)
+			}
+		}
+		return auth, result, fmt.Errorf("failed to record authorization: %w", err)
+	}
+	o.Payments = append(o.Payments, *auth)
+	return auth, result, nil
+}
+
+// newAuthorization is the record of a gateway's answer to an authorization
+func newAuthorization(o *Order, paymentType PaymentType, amount int, result payment.PaymentResult) *payment.Authorization {
+	auth := &payment.Authorization{
+		OrderID:         o.ID,
+		AuthorizationID: result.AuthorizationID,
+		PaymentType:     paymentType,
+		Currency:        payment.DefaultCurrency,
+		Amount:          amount,
+		Status:          payment.AuthorizationAuthorized,
+	}
+	if !result.Approved() {
+		auth.Status = payment.AuthorizationDeclined
+		auth.DeclineCode = result.DeclineCode
+	} else if result.Amount > 0 {
+		auth.Amount = result.Amount
+	}
+	return auth
+}
+
+// failPayment moves an order whose payment was not approved to FAILED and
+// returns the error describing why
+func (s *orderService) failPayment(o *Order, result payment.PaymentResult) error {
+	reason := fmt.Sprintf("payment %s", strings.ToLower(string(result.Status)))
+	if result.DeclineCode != "" {
+		reason = fmt.Sprintf("%s: %s", reason, result.DeclineCode)
+	}
+	if err := s.transition(o, Failed, reason); err != nil {
+		return err
+	}
+	if result.Error != nil {
+		return result.Error
+	}
+	return fmt.Errorf("%w: %s", ErrPaymentDeclined, result.DeclineCode)
+}
+
+// CaptureOrderPayment collects the held funds for an order, applying any tip or
+// final delivery fee adjustments first. Pickup orders are captured at handoff,
+// so they must be PROCESSING and are completed by the capture; delivery orders
+// complete when the dasher drops them off.
+func (s *orderService) CaptureOrderPayment(orderID uint, adj CaptureAdjustment) (*Order, error) {
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !order.IsDelivery {
+		if err := ValidateTransition(order.OrderStatus, Completed); err != nil {
+			return order, err
+		}
+	}
+	if err := s.captureOrderPayment(order, adj); err != nil {
+		return order, err
+	}
+	if !order.IsDelivery {
+		if err := s.transition(order, Completed, "picked up"); err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+func (s *orderService) captureOrderPayment(order *Order, adj CaptureAdjustment) error {
+	auths, err := s.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+	if len(auths) == 0 {
+		return ErrNoAuthorization
+	}
+
+	// Split payments settle part of the total up front (e.g. a gift card), so
+	// the held tender only collects what is left
+	var hold *payment.Authorization
+	settled := 0
+	for i := range auths {
+		switch auths[i].Status {
+		case payment.AuthorizationAuthorized:
+			hold = &auths[i]
+		case payment.AuthorizationCaptured:
+			settled += auths[i].CapturedAmount
+		}
+	}
+	if hold == nil {
+		return fmt.Errorf("%w: authorization is %s", ErrCaptureFailed, auths[len(auths)-1].Status)
+	}
+	gateway, err := s.gatewayFor(hold.PaymentType)
+	if err != nil {
+		return err
+	}
+
+	if adj.Tip != nil || adj.DeliveryFee != nil {
+		profile, err := s.stores.Find(order.StoreID)
+		if err != nil {
+			return err
+		}
+		order.adjust(profile.Tax(), adj.DeliveryFee, adj.Tip)
+	}
+	if err := s.capture(gateway, order, hold, order.Total-settled); err != nil {
+		return err
+	}
+	return s.orderRepo.Update(order)
+}
+
+// capture collects amount against an authorization and records the result
+func (s *orderService) capture(gateway payment.PaymentGateway, order *Order, auth *payment.Authorization, amount int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	result := gateway.Capture(ctx, auth.AuthorizationID, amount)
+	if !result.Approved() {
+		log.Printf("capture failed for order %d: status=%s decline=%s err=%v",
+			order.ID, result.Status, result.DeclineCode, result.Error)
+		return fmt.Errorf("%w: %s", ErrCaptureFailed, result.DeclineCode)
+	}
+
+	auth.Status = payment.AuthorizationCaptured
+	auth.CapturedAmount = amount
+	return s.paymentRepo.Update(auth)
+}
+
+// captureIfAuthorized captures the checkout amount for an order whose payment is
+// still only held. Already captured and unpaid (e.g. cash) orders are left alone.
+func (s *orderService) captureIfAuthorized(order *Order) error {
+	auths, err := s.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+	for _, auth := range auths {
+		if auth.Status == payment.AuthorizationAuthorized {
+			return s.captureOrderPayment(order, CaptureAdjustment{})
+		}
+	}
+	return nil
+}
+
+// releaseOrderPayment voids uncaptured holds and refunds captured payments.
+// Every tender is attempted even if one fails. Orders that never got an
+// authorization have nothing to release.
+func (s *orderService) releaseOrderPayment(order *Order) error {
+	auths, err := s.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+
+	var releaseErr error
+	for i := range auths {
+		if err := s.releaseAuthorization(order, &auths[i]); err != nil && releaseErr == nil {
+			releaseErr = err
+		}
+	}
+	return releaseErr
+}
+
+// releaseAuthorization voids or refunds a single authorization
+func (s *orderService) releaseAuthorization(order *Order, auth *payment.Authorization) error {
+	// Nothing was collected for a pending payment request, just withdraw it
+	if auth.Status == payment.AuthorizationPending {
+		auth.Status = payment.AuthorizationVoided
+		return s.paymentRepo.Update(auth)
+	}
+
+	gateway, err := s.gatewayFor(auth.PaymentType)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), paymentTimeout)
+	defer cancel()
+
+	var result payment.PaymentResult
+	if auth.Status == payment.AuthorizationCaptured {
+		result = gateway.Refund(ctx, auth.AuthorizationID, auth.CapturedAmount)
+		auth.Status = payment.AuthorizationRefunded
+	} else {
+		result = gateway.Void(ctx, auth.AuthorizationID)
+		auth.Status = payment.AuthorizationVoided
+	}
+	if !result.Approved() {
+		log.Printf("failed to release payment %s for order %d: status=%s decline=%s err=%v",
+			auth.AuthorizationID, order.ID, result.Status, result.DeclineCode, result.Error)
+		return ErrRefundFailed
+	}
+
+	return s.paymentRepo.Update(auth)
+}
+
+// checkPaymentSupported checks a provider is configured for every tender the
+// request pays with
+func (s *orderService) checkPaymentSupported(req OrderReq) error {
+	configured := map[PaymentType]bool{
+		Cash:   true,
+		Credit: s.payments.Card != nil,
+		Gift:   s.payments.Gift != nil,
+		Crypto: s.payments.Crypto != nil,
+	}
+	if !configured[req.PaymentType] {
+		return fmt.Errorf("%w: %s", ErrUnsupportedPaymentType, req.PaymentType)
+	}
+	if req.SplitPaymentData != nil && !configured[Credit] {
+		return fmt.Errorf("%w: %s", ErrUnsupportedPaymentType, Credit)
+	}
+	return nil
+}
+
+// gatewayFor returns the two-phase gateway that handled a payment type
+func (s *orderService) gatewayFor(paymentType PaymentType) (payment.PaymentGateway, error) {
+	var gateway payment.PaymentGateway
+	switch paymentType {
+	case Credit, "":
+		gateway = s.payments.Card
+	case Gift:
+		gateway = s.payments.Gift
+	}
+	if gateway == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedPaymentType, paymentType)
+	}
+	return gateway, nil
+}
@@ -0,0 +1,357 @@
+package ordering
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"folo/delivery"
+	"folo/giftcard"
+	"folo/payment"
+
+	"gorm.io/gorm"
+)
+
+func TestOrderPayment_AuthorizeCaptureRefund(t *testing.T) {
+	db := newTestDB(t)
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{MaxOvercapturePercent: 20})
+	service := newTestOrderService(t, db, &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-1", Fee: 500}}, gateway)
+	basket := seedBasket(t, db, 500, 2)
+
+	// A delivery order, so capturing it before dropoff leaves it open to cancel
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.OrderStatus != Paid {
+		t.Fatalf("expected PAID after authorization, got %s", order.OrderStatus)
+	}
+
+	auths, err := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil || len(auths) != 1 {
+		t.Fatalf("expected one active authorization, got %+v (err %v)", auths, err)
+	}
+	if auth := auths[0]; auth.Status != payment.AuthorizationAuthorized || auth.Amount != 1500 {
+		t.Errorf("expected AUTHORIZED for 1500, got %s for %d", auth.Status, auth.Amount)
+	}
+
+	tip := 150
+	if _, err := service.CaptureOrderPayment(order.ID, CaptureAdjustment{Tip: &tip}); err != nil {
+		t.Fatalf("unexpected error capturing payment: %v", err)
+	}
+	auths, _ = service.paymentRepo.FindActiveByOrderID(order.ID)
+	if auth := auths[0]; auth.Status != payment.AuthorizationCaptured || auth.CapturedAmount != 1650 {
+		t.Errorf("expected CAPTURED for 1650, got %s for %d", auth.Status, auth.CapturedAmount)
+	}
+
+	if _, err := service.CancelOrder(order.ID, "kitchen fire"); err != nil {
+		t.Fatalf("unexpected error canceling order: %v", err)
+	}
+	auths, _ = service.paymentRepo.FindByOrderID(order.ID)
+	if len(auths) != 1 || auths[0].Status != payment.AuthorizationRefunded {
+		t.Errorf("expected the captured payment to be refunded, got %+v", auths)
+	}
+}
+
+func TestCaptureOrderPayment_CompletesPickupAtHandoff(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{MaxOvercapturePercent: 20}))
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:    seedBasket(t, db, 500, 2).ID,
+		PaymentType: Credit,
+		PaymentData: &payment.PaymentData{CardNumber: "4242424242424242"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	// The order can't be handed over before the kitchen has it
+	tip := 100
+	_, err = service.CaptureOrderPayment(order.ID, CaptureAdjustment{Tip: &tip})
+	var transitionErr *InvalidTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("expected InvalidTransitionError capturing a PAID pickup order, got %v", err)
+	}
+	if auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID); auths[0].Status != payment.AuthorizationAuthorized {
+		t.Errorf("expected the hold left uncaptured, got %s", auths[0].Status)
+	}
+
+	if _, err := service.UpdateOrderStatus(order.ID, Processing, "kitchen started"); err != nil {
+		t.Fatalf("unexpected error moving to PROCESSING: %v", err)
+	}
+	captured, err := service.CaptureOrderPayment(order.ID, CaptureAdjustment{Tip: &tip})
+	if err != nil {
+		t.Fatalf("unexpected error capturing payment: %v", err)
+	}
+	if captured.OrderStatus != Completed {
+		t.Errorf("expected COMPLETED after capture at handoff, got %s", captured.OrderStatus)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if auths[0].Status != payment.AuthorizationCaptured || auths[0].CapturedAmount != 1100 {
+		t.Errorf("expected CAPTURED for 1100, got %s for %d", auths[0].Status, auths[0].CapturedAmount)
+	}
+}
+
+func TestOrderPayment_DeclineFailsOrder(t *testing.T) {
+	db := newTestDB(t)
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{Rules: payment.DefaultFakeRules()})
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, gateway)
+	basket := seedBasket(t, db, 500, 1)
+
+	order, _ := service.CreateOrder(OrderReq{
+		BasketId:    basket.ID,
+		PaymentType: Credit,
+		PaymentData: &payment.PaymentData{CardNumber: "4000000000000002"},
+	})
+	if order.OrderStatus != Failed {
+		t.Fatalf("expected FAILED after decline, got %s", order.OrderStatus)
+	}
+
+	auths, _ := service.paymentRepo.FindByOrderID(order.ID)
+	if len(auths) != 1 || auths[0].DeclineCode != "card_declined" {
+		t.Errorf("expected declined authorization to be recorded, got %+v", auths)
+	}
+}
+
+func TestCreateOrder_CashStaysUnpaid(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	order, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash})
+	if err != nil {
+		t.Fatalf("unexpected error creating cash order: %v", err)
+	}
+	if order.OrderStatus != Unpaid {
+		t.Errorf("expected cash order to stay UNPAID, got %s", order.OrderStatus)
+	}
+}
+
+func TestCreateOrder_CryptoPendingUntilConfirmed(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	order, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Crypto})
+	if err != nil {
+		t.Fatalf("unexpected error creating crypto order: %v", err)
+	}
+	if order.OrderStatus != Unpaid {
+		t.Fatalf("expected crypto order to stay UNPAID, got %s", order.OrderStatus)
+	}
+	if len(order.Payments) != 1 || order.Payments[0].PaymentRequest == "" {
+		t.Fatalf("expected a payment request, got %+v", order.Payments)
+	}
+
+	confirmed, err := service.ConfirmCryptoPayment(order.ID, "0xabc")
+	if err != nil {
+		t.Fatalf("unexpected error confirming payment: %v", err)
+	}
+	if confirmed.OrderStatus != Paid {
+		t.Errorf("expected PAID after confirmation, got %s", confirmed.OrderStatus)
+	}
+}
+
+func TestCreateOrder_RejectsInvalidPaymentRequests(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	if _, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Credit}); !errors.Is(err, ErrInvalidOrderRequest) {
+		t.Errorf("expected ErrInvalidOrderRequest for card order without card data, got %v", err)
+	}
+	if _, err := service.CreateOrder(OrderReq{BasketId: basket.ID}); !errors.Is(err, ErrInvalidOrderRequest) {
+		t.Errorf("expected ErrInvalidOrderRequest without payment type, got %v", err)
+	}
+}
+
+// issueGiftCard issues a gift card with the PIN 1234
+func issueGiftCard(t *testing.T, db *gorm.DB, balance int) *giftcard.Card {
+	t.Helper()
+	card, err := giftcard.IssueReq{Pin: "1234", Amount: balance}.NewCard()
+	if err != nil {
+		t.Fatalf("failed to build gift card: %v", err)
+	}
+	if err := giftcard.NewRepository(db).Issue(card, balance, "test"); err != nil {
+		t.Fatalf("failed to issue gift card: %v", err)
+	}
+	return card
+}
+
+func TestCreateOrder_GiftCardSplitTender(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-1", Fee: 500}}, payment.NewFakeGateway(payment.FakeGatewayConfig{MaxOvercapturePercent: 20}))
+	basket := seedBasket(t, db, 500, 2)
+	card := issueGiftCard(t, db, 700)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:         basket.ID,
+		PaymentType:      Gift,
+		PaymentData:      &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+		SplitPaymentData: &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData:     &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.OrderStatus != Paid {
+		t.Fatalf("expected PAID, got %s", order.OrderStatus)
+	}
+
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if len(auths) != 2 {
+		t.Fatalf("expected a gift and a card authorization, got %+v", auths)
+	}
+	if auths[0].PaymentType != Gift || auths[0].Status != payment.AuthorizationCaptured || auths[0].CapturedAmount != 700 {
+		t.Errorf("expected gift card captured for 700, got %+v", auths[0])
+	}
+	// The card is held for the whole total before the gift card is redeemed
+	if auths[1].PaymentType != Credit || auths[1].Status != payment.AuthorizationAuthorized || auths[1].Amount != 1500 {
+		t.Errorf("expected card held for 1500, got %+v", auths[1])
+	}
+
+	// The tip lands on the card, the gift card part is already settled
+	tip := 50
+	if _, err := service.CaptureOrderPayment(order.ID, CaptureAdjustment{Tip: &tip}); err != nil {
+		t.Fatalf("unexpected error capturing payment: %v", err)
+	}
+	auths, _ = service.paymentRepo.FindActiveByOrderID(order.ID)
+	if auths[1].CapturedAmount != 850 {
+		t.Errorf("expected card captured for 850, got %d", auths[1].CapturedAmount)
+	}
+
+	if _, err := service.CancelOrder(order.ID, "customer changed their mind"); err != nil {
+		t.Fatalf("unexpected error canceling order: %v", err)
+	}
+	restored, _ := giftcard.NewRepository(db).FindByCode(card.Code)
+	if restored.Balance != 700 {
+		t.Errorf("expected gift card balance restored to 700, got %d", restored.Balance)
+	}
+}
+
+func TestCreateOrder_SplitTenderDeclineRestoresGiftCard(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{Rules: payment.DefaultFakeRules()}))
+	basket := seedBasket(t, db, 500, 2)
+	card := issueGiftCard(t, db, 700)
+
+	order, _ := service.CreateOrder(OrderReq{
+		BasketId:         basket.ID,
+		PaymentType:      Gift,
+		PaymentData:      &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+		SplitPaymentData: &payment.PaymentData{CardNumber: "4000000000000002"},
+	})
+	if order.OrderStatus != Failed {
+		t.Fatalf("expected FAILED, got %s", order.OrderStatus)
+	}
+	restored, _ := giftcard.NewRepository(db).FindByCode(card.Code)
+	if restored.Balance != 700 {
+		t.Errorf("expected gift card balance restored to 700, got %d", restored.Balance)
+	}
+}
+
+// voidRecordingGateway remembers the authorizations it was asked to void
+type voidRecordingGateway struct {
+	payment.PaymentGateway
+	voided []string
+}
+
+func (g *voidRecordingGateway) Void(ctx context.Context, authorizationID string) payment.PaymentResult {
+	g.voided = append(g.voided, authorizationID)
+	return g.PaymentGateway.Void(ctx, authorizationID)
+}
+
+func TestCreateOrder_VoidsHoldThatCannotBeRecorded(t *testing.T) {
+	db := newTestDB(t)
+	gateway := &voidRecordingGateway{PaymentGateway: payment.NewFakeGateway(payment.FakeGatewayConfig{})}
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, gateway)
+	basket := seedBasket(t, db, 500, 2)
+	if err := db.Migrator().DropTable(&payment.Authorization{}); err != nil {
+		t.Fatalf("failed to drop authorizations: %v", err)
+	}
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:    basket.ID,
+		PaymentType: Credit,
+		PaymentData: &payment.PaymentData{CardNumber: "4242424242424242"},
+	})
+	if err == nil {
+		t.Fatal("expected an error when the authorization can't be recorded")
+	}
+	if len(gateway.voided) != 1 {
+		t.Errorf("expected the unrecorded hold voided, got %v", gateway.voided)
+	}
+	var orders int64
+	db.Model(&Order{}).Count(&orders)
+	if order != nil || orders != 0 {
+		t.Errorf("expected the order rolled back, got %+v (%d stored)", order, orders)
+	}
+}
+
+func TestCreateOrder_GiftCardCoveringOrderVoidsCardHold(t *testing.T) {
+	db := newTestDB(t)
+	gateway := &voidRecordingGateway{PaymentGateway: payment.NewFakeGateway(payment.FakeGatewayConfig{})}
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, gateway)
+	basket := seedBasket(t, db, 500, 2)
+	card := issueGiftCard(t, db, 2000)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:         basket.ID,
+		PaymentType:      Gift,
+		PaymentData:      &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+		SplitPaymentData: &payment.PaymentData{CardNumber: "4242424242424242"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.OrderStatus != Paid {
+		t.Fatalf("expected PAID, got %s", order.OrderStatus)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if len(auths) != 1 || auths[0].PaymentType != Gift {
+		t.Errorf("expected only the gift card recorded, got %+v", auths)
+	}
+	if len(gateway.voided) != 1 {
+		t.Errorf("expected the unneeded card hold voided, got %v", gateway.voided)
+	}
+}
+
+func TestCreateOrder_GiftCardRedemptionRollsBackWithOrder(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+	card := issueGiftCard(t, db, 2000)
+
+	// Fail the order's move to PAID, after the gift card has been redeemed
+	if err := db.Callback().Update().Before("gorm:update").Register("test:fail_order_update", func(tx *gorm.DB) {
+		if tx.Statement.Table == "orders" {
+			tx.AddError(errors.New("database unavailable"))
+		}
+	}); err != nil {
+		t.Fatalf("failed to register callback: %v", err)
+	}
+
+	if _, err := service.CreateOrder(OrderReq{
+		BasketId:    basket.ID,
+		PaymentType: Gift,
+		PaymentData: &payment.PaymentData{CardNumber: card.Code, Cvv: "1234"},
+	}); err == nil {
+		t.Fatal("expected an error when the order can't be written")
+	}
+
+	restored, _ := giftcard.NewRepository(db).FindByCode(card.Code)
+	if restored.Balance != 2000 {
+		t.Errorf("expected the redemption rolled back with the order, got balance %d", restored.Balance)
+	}
+	var entries int64
+	db.Model(&giftcard.LedgerEntry{}).Where("card_id = ?", card.ID).Count(&entries)
+	if entries != 1 {
+		t.Errorf("expected only the issue in the ledger, got %d entries", entries)
+	}
+}
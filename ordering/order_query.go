@@ -0,0 +1,106 @@
+package ordering
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOrderPageSize = 20
+	maxOrderPageSize     = 100
+)
+
+// OrderSortField is a column orders can be listed by
+type OrderSortField string
+
+const (
+	// SortByCreatedAt orders by ID, which is assigned in creation order
+	SortByCreatedAt OrderSortField = "created_at"
+	SortBySubtotal  OrderSortField = "subtotal"
+)
+
+// OrderCursor marks the last order of a page so the next page can continue after it
+type OrderCursor struct {
+	Value int // sort column value of the last order, unused when sorting by created_at
+	ID    uint
+}
+
+// Encode returns an opaque string representation of the cursor
+func (c OrderCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%d", c.Value, c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeOrderCursor parses a cursor produced by OrderCursor.Encode
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	value, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	i, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &OrderCursor{Value: v, ID: uint(i)}, nil
+}
+
+// OrderListFilter controls which orders are listed and in what order
+type OrderListFilter struct {
+	Statuses    []OrderStatus
+	IsDelivery  *bool
+	StoreID     *uint
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	SortBy      OrderSortField
+	Descending  bool
+	Cursor      *OrderCursor
+	Limit       int
+}
+
+// ParseOrderSort parses a sort parameter such as "created_at" or "-subtotal";
+// a leading "-" sorts descending
+func ParseOrderSort(s string) (OrderSortField, bool, error) {
+	if s == "" {
+		return SortByCreatedAt, true, nil
+	}
+	descending := strings.HasPrefix(s, "-")
+	field := OrderSortField(strings.TrimPrefix(s, "-"))
+	switch field {
+	case SortByCreatedAt, SortBySubtotal:
+		return field, descending, nil
+	default:
+		return "", false, fmt.Errorf("cannot sort by %q", field)
+	}
+}
+
+// NormalizedLimit clamps the page size to a sane range
+func (f OrderListFilter) NormalizedLimit() int {
+	if f.Limit <= 0 {
+		return defaultOrderPageSize
+	}
+	if f.Limit > maxOrderPageSize {
+		return maxOrderPageSize
+	}
+	return f.Limit
+}
+
+// CursorFor returns the cursor pointing just past the given order
+func (f OrderListFilter) CursorFor(order *Order) OrderCursor {
+	cursor := OrderCursor{ID: order.ID}
+	if f.SortBy == SortBySubtotal {
+		cursor.Value = order.Subtotal
+	}
+	return cursor
+}
@@ -1,16 +1,24 @@
 package ordering
 
 import (
+	"time"
+
 	"folo/delivery"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // OrderRepository handles database operations for orders
 type OrderRepository interface {
 	Create(order *Order) error
 	FindByID(id uint) (*Order, error)
+	FindByIDWithDetails(id uint) (*Order, error)
+	FindAll(filter OrderListFilter) ([]Order, error)
 	Update(order *Order) error
+	UpdateStatus(order *Order, from OrderStatus, reason string) error
+	FindStatusHistory(orderID uint) ([]OrderStatusHistory, error)
+	FindDueForRelease(now time.Time) ([]Order, error)
 }
 
 type orderRepository struct {
@@ -22,9 +30,30 @@ func NewOrderRepository(db *gorm.DB) OrderRepository {
 	return &orderRepository{db: db}
 }
 
-// Create creates a new order in the database
+// MigrateOrderTotals fills in the total of orders placed before tax was
+// charged, whose subtotal included the delivery fee. Run it after migrating
+// the Order table; orders that have a total are left alone.
+func MigrateOrderTotals(db *gorm.DB) error {
+	return db.Model(&Order{}).
+		Where("total = 0 AND subtotal > 0").
+		Updates(map[string]any{
+			"total":    gorm.Expr("subtotal + tip"),
+			"subtotal": gorm.Expr("subtotal - delivery_fee"),
+		}).Error
+}
+
+// Create creates a new order in the database and records its initial status
 func (r *orderRepository) Create(order *Order) error {
-	return r.db.Create(order).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrderStatusHistory{
+			OrderID:  order.ID,
+			ToStatus: order.OrderStatus,
+			Reason:   "order created",
+		}).Error
+	})
 }
 
 // FindByID finds an order by ID
@@ -34,15 +63,114 @@ func (r *orderRepository) FindByID(id uint) (*Order, error) {
 	return &order, err
 }
 
-// Update updates an existing order
+// FindByIDWithDetails finds an order by ID with basket items, menu items and delivery data preloaded
+func (r *orderRepository) FindByIDWithDetails(id uint) (*Order, error) {
+	var order Order
+	err := r.withDetails().First(&order, id).Error
+	order.Basket.applyLocation()
+	return &order, err
+}
+
+// FindAll returns orders matching the filter. It fetches one row more than the
+// page size so callers can tell whether another page exists.
+func (r *orderRepository) FindAll(filter OrderListFilter) ([]Order, error) {
+	query := r.withDetails()
+	if len(filter.Statuses) > 0 {
+		query = query.Where("order_status IN ?", filter.Statuses)
+	}
+	if filter.IsDelivery != nil {
+		query = query.Where("is_delivery = ?", *filter.IsDelivery)
+	}
+	if filter.StoreID != nil {
+		query = query.Where("store_id = ?", *filter.StoreID)
+	}
+	// created_at is stored as local-time text, so compare against local times
+	if filter.CreatedFrom != nil {
+		query = query.Where("created_at >= ?", filter.CreatedFrom.Local())
+	}
+	if filter.CreatedTo != nil {
+		query = query.Where("created_at < ?", filter.CreatedTo.Local())
+	}
+
+	direction, cmp := "ASC", ">"
+	if filter.Descending {
+		direction, cmp = "DESC", "<"
+	}
+	switch filter.SortBy {
+	case SortBySubtotal:
+		if filter.Cursor != nil {
+			query = query.Where("subtotal "+cmp+" ? OR (subtotal = ? AND id "+cmp+" ?)",
+				filter.Cursor.Value, filter.Cursor.Value, filter.Cursor.ID)
+		}
+		query = query.Order("subtotal " + direction).Order("id " + direction)
+	default:
+		if filter.Cursor != nil {
+			query = query.Where("id "+cmp+" ?", filter.Cursor.ID)
+		}
+		query = query.Order("id " + direction)
+	}
+
+	var orders []Order
+	err := query.Limit(filter.NormalizedLimit() + 1).Find(&orders).Error
+	for i := range orders {
+		orders[i].Basket.applyLocation()
+	}
+	return orders, err
+}
+
+// Update updates an existing order's own columns, leaving associations untouched
 func (r *orderRepository) Update(order *Order) error {
-	return r.db.Save(order).Error
+	return r.db.Omit(clause.Associations).Save(order).Error
+}
+
+// UpdateStatus persists the order's current status and records the transition
+func (r *orderRepository) UpdateStatus(order *Order, from OrderStatus, reason string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(order).Update("order_status", order.OrderStatus).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrderStatusHistory{
+			OrderID:    order.ID,
+			FromStatus: from,
+			ToStatus:   order.OrderStatus,
+			Reason:     reason,
+		}).Error
+	})
+}
+
+// FindStatusHistory returns the status transitions of an order, oldest first
+func (r *orderRepository) FindStatusHistory(orderID uint) ([]OrderStatusHistory, error) {
+	var history []OrderStatusHistory
+	err := r.db.Where("order_id = ?", orderID).Order("id").Find(&history).Error
+	return history, err
+}
+
+// FindDueForRelease returns held orders whose release time has passed,
+// skipping ones that failed or were canceled while held. Release times are
+// stored in local time, like created_at.
+func (r *orderRepository) FindDueForRelease(now time.Time) ([]Order, error) {
+	var orders []Order
+	err := r.db.
+		Where("released_at IS NULL AND release_at <= ?", now.Local()).
+		Where("order_status NOT IN ?", []OrderStatus{Failed, Canceled}).
+		Order("release_at").
+		Find(&orders).Error
+	return orders, err
+}
+
+func (r *orderRepository) withDetails() *gorm.DB {
+	return r.db.
+		Preload("Basket.BasketItems.MenuItem.Overrides").
+		Preload("Basket.BasketItems.Modifiers").
+		Preload("DeliveryData").
+		Preload("Payments")
 }
 
 // DeliveryDataRepository handles database operations for delivery data
 type DeliveryDataRepository interface {
 	Create(deliveryData *delivery.DeliveryData) error
 	FindByOrderID(orderID uint) (*delivery.DeliveryData, error)
+	FindByExternalDeliveryID(externalDeliveryID string) (*delivery.DeliveryData, error)
 	Update(deliveryData *delivery.DeliveryData) error
 }
 
@@ -67,6 +195,13 @@ func (r *deliveryDataRepository) FindByOrderID(orderID uint) (*delivery.Delivery
 	return &deliveryData, err
 }
 
+// FindByExternalDeliveryID finds delivery data by the ID we gave the provider
+func (r *deliveryDataRepository) FindByExternalDeliveryID(externalDeliveryID string) (*delivery.DeliveryData, error) {
+	var deliveryData delivery.DeliveryData
+	err := r.db.Where("external_delivery_id = ?", externalDeliveryID).First(&deliveryData).Error
+	return &deliveryData, err
+}
+
 // Update updates existing delivery data
 func (r *deliveryDataRepository) Update(deliveryData *delivery.DeliveryData) error {
 	return r.db.Save(deliveryData).Error
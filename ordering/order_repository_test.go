@@ -0,0 +1,98 @@
+package ordering
+
+import (
+	"testing"
+)
+
+func TestListOrders_PaginatesBySubtotal(t *testing.T) {
+	orderRepo := NewOrderRepository(newTestDB(t))
+	service := &orderService{orderRepo: orderRepo}
+
+	for _, subtotal := range []int{500, 300, 500, 900, 100} {
+		if err := orderRepo.Create(&Order{OrderStatus: Unpaid, Subtotal: subtotal}); err != nil {
+			t.Fatalf("unexpected error creating order: %v", err)
+		}
+	}
+
+	filter := OrderListFilter{SortBy: SortBySubtotal, Descending: true, Limit: 2}
+	var subtotals []int
+	for page := 0; page < 5; page++ {
+		orders, next, err := service.ListOrders(filter)
+		if err != nil {
+			t.Fatalf("unexpected error listing orders: %v", err)
+		}
+		for _, order := range orders {
+			subtotals = append(subtotals, order.Subtotal)
+		}
+		if next == nil {
+			break
+		}
+		// Round-trip the cursor the way a client would
+		filter.Cursor, err = DecodeOrderCursor(next.Encode())
+		if err != nil {
+			t.Fatalf("unexpected error decoding cursor: %v", err)
+		}
+	}
+
+	want := []int{900, 500, 500, 300, 100}
+	if len(subtotals) != len(want) {
+		t.Fatalf("expected %v, got %v", want, subtotals)
+	}
+	for i := range want {
+		if subtotals[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, subtotals)
+		}
+	}
+}
+
+func TestListOrders_FiltersByStatusAndDelivery(t *testing.T) {
+	orderRepo := NewOrderRepository(newTestDB(t))
+
+	orders := []Order{
+		{OrderStatus: Unpaid, IsDelivery: true},
+		{OrderStatus: Paid, IsDelivery: true},
+		{OrderStatus: Paid, IsDelivery: false},
+	}
+	for i := range orders {
+		if err := orderRepo.Create(&orders[i]); err != nil {
+			t.Fatalf("unexpected error creating order: %v", err)
+		}
+	}
+
+	isDelivery := true
+	found, err := orderRepo.FindAll(OrderListFilter{
+		Statuses:   []OrderStatus{Paid},
+		IsDelivery: &isDelivery,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error listing orders: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != orders[1].ID {
+		t.Errorf("expected only order %d, got %+v", orders[1].ID, found)
+	}
+}
+
+func TestMigrateOrderTotals_SplitsDeliveryFeeOutOfSubtotal(t *testing.T) {
+	db := newTestDB(t)
+	legacy := &Order{OrderStatus: Paid, Subtotal: 1500, DeliveryFee: 500, Tip: 200}
+	priced := &Order{OrderStatus: Paid, Subtotal: 1000, Tax: 90, Total: 1090}
+	for _, order := range []*Order{legacy, priced} {
+		if err := db.Create(order).Error; err != nil {
+			t.Fatalf("failed to seed order: %v", err)
+		}
+	}
+
+	if err := MigrateOrderTotals(db); err != nil {
+		t.Fatalf("unexpected error migrating totals: %v", err)
+	}
+
+	var migrated, untouched Order
+	db.First(&migrated, legacy.ID)
+	if migrated.Subtotal != 1000 || migrated.Total != 1700 {
+		t.Errorf("expected subtotal 1000 making 1700, got %d making %d", migrated.Subtotal, migrated.Total)
+	}
+	db.First(&untouched, priced.ID)
+	if untouched.Subtotal != 1000 || untouched.Total != 1090 {
+		t.Errorf("expected a priced order left alone, got %d making %d", untouched.Subtotal, untouched.Total)
+	}
+}
@@ -0,0 +1,158 @@
+package ordering
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"folo/store"
+)
+
+const (
+	// maxScheduleAhead is how far ahead an order can be scheduled
+	maxScheduleAhead = 7 * 24 * time.Hour
+	// deliveryLeadTime is how long before a scheduled delivery's slot the
+	// driver is sent for it
+	deliveryLeadTime = 30 * time.Minute
+)
+
+// prepTime is how long the kitchen takes to make a basket on its own: as
+// long as its slowest item, since items are made side by side. Items without
+// a prep time of their own take the location's.
+func prepTime(basket *Basket, profile *store.Store) time.Duration {
+	minutes := profile.PrepMinutes
+	if len(basket.BasketItems) > 0 {
+		minutes = 0
+	}
+	for _, item := range basket.BasketItems {
+		itemMinutes := item.MenuItem.PrepMinutes
+		if itemMinutes == 0 {
+			itemMinutes = profile.PrepMinutes
+		}
+		minutes = max(minutes, itemMinutes)
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// slotReadyTime is when an order for the slot must be ready: at the slot for
+// pickup, or the driver's lead time before it for delivery
+func slotReadyTime(slot time.Time, isDelivery bool) time.Time {
+	if isDelivery {
+		return slot.Add(-deliveryLeadTime)
+	}
+	return slot
+}
+
+// readyTime is when the order is promised: for its slot when scheduled,
+// otherwise its prep time from now plus the location's load factor for each
+// ticket the kitchen has yet to make. A load that can't be read is logged
+// and left out.
+func (s *orderService) readyTime(basket *Basket, profile *store.Store, req OrderReq, now time.Time) time.Time {
+	if req.ScheduledFor != nil {
+		return slotReadyTime(*req.ScheduledFor, req.IsDelivery())
+	}
+	ready := now.Add(prepTime(basket, profile))
+	if profile.LoadMinutesPerTicket == 0 {
+		return ready
+	}
+	load, err := s.kitchen.Load(profile.ID)
+	if err != nil {
+		log.Printf("failed to read the kitchen load at location %d: %v", profile.ID, err)
+		return ready
+	}
+	return ready.Add(time.Duration(load*int64(profile.LoadMinutesPerTicket)) * time.Minute)
+}
+
+// checkSlot checks a scheduled order can be made in time for its slot and
+// that the location is open then
+func checkSlot(profile *store.Store, prep time.Duration, slot time.Time, isDelivery bool, now time.Time) error {
+	if slot.Sub(now) > maxScheduleAhead {
+		return fmt.Errorf("%w: orders can be scheduled at most %d days ahead", ErrInvalidOrderRequest, int(maxScheduleAhead.Hours()/24))
+	}
+	if release := slotReadyTime(slot, isDelivery).Add(-prep); release.Before(now) {
+		lead := slot.Sub(release)
+		return fmt.Errorf("%w: scheduledFor must be at least %d minutes away", ErrInvalidOrderRequest, int(lead.Minutes()))
+	}
+	if !profile.IsOpen(slot) {
+		return fmt.Errorf("%w at %s", store.ErrClosed, slot.In(profile.TimeZone()).Format("Mon Jan 2 15:04"))
+	}
+	return nil
+}
+
+// schedule promises the order for readyAt. An order for a slot is held until
+// its prep time before then; any other is released straight away. Times are
+// kept in local time so they compare in the database.
+func schedule(order *Order, readyAt time.Time, prep time.Duration, scheduledFor *time.Time, now time.Time) {
+	ready := readyAt.Local()
+	order.ReadyAt = &ready
+	if scheduledFor == nil {
+		releasedAt := now.Local()
+		order.ReleasedAt = &releasedAt
+		return
+	}
+	slot := scheduledFor.Local()
+	release := ready.Add(-prep)
+	order.ScheduledFor = &slot
+	order.ReleaseAt = &release
+}
+
+// ReleaseScheduledOrders releases held orders whose release time has passed:
+// deliveries are requoted, since the checkout quote will have expired, then
+// paid orders go to the kitchen and out for delivery. A delivery that can't
+// be requoted stays held and is tried again on the next run; a failed
+// dispatch is logged and left for DispatchOrder to retry. It returns the
+// released orders.
+func (s *orderService) ReleaseScheduledOrders(now time.Time) ([]Order, error) {
+	due, err := s.orderRepo.FindDueForRelease(now)
+	if err != nil {
+		return nil, err
+	}
+	released := make([]Order, 0, len(due))
+	for i := range due {
+		order := &due[i]
+		if order.IsDelivery {
+			if err := s.requoteDelivery(order); err != nil {
+				log.Printf("failed to requote delivery for order %d, keeping it held: %v", order.ID, err)
+				continue
+			}
+		}
+
+		releasedAt := now.Local()
+		order.ReleasedAt = &releasedAt
+		if err := s.orderRepo.Update(order); err != nil {
+			return released, err
+		}
+		log.Printf("scheduled order %d released", order.ID)
+		s.sendToKitchen(order)
+		s.dispatchIfReady(order)
+		released = append(released, *order)
+	}
+	return released, nil
+}
+
+// requoteDelivery replaces a held order's delivery quote with a fresh one.
+// The customer keeps the delivery fee they were charged at checkout.
+func (s *orderService) requoteDelivery(order *Order) error {
+	profile, err := s.stores.Find(order.StoreID)
+	if err != nil {
+		return err
+	}
+	deliveryData, err := s.deliveryDataRepo.FindByOrderID(order.ID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.requestQuote(profile, deliveryData, order.Subtotal, order.ReadyAt)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDeliveryQuoteFailed, err)
+	}
+	deliveryData.Provider = result.Provider
+	deliveryData.ExternalDeliveryID = result.Response.ExternalDeliveryID
+	deliveryData.QuoteID = result.Response.ID
+	deliveryData.ProviderFee = result.Response.Fee
+	if err := s.deliveryDataRepo.Update(deliveryData); err != nil {
+		return err
+	}
+	order.DeliveryData = deliveryData
+	return nil
+}
@@ -2,23 +2,72 @@ package ordering
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"folo/delivery"
-	"folo/payment"
+	"folo/kitchen"
+	"folo/store"
+)
+
+var (
+	// ErrRefundFailed is returned when the payment for a canceled order could not be reversed
+	ErrRefundFailed = errors.New("refund failed")
+	// ErrDeliveryCancelFailed is returned when the delivery provider refused the cancellation
+	ErrDeliveryCancelFailed = errors.New("delivery cancellation failed")
+	// ErrPaymentDeclined is returned when the payment gateway declines the charge
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrDeliveryQuoteFailed is returned when no delivery quote could be obtained
+	ErrDeliveryQuoteFailed = errors.New("delivery quote failed")
+	// ErrDispatchFailed is returned when the delivery provider did not accept the delivery
+	ErrDispatchFailed = errors.New("delivery dispatch failed")
+	// ErrNotDispatchable is returned when an order has no quoted delivery or is not paid
+	ErrNotDispatchable = errors.New("order cannot be dispatched")
 )
 
 // OrderService handles order business logic
 type OrderService interface {
 	CreateOrder(req OrderReq) (*Order, error)
+	UpdateOrderStatus(orderID uint, status OrderStatus, reason string) (*Order, error)
+	GetOrder(id uint) (*Order, error)
+	ListOrders(filter OrderListFilter) ([]Order, *OrderCursor, error)
+	CancelOrder(id uint, reason string) (*Order, error)
+	CaptureOrderPayment(orderID uint, adj CaptureAdjustment) (*Order, error)
+	ConfirmCryptoPayment(orderID uint, transactionHash string) (*Order, error)
+	DispatchOrder(orderID uint) (*Order, error)
+	HandleDeliveryEvent(event delivery.WebhookEvent) error
+	QuoteDelivery(basketID uint, dropoff *delivery.DeliveryData) (*DeliveryQuote, error)
+	GetReceipt(orderID uint) (*Receipt, error)
+	ReleaseScheduledOrders(now time.Time) ([]Order, error)
+}
+
+// DeliveryOptions groups what the service needs to deliver orders. Geocoder
+// and Zones are optional; without Quotes an in-memory store is used.
+type DeliveryOptions struct {
+	Providers *delivery.Registry
+	Geocoder  delivery.Geocoder
+	Zones     *delivery.Zones
+	Quotes    QuoteStore
 }
 
 type orderService struct {
 	orderRepo        OrderRepository
 	basketRepo       BasketRepository
 	deliveryDataRepo DeliveryDataRepository
-	deliveryService  delivery.DeliveryService
+	paymentRepo      PaymentRepository
+	uow              UnitOfWork
+	stores           *store.Service
+	kitchen          *kitchen.Service
+	deliveries       *delivery.Registry
+	geocoder         delivery.Geocoder
+	zones            *delivery.Zones
+	quotes           QuoteStore
+	payments         PaymentProviders
+	// quoteTimeout is how long checkout waits for a delivery quote
+	quoteTimeout time.Duration
 }
 
 // NewOrderService creates a new order service
@@ -26,118 +75,640 @@ func NewOrderService(
 	orderRepo OrderRepository,
 	basketRepo BasketRepository,
 	deliveryDataRepo DeliveryDataRepository,
-	deliveryService delivery.DeliveryService,
+	paymentRepo PaymentRepository,
+	uow UnitOfWork,
+	stores *store.Service,
+	kitchenService *kitchen.Service,
+	deliveryOptions DeliveryOptions,
+	payments PaymentProviders,
 ) OrderService {
+	if deliveryOptions.Quotes == nil {
+		deliveryOptions.Quotes = NewQuoteStore()
+	}
 	return &orderService{
 		orderRepo:        orderRepo,
 		basketRepo:       basketRepo,
 		deliveryDataRepo: deliveryDataRepo,
-		deliveryService:  deliveryService,
+		paymentRepo:      paymentRepo,
+		uow:              uow,
+		stores:           stores,
+		kitchen:          kitchenService,
+		deliveries:       deliveryOptions.Providers,
+		geocoder:         deliveryOptions.Geocoder,
+		zones:            deliveryOptions.Zones,
+		quotes:           deliveryOptions.Quotes,
+		payments:         payments,
+		quoteTimeout:     5 * time.Second,
 	}
 }
 
-// CreateOrder creates a new order from a basket
+// CreateOrder creates a new order from a basket. The delivery quote and any
+// card hold or crypto payment request are settled first, so no provider call
+// holds the database. The order, its delivery data, the gift card redemption
+// and the payment records are then written in one transaction; a hold the
+// transaction doesn't record is voided. A failed quote or a declined payment
+// leaves the order FAILED. An order for a later slot is paid for now but held
+// until ReleaseScheduledOrders releases it.
 func (s *orderService) CreateOrder(req OrderReq) (*Order, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	// Nothing is written for an order that can't be paid for
+	if err := s.checkPaymentSupported(req); err != nil {
+		return nil, err
+	}
+
 	basket, err := s.basketRepo.FindByIDWithItems(req.BasketId)
 	if err != nil {
 		return nil, err
 	}
+	// The menu may have changed since the items went in the basket
+	if err := basket.checkOrderable(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	profile, err := s.openStore(basket, now, req)
+	if err != nil {
+		return nil, err
+	}
+	prep := prepTime(basket, profile)
+	readyAt := s.readyTime(basket, profile, req, now)
 
 	orderTotal := basket.CalculateTotal()
 
-	quoteChan := make(chan *delivery.QuoteResult, 1)
-	// If delivery order, launch async goroutine to get quote from DoorDash
+	// Normalize the dropoff and turn away ones we don't deliver to before
+	// asking anyone for a quote
+	var zone *delivery.ZoneMatch
+	var quote *delivery.QuoteResult
 	if req.IsDelivery() {
-		go s.handleDeliveryQuote(req, orderTotal, quoteChan)
+		if err := s.locateDropoff(req.DeliveryData); err != nil {
+			return nil, err
+		}
+		if zone, err = s.matchZone(profile, req.DeliveryData, orderTotal); err != nil {
+			return nil, err
+		}
+		quote = s.awaitQuote(profile, req, orderTotal, readyAt)
 	}
 
-	// Create the order - not waiting for routine to finish
 	order := &Order{
-		OrderStatus: Processing,
+		OrderStatus: Unpaid,
+		PaymentType: req.PaymentType,
 		IsDelivery:  req.IsDelivery(),
+		StoreID:     profile.ID,
 		BasketID:    req.BasketId,
 		Subtotal:    orderTotal,
+		Tip:         req.Tip,
+		Notes:       req.Notes,
 	}
-	if err := s.orderRepo.Create(order); err != nil {
-		return nil, err
+	schedule(order, readyAt, prep, req.ScheduledFor, now)
+	if quote != nil && quote.Error == nil {
+		order.DeliveryFee = int(deliveryFee(quote, zone))
 	}
-	log.Printf("order created with orderID: %v", order.ID)
+	order.price(profile.Tax(), basket.TaxLines())
 
-	// If delivery order, wait for quote
-	if order.IsDelivery {
-		select {
-		case result := <-quoteChan:
-			s.addDeliveryToOrder(result, order, req)
-			if result.Error != nil {
-				log.Printf("quote failed with error: %v", result.Error.Error())
-				order.OrderStatus = Failed
-				return order, result.Error
-			}
-		case <-time.After(5 * time.Second):
-			log.Printf("Timeout waiting for delivery quote for order %d", order.ID)
-			// Could update delivery status to "quote_timeout" here
+	// A failed quote fails the order before anything is charged
+	var hold *processorHold
+	if quote == nil || quote.Error == nil {
+		if hold, err = s.placeHold(order, req); err != nil {
+			return nil, err
 		}
 	}
 
-	// Process payment for all orders (pickup and delivery)
-	err = processOrderWithPayment(order, *req.PaymentData)
+	var quoteErr, payErr error
+	err = s.uow.Do(func(repos Repositories) error {
+		tx := s.withRepositories(repos)
+		err := tx.placeOrder(order, req, zone, quote)
+		if errors.Is(err, ErrDeliveryQuoteFailed) {
+			quoteErr = err
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// A declined payment leaves the order FAILED, which is a result to keep
+		if err := tx.payOrder(order, req, hold); err != nil {
+			if order.OrderStatus != Failed {
+				return err
+			}
+			payErr = err
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("error paying for order: %v", err)
+		log.Printf("order creation rolled back: %v", err)
+		s.abandonPayment(hold)
+		return nil, err
+	}
+	if hold != nil && !hold.recorded {
+		s.abandonPayment(hold)
+	}
+	if quoteErr != nil {
+		return order, quoteErr
+	}
+	if payErr != nil {
+		log.Printf("payment failed for order %d: %v", order.ID, payErr)
+		return order, nil
 	}
 
+	s.sendToKitchen(order)
+	s.dispatchIfReady(order)
 	return order, nil
 }
 
-func (s *orderService) addDeliveryToOrder(result *delivery.QuoteResult, order *Order, req OrderReq) {
-	deliveryData := &delivery.DeliveryData{
-		Address:     req.DeliveryData.Address,
-		PhoneNumber: req.DeliveryData.PhoneNumber,
-		OrderID:     order.ID,
+// awaitQuote returns the delivery quote for an order: the one shown before
+// checkout while it's still good, or a fresh one from the providers. A
+// provider that doesn't answer within the quote timeout is a failed quote.
+func (s *orderService) awaitQuote(profile *store.Store, req OrderReq, orderTotal int, readyAt time.Time) *delivery.QuoteResult {
+	key := deliveryQuoteKey(req.BasketId, orderTotal, req.DeliveryData)
+	// A quote can only be accepted once
+	if cached, ok := s.quotes.Take(key, time.Now()); ok {
+		return cached
+	}
+
+	quoteChan := make(chan *delivery.QuoteResult, 1)
+	go s.handleDeliveryQuote(profile, req, orderTotal, readyAt, quoteChan)
+	select {
+	case result := <-quoteChan:
+		return result
+	case <-time.After(s.quoteTimeout):
+		return &delivery.QuoteResult{Error: fmt.Errorf("no quote within %s", s.quoteTimeout)}
+	}
+}
+
+// placeOrder writes the order and adds its delivery. It expects to run
+// inside a unit of work.
+func (s *orderService) placeOrder(order *Order, req OrderReq, zone *delivery.ZoneMatch, quote *delivery.QuoteResult) error {
+	if err := s.orderRepo.Create(order); err != nil {
+		return err
+	}
+	log.Printf("order created with orderID: %v", order.ID)
+
+	if !order.IsDelivery {
+		return nil
+	}
+	if quote.Error != nil {
+		log.Printf("quote failed with error: %v", quote.Error.Error())
+		if err := s.transition(order, Failed, "delivery quote failed"); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrDeliveryQuoteFailed, quote.Error)
+	}
+	return s.addDeliveryToOrder(quote, zone, order, req)
+}
+
+// deliveryFee is what the customer pays for a quote, as overridden or
+// subsidized by the dropoff's zone
+func deliveryFee(result *delivery.QuoteResult, zone *delivery.ZoneMatch) int64 {
+	if zone != nil {
+		return zone.Fee(result.Response.Fee)
 	}
+	return result.Response.Fee
+}
 
+// addDeliveryToOrder records the chosen quote against the order
+func (s *orderService) addDeliveryToOrder(result *delivery.QuoteResult, zone *delivery.ZoneMatch, order *Order, req OrderReq) error {
+	deliveryData := &delivery.DeliveryData{
+		Address:             req.DeliveryData.Address,
+		PhoneNumber:         req.DeliveryData.PhoneNumber,
+		Unit:                req.DeliveryData.Unit,
+		DropoffInstructions: req.DeliveryData.DropoffInstructions,
+		Lat:                 req.DeliveryData.Lat,
+		Lng:                 req.DeliveryData.Lng,
+		OrderID:             order.ID,
+		Provider:            result.Provider,
+		ExternalDeliveryID:  result.Response.ExternalDeliveryID,
+		QuoteID:             result.Response.ID,
+		ProviderFee:         result.Response.Fee,
+	}
+	if zone != nil {
+		deliveryData.Zone = zone.Zone.Name
+	}
 	if err := s.deliveryDataRepo.Create(deliveryData); err != nil {
-		log.Printf("failed to create delivery data: %s", err.Error())
-		// Order already created, just log the error
+		return fmt.Errorf("failed to create delivery data: %w", err)
+	}
+	order.DeliveryData = deliveryData
+	return nil
+}
+
+// locateDropoff replaces the entered address with the geocoder's normalized
+// one and its location. Coordinates sent with the address are dropped, so a
+// dropoff is only ever placed where the geocoder puts it. Without a geocoder
+// the address is sent to providers as entered.
+func (s *orderService) locateDropoff(dropoff *delivery.DeliveryData) error {
+	dropoff.Lat, dropoff.Lng = nil, nil
+	if s.geocoder == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	address, err := s.geocoder.Geocode(ctx, dropoff.Address)
+	if err != nil {
+		return err
+	}
+	dropoff.ApplyAddress(address)
+	return nil
+}
+
+// matchZone finds the delivery zone for a dropoff from the location making
+// the order. Without configured zones every dropoff is accepted and nil is
+// returned.
+func (s *orderService) matchZone(profile *store.Store, dropoff *delivery.DeliveryData, orderTotal int) (*delivery.ZoneMatch, error) {
+	if s.zones == nil {
+		return nil, nil
+	}
+	location, ok := dropoff.Location()
+	if !ok {
+		return nil, delivery.ErrDropoffLocationRequired
+	}
+	var origin *delivery.Point
+	if profile.Lat != nil && profile.Lng != nil {
+		origin = &delivery.Point{Lat: *profile.Lat, Lng: *profile.Lng}
+	}
+	return s.zones.Match(origin, location, orderTotal)
+}
+
+// withRepositories returns a copy of the service that works through repos,
+// with gateways that keep records in our database bound to the same transaction
+func (s *orderService) withRepositories(repos Repositories) *orderService {
+	tx := *s
+	tx.orderRepo = repos.Orders
+	tx.basketRepo = repos.Baskets
+	tx.deliveryDataRepo = repos.DeliveryData
+	tx.paymentRepo = repos.Payments
+	if repos.db != nil {
+		tx.payments = s.payments.withDB(repos.db)
+	}
+	return &tx
+}
+
+// openStore returns the basket's location if it is taking online orders at
+// now and can make the order when it's wanted: now, or the scheduled slot.
+// Baskets without a location are ordered from the default one.
+func (s *orderService) openStore(basket *Basket, now time.Time, req OrderReq) (*store.Store, error) {
+	profile, err := s.stores.Find(basket.StoreID)
+	if err != nil {
+		return nil, err
 	}
-	order.Subtotal = order.Subtotal + int(result.Response.Fee)
+	if profile.IsPaused(now) {
+		return nil, store.ErrPaused
+	}
+	if req.ScheduledFor != nil {
+		if err := checkSlot(profile, prepTime(basket, profile), *req.ScheduledFor, req.IsDelivery(), now); err != nil {
+			return nil, err
+		}
+		return profile, nil
+	}
+	if !profile.IsOpen(now) {
+		return nil, store.ErrClosed
+	}
+	return profile, nil
 }
 
 // handleDeliveryQuote handles the async delivery quote request
-func (s *orderService) handleDeliveryQuote(req OrderReq, orderTotal int, resultChan chan<- *delivery.QuoteResult) {
+func (s *orderService) handleDeliveryQuote(profile *store.Store, req OrderReq, orderTotal int, readyAt time.Time, resultChan chan<- *delivery.QuoteResult) {
+	result, err := s.requestQuote(profile, req.DeliveryData, orderTotal, &readyAt)
+	if err != nil {
+		log.Printf("delivery quote error: %s", err.Error())
+		result = &delivery.QuoteResult{Error: err}
+	}
+	resultChan <- result
+}
+
+// requestQuote compares quotes for delivering from a location to a dropoff
+// from every enabled provider under one deadline, asking for pickup once the
+// order is ready
+func (s *orderService) requestQuote(profile *store.Store, dropoff *delivery.DeliveryData, orderTotal int, readyAt *time.Time) (*delivery.QuoteResult, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3000*time.Millisecond)
 	defer cancel()
 
-	// TODO: Replace with actual restaurant pickup details from config
 	params := delivery.DeliveryQuoteParams{
-		PickupAddress:      "303 2nd St, San Francisco, CA 94107",
-		PickupPhoneNumber:  "+18564567890",
-		DropoffAddress:     req.DeliveryData.Address,
-		DropoffPhoneNumber: req.DeliveryData.PhoneNumber,
-		OrderValue:         orderTotal,
+		PickupAddress:       profile.Address,
+		PickupPhoneNumber:   profile.PhoneNumber,
+		PickupBusinessName:  profile.Name,
+		PickupInstructions:  profile.PickupInstructions,
+		PickupLat:           profile.Lat,
+		PickupLng:           profile.Lng,
+		PickupTime:          readyAt,
+		DropoffAddress:      dropoff.Address,
+		DropoffPhoneNumber:  dropoff.PhoneNumber,
+		DropoffInstructions: dropoff.DropoffInstructions,
+		OrderValue:          orderTotal,
+	}
+	return s.deliveries.RequestQuote(ctx, params)
+}
+
+// QuoteDelivery prices delivering a basket to a dropoff before checkout. The
+// quote is stored so CreateOrder can reuse it until it expires; asking again
+// for the same basket and address returns the stored quote.
+func (s *orderService) QuoteDelivery(basketID uint, dropoff *delivery.DeliveryData) (*DeliveryQuote, error) {
+	basket, err := s.basketRepo.FindByIDWithItems(basketID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.stores.Find(basket.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	orderTotal := basket.CalculateTotal()
+
+	if err := s.locateDropoff(dropoff); err != nil {
+		return nil, err
+	}
+	zone, err := s.matchZone(profile, dropoff, orderTotal)
+	if err != nil {
+		return nil, err
+	}
+
+	key := deliveryQuoteKey(basketID, orderTotal, dropoff)
+	result, ok := s.quotes.Get(key, time.Now())
+	if !ok {
+		readyAt := s.readyTime(basket, profile, OrderReq{DeliveryData: dropoff}, time.Now())
+		if result, err = s.requestQuote(profile, dropoff, orderTotal, &readyAt); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDeliveryQuoteFailed, err)
+		}
+		s.quotes.Put(key, result)
 	}
 
-	result, err := s.deliveryService.RequestQuote(ctx, params)
+	quote := &DeliveryQuote{
+		Provider:             result.Provider,
+		QuoteID:              result.Response.ID,
+		Fee:                  result.Response.Fee,
+		ProviderFee:          result.Response.Fee,
+		Address:              dropoff.Address,
+		Unit:                 dropoff.Unit,
+		ExpiresAt:            result.Response.ExpiresAt,
+		DropoffTimeEstimated: result.Response.DropoffTimeEstimated,
+	}
+	if zone != nil {
+		quote.Zone = zone.Zone.Name
+		quote.Fee = zone.Fee(result.Response.Fee)
+	}
+	return quote, nil
+}
+
+// DispatchOrder sends a dasher for a paid delivery order, e.g. to retry a
+// dispatch that failed at checkout
+func (s *orderService) DispatchOrder(orderID uint) (*Order, error) {
+	order, err := s.orderRepo.FindByIDWithDetails(orderID)
 	if err != nil {
-		log.Printf("DoorDash quote error: %s", err.Error())
+		return nil, err
 	}
+	if !order.IsDelivery || order.DeliveryData == nil || order.DeliveryData.ExternalDeliveryID == "" {
+		return order, fmt.Errorf("%w: no delivery quote", ErrNotDispatchable)
+	}
+	if !readyForDispatch(order) {
+		return order, fmt.Errorf("%w: order is %s", ErrNotDispatchable, order.OrderStatus)
+	}
+	if order.IsHeld() {
+		return order, fmt.Errorf("%w: order is scheduled for %s", ErrNotDispatchable, order.ScheduledFor.Format(time.RFC3339))
+	}
+	return order, s.dispatchDelivery(order)
+}
 
-	log.Printf("DoorDash quote received: Fee=%d, ID=%s", result.Fee, result.ID)
-	resultChan <- &delivery.QuoteResult{
-		Response: result,
-		Error:    err,
+// readyForDispatch reports whether payment allows the order to be made and
+// sent out. Cash is collected on handover, so cash orders don't wait for payment.
+func readyForDispatch(order *Order) bool {
+	switch order.OrderStatus {
+	case Paid, Processing:
+		return true
+	case Unpaid:
+		return order.PaymentType == Cash
 	}
+	return false
 }
 
-func processOrderWithPayment(o *Order, p *payment.PaymentData) error {
-	pg := payment.NewPaymentGateway()
+// dispatchIfReady dispatches a released delivery order whose payment has
+// succeeded. A failed dispatch is logged and left for DispatchOrder to retry.
+func (s *orderService) dispatchIfReady(order *Order) {
+	if !order.IsDelivery || order.IsHeld() || !readyForDispatch(order) {
+		return
+	}
+	if order.DeliveryData == nil {
+		deliveryData, err := s.deliveryDataRepo.FindByOrderID(order.ID)
+		if err != nil {
+			log.Printf("no delivery data to dispatch order %d: %v", order.ID, err)
+			return
+		}
+		order.DeliveryData = deliveryData
+	}
+	if err := s.dispatchDelivery(order); err != nil {
+		log.Printf("failed to dispatch order %d: %v", order.ID, err)
+	}
+}
+
+// dispatchDelivery accepts the order's delivery quote and stores the
+// provider's delivery details. Already dispatched deliveries are left alone.
+func (s *orderService) dispatchDelivery(order *Order) error {
+	deliveryData := order.DeliveryData
+	if deliveryData.ProviderDeliveryID != "" {
+		return nil
+	}
+
+	provider, err := s.deliveries.Get(deliveryData.Provider)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDispatchFailed, err)
+	}
 
-	payResult := pg.ProcessPayment(p)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	if payResult {
-		o.OrderStatus = Processing
-	} else {
-		o.OrderStatus = Failed
+	res, err := provider.AcceptQuote(ctx, deliveryData.ExternalDeliveryID, delivery.AcceptQuoteRequest{
+		DropoffPhoneNumber: deliveryData.PhoneNumber,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDispatchFailed, err)
+	}
+	deliveryData.ApplyResponse(res)
+	if deliveryData.Status == "" {
+		deliveryData.Status = Pending
 	}
+	return s.deliveryDataRepo.Update(deliveryData)
+}
 
+// HandleDeliveryEvent records a provider webhook on the order's delivery and
+// moves the order along: PROCESSING once a dasher has it, COMPLETED once it
+// has been delivered, and CANCELED with its payment given back when the
+// provider gave up on it. The order is brought in line with the delivery's
+// status on every event, even one that changes nothing, so a provider
+// retrying an event whose capture failed finishes the job.
+func (s *orderService) HandleDeliveryEvent(event delivery.WebhookEvent) error {
+	deliveryData, err := s.deliveryDataRepo.FindByExternalDeliveryID(event.ExternalDeliveryID)
+	if err != nil {
+		return err
+	}
+	if deliveryData.ApplyEvent(event) {
+		log.Printf("delivery for order %d is now %s", deliveryData.OrderID, deliveryData.Status)
+	}
+	if err := s.deliveryDataRepo.Update(deliveryData); err != nil {
+		return err
+	}
+
+	order, err := s.orderRepo.FindByID(deliveryData.OrderID)
+	if err != nil {
+		return err
+	}
+
+	switch deliveryData.Status {
+	case Dispatched, Interacted:
+		if readyForDispatch(order) && CanTransition(order.OrderStatus, Processing) {
+			return s.transition(order, Processing, fmt.Sprintf("delivery %s", strings.ToLower(string(deliveryData.Status))))
+		}
+	case Delivered:
+		if readyForDispatch(order) && CanTransition(order.OrderStatus, Processing) {
+			if err := s.transition(order, Processing, "delivery delivered"); err != nil {
+				return err
+			}
+		}
+		if CanTransition(order.OrderStatus, Completed) {
+			_, err := s.UpdateOrderStatus(order.ID, Completed, "delivered")
+			return err
+		}
+	case NotDelivered:
+		if CanTransition(order.OrderStatus, Canceled) {
+			log.Printf("delivery for order %d was not completed: %s", order.ID, event.CancellationReason)
+			reason := "delivery not completed"
+			if event.CancellationReason != "" {
+				reason = fmt.Sprintf("%s: %s", reason, event.CancellationReason)
+			}
+			return s.cancel(order, reason)
+		}
+	}
+	return nil
+}
+
+// GetOrder returns an order with its basket items and delivery data
+func (s *orderService) GetOrder(id uint) (*Order, error) {
+	return s.orderRepo.FindByIDWithDetails(id)
+}
+
+// GetReceipt returns the customer's receipt for an order, headed with its
+// location's details and timed in the location's time zone
+func (s *orderService) GetReceipt(orderID uint) (*Receipt, error) {
+	order, err := s.orderRepo.FindByIDWithDetails(orderID)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := s.stores.Find(order.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	return NewReceipt(order, profile), nil
+}
+
+// ListOrders returns a page of orders and the cursor for the next page, which is
+// nil on the last page
+func (s *orderService) ListOrders(filter OrderListFilter) ([]Order, *OrderCursor, error) {
+	orders, err := s.orderRepo.FindAll(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	limit := filter.NormalizedLimit()
+	if len(orders) <= limit {
+		return orders, nil, nil
+	}
+	orders = orders[:limit]
+	next := filter.CursorFor(&orders[limit-1])
+	return orders, &next, nil
+}
+
+// CancelOrder cancels an order that has not completed yet, canceling its delivery
+// and voiding or refunding any payment taken
+func (s *orderService) CancelOrder(id uint, reason string) (*Order, error) {
+	order, err := s.orderRepo.FindByIDWithDetails(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateTransition(order.OrderStatus, Canceled); err != nil {
+		return order, err
+	}
+
+	if order.IsDelivery && order.DeliveryData != nil && order.DeliveryData.ExternalDeliveryID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		provider, err := s.deliveries.Get(order.DeliveryData.Provider)
+		if err == nil {
+			err = provider.CancelDelivery(ctx, order.DeliveryData.ExternalDeliveryID)
+		}
+		if err != nil && !errors.Is(err, delivery.ErrDeliveryNotFound) {
+			log.Printf("failed to cancel delivery for order %d: %v", order.ID, err)
+			return order, fmt.Errorf("%w: %v", ErrDeliveryCancelFailed, err)
+		}
+	}
+
+	return order, s.cancel(order, reason)
+}
+
+// cancel voids or refunds the order's payment, cancels it with reason and
+// takes its ticket off the kitchen screens
+func (s *orderService) cancel(order *Order, reason string) error {
+	if err := s.releaseOrderPayment(order); err != nil {
+		return err
+	}
+
+	// The reason is only kept if the order is canceled with it
+	previousReason := order.CancelReason
+	err := s.uow.Do(func(repos Repositories) error {
+		tx := s.withRepositories(repos)
+		order.CancelReason = reason
+		if err := tx.orderRepo.Update(order); err != nil {
+			return err
+		}
+		return tx.transition(order, Canceled, reason)
+	})
+	if err != nil {
+		order.CancelReason = previousReason
+		return err
+	}
+	if err := s.kitchen.Void(order.ID, reason); err != nil {
+		log.Printf("failed to void the kitchen ticket for order %d: %v", order.ID, err)
+	}
+	return nil
+}
+
+// UpdateOrderStatus moves an order to a new status if the transition is allowed.
+// Completing an order captures its payment; canceling goes through CancelOrder.
+func (s *orderService) UpdateOrderStatus(orderID uint, status OrderStatus, reason string) (*Order, error) {
+	if status == Canceled {
+		return s.CancelOrder(orderID, reason)
+	}
+
+	order, err := s.orderRepo.FindByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateTransition(order.OrderStatus, status); err != nil {
+		return order, err
+	}
+
+	if status == Completed {
+		if err := s.captureIfAuthorized(order); err != nil {
+			return order, err
+		}
+	}
+
+	if err := s.transition(order, status, reason); err != nil {
+		return order, err
+	}
+	return order, nil
+}
+
+// transition validates and persists an order status change, recording it in the
+// status history. Every status change in the service must go through here.
+func (s *orderService) transition(order *Order, to OrderStatus, reason string) error {
+	from := order.OrderStatus
+	if err := ValidateTransition(from, to); err != nil {
+		return err
+	}
+
+	order.OrderStatus = to
+	if err := s.orderRepo.UpdateStatus(order, from, reason); err != nil {
+		order.OrderStatus = from
+		return err
+	}
+	log.Printf("order %d moved from %s to %s", order.ID, from, to)
 	return nil
 }
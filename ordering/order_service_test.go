@@ -0,0 +1,1046 @@
+package ordering
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"folo/delivery"
+	"folo/fleet"
+	"folo/kitchen"
+	"folo/payment"
+	"folo/store"
+)
+
+// fakeDeliveryService records calls instead of talking to a provider
+type fakeDeliveryService struct {
+	quote    *delivery.CreateQuoteResponse
+	quoteErr error
+	// quoteDelay holds back the quote, as a provider that is slow to answer
+	quoteDelay time.Duration
+	quoted     int
+	params     delivery.DeliveryQuoteParams
+	accepted   []string
+	acceptErr  error
+	canceled   []string
+	cancelErr  error
+}
+
+func (f *fakeDeliveryService) RequestQuote(ctx context.Context, params delivery.DeliveryQuoteParams) (*delivery.CreateQuoteResponse, error) {
+	f.quoted++
+	f.params = params
+	time.Sleep(f.quoteDelay)
+	return f.quote, f.quoteErr
+}
+
+func (f *fakeDeliveryService) AcceptQuote(ctx context.Context, externalDeliveryID string, req delivery.AcceptQuoteRequest) (*delivery.DeliveryResponse, error) {
+	f.accepted = append(f.accepted, externalDeliveryID)
+	if f.acceptErr != nil {
+		return nil, f.acceptErr
+	}
+	return &delivery.DeliveryResponse{
+		ExternalDeliveryID: externalDeliveryID,
+		SupportReference:   "dd-" + externalDeliveryID,
+		DeliveryStatus:     "created",
+	}, nil
+}
+
+func (f *fakeDeliveryService) CreateDelivery(ctx context.Context, req delivery.CreateDeliveryRequest) (*delivery.DeliveryResponse, error) {
+	return &delivery.DeliveryResponse{ExternalDeliveryID: req.ExternalDeliveryID, DeliveryStatus: "created"}, nil
+}
+
+func (f *fakeDeliveryService) GetDelivery(ctx context.Context, externalDeliveryID string) (*delivery.DeliveryResponse, error) {
+	return nil, delivery.ErrDeliveryNotFound
+}
+
+func (f *fakeDeliveryService) UpdateDelivery(ctx context.Context, externalDeliveryID string, req delivery.UpdateDeliveryRequest) (*delivery.DeliveryResponse, error) {
+	return nil, delivery.ErrDeliveryNotFound
+}
+
+func (f *fakeDeliveryService) CancelDelivery(ctx context.Context, externalDeliveryID string) error {
+	f.canceled = append(f.canceled, externalDeliveryID)
+	return f.cancelErr
+}
+
+func TestCancelOrder_CancelsDeliveryAndRecordsReason(t *testing.T) {
+	db := newTestDB(t)
+	orderRepo := NewOrderRepository(db)
+	deliveryDataRepo := NewDeliveryDataRepository(db)
+	deliveryService := &fakeDeliveryService{cancelErr: delivery.ErrDeliveryNotFound}
+	deliveries := delivery.NewRegistry(delivery.CheapestQuote)
+	deliveries.Register(delivery.ProviderDoorDash, deliveryService)
+	service := &orderService{
+		orderRepo:   orderRepo,
+		paymentRepo: NewPaymentRepository(db),
+		uow:         NewUnitOfWork(db),
+		kitchen:     kitchen.NewService(kitchen.NewRepository(db)),
+		deliveries:  deliveries,
+	}
+
+	order := &Order{OrderStatus: Unpaid, IsDelivery: true}
+	if err := orderRepo.Create(order); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if err := deliveryDataRepo.Create(&delivery.DeliveryData{OrderID: order.ID, ExternalDeliveryID: "ext-1"}); err != nil {
+		t.Fatalf("unexpected error creating delivery data: %v", err)
+	}
+
+	canceled, err := service.CancelOrder(order.ID, "customer called")
+	if err != nil {
+		t.Fatalf("unexpected error canceling order: %v", err)
+	}
+	if canceled.OrderStatus != Canceled {
+		t.Errorf("expected CANCELED, got %s", canceled.OrderStatus)
+	}
+	if len(deliveryService.canceled) != 1 || deliveryService.canceled[0] != "ext-1" {
+		t.Errorf("expected delivery ext-1 to be canceled, got %v", deliveryService.canceled)
+	}
+
+	stored, err := orderRepo.FindByID(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error finding order: %v", err)
+	}
+	if stored.CancelReason != "customer called" {
+		t.Errorf("expected cancel reason to be stored, got %q", stored.CancelReason)
+	}
+}
+
+func TestCancelOrder_RejectsCompletedOrder(t *testing.T) {
+	orderRepo := NewOrderRepository(newTestDB(t))
+	service := &orderService{orderRepo: orderRepo}
+
+	order := &Order{OrderStatus: Completed}
+	if err := orderRepo.Create(order); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	_, err := service.CancelOrder(order.ID, "too late")
+	var transitionErr *InvalidTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("expected InvalidTransitionError, got %v", err)
+	}
+}
+
+func TestCreateOrder_PersistsFailedStatusWhenQuoteFails(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quoteErr: errors.New("provider unavailable")}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if !errors.Is(err, ErrDeliveryQuoteFailed) {
+		t.Fatalf("expected ErrDeliveryQuoteFailed, got %v", err)
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("expected the failed order to be committed: %v", err)
+	}
+	if stored.OrderStatus != Failed {
+		t.Errorf("expected stored status FAILED, got %s", stored.OrderStatus)
+	}
+	if stored.DeliveryData != nil {
+		t.Errorf("expected no delivery data without a quote, got %+v", stored.DeliveryData)
+	}
+}
+
+func TestCreateOrder_FailsWhenQuoteTimesOut(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{
+		quote:      &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-slow", Fee: 500},
+		quoteDelay: 200 * time.Millisecond,
+	}
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{})
+	service := newTestOrderService(t, db, deliveryService, gateway)
+	service.quoteTimeout = 20 * time.Millisecond
+	basket := seedBasket(t, db, 500, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if !errors.Is(err, ErrDeliveryQuoteFailed) {
+		t.Fatalf("expected ErrDeliveryQuoteFailed, got %v", err)
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("expected the failed order to be committed: %v", err)
+	}
+	if stored.OrderStatus != Failed || stored.DeliveryData != nil || stored.DeliveryFee != 0 {
+		t.Errorf("expected a FAILED order without delivery, got %s with %+v", stored.OrderStatus, stored.DeliveryData)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if len(auths) != 0 {
+		t.Errorf("expected no payment taken without a quote, got %+v", auths)
+	}
+}
+
+func TestCreateOrder_RollsBackWhenPaymentCannotBeAttempted(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	service.payments.Gift = nil
+	basket := seedBasket(t, db, 500, 1)
+
+	_, err := service.CreateOrder(OrderReq{
+		BasketId:    basket.ID,
+		PaymentType: Gift,
+		PaymentData: &payment.PaymentData{CardNumber: "GIFT", Cvv: "1234"},
+	})
+	if !errors.Is(err, ErrUnsupportedPaymentType) {
+		t.Fatalf("expected ErrUnsupportedPaymentType, got %v", err)
+	}
+
+	var orders, history int64
+	db.Model(&Order{}).Count(&orders)
+	db.Model(&OrderStatusHistory{}).Count(&history)
+	if orders != 0 || history != 0 {
+		t.Errorf("expected nothing to be committed, got %d orders and %d history rows", orders, history)
+	}
+}
+
+func TestCreateOrder_DispatchesDeliveryAfterPayment(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{
+		ExternalDeliveryID: "ext-9",
+		ID:                 "quote-9",
+		Fee:                799,
+	}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if len(deliveryService.accepted) != 1 || deliveryService.accepted[0] != "ext-9" {
+		t.Fatalf("expected quote ext-9 to be accepted, got %v", deliveryService.accepted)
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	if stored.Subtotal != 1000 || stored.DeliveryFee != 799 || stored.Total != 1799 {
+		t.Errorf("expected subtotal 1000 with fee 799 making 1799, got %d with %d making %d", stored.Subtotal, stored.DeliveryFee, stored.Total)
+	}
+	data := stored.DeliveryData
+	if data == nil || data.QuoteID != "quote-9" || data.ProviderDeliveryID != "dd-ext-9" || data.ProviderStatus != "created" {
+		t.Errorf("expected dispatched delivery details to be stored, got %+v", data)
+	}
+}
+
+func TestCreateOrder_DoesNotDispatchDeclinedOrder(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-10", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{Rules: payment.DefaultFakeRules()}))
+	basket := seedBasket(t, db, 500, 1)
+
+	order, _ := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4000000000000002"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if order.OrderStatus != Failed {
+		t.Fatalf("expected FAILED, got %s", order.OrderStatus)
+	}
+	if len(deliveryService.accepted) != 0 {
+		t.Errorf("expected no dispatch for a declined order, got %v", deliveryService.accepted)
+	}
+	if _, err := service.DispatchOrder(order.ID); !errors.Is(err, ErrNotDispatchable) {
+		t.Errorf("expected ErrNotDispatchable, got %v", err)
+	}
+}
+
+func TestCreateOrder_DispatchesWithCheapestProvider(t *testing.T) {
+	db := newTestDB(t)
+	doorDash := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-11", Fee: 900}}
+	courier := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-11", Fee: 450}}
+	service := newTestOrderService(t, db, doorDash, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	service.deliveries.Register("courier", courier)
+	basket := seedBasket(t, db, 500, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.DeliveryFee != 450 || order.DeliveryData.Provider != "courier" {
+		t.Errorf("expected the courier quote to be chosen, got fee %d from %q", order.DeliveryFee, order.DeliveryData.Provider)
+	}
+	if len(courier.accepted) != 1 || len(doorDash.accepted) != 0 {
+		t.Errorf("expected only the chosen provider to dispatch, got %v and %v", courier.accepted, doorDash.accepted)
+	}
+
+	if _, err := service.CancelOrder(order.ID, "changed mind"); err != nil {
+		t.Fatalf("unexpected error canceling order: %v", err)
+	}
+	if len(courier.canceled) != 1 || len(doorDash.canceled) != 0 {
+		t.Errorf("expected the chosen provider to cancel, got %v and %v", courier.canceled, doorDash.canceled)
+	}
+}
+
+func TestCreateOrder_InHouseDriverCompletesOrder(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{quoteErr: errors.New("doordash unavailable")}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+
+	// The fleet keeps its own tables; a separate database keeps its reads off
+	// the connection the order transaction holds
+	fleetDB := newTestDB(t)
+	if err := fleetDB.AutoMigrate(&fleet.Driver{}, &fleet.Delivery{}); err != nil {
+		t.Fatalf("failed to migrate fleet tables: %v", err)
+	}
+	drivers := fleet.NewService(fleet.NewRepository(fleetDB), fleet.Config{})
+	drivers.OnEvent(service.HandleDeliveryEvent)
+	service.deliveries.Register(delivery.ProviderInHouse, drivers)
+
+	driver, _ := drivers.CreateDriver(fleet.DriverReq{Name: "Sam"})
+	drivers.ClockIn(driver.ID)
+	basket := seedBasket(t, db, 1000, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	externalID := order.DeliveryData.ExternalDeliveryID
+	if order.DeliveryData.Provider != delivery.ProviderInHouse || order.DeliveryData.Status != Dispatched {
+		t.Fatalf("expected an in-house delivery assigned to a driver, got %+v", order.DeliveryData)
+	}
+
+	for _, status := range []DeliveryStatus{Interacted, Delivered} {
+		if _, err := drivers.UpdateStatus(externalID, driver.ID, fleet.StatusReq{Status: status}); err != nil {
+			t.Fatalf("unexpected error updating delivery to %s: %v", status, err)
+		}
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	if stored.OrderStatus != Completed || stored.DeliveryData.DasherName != "Sam" {
+		t.Errorf("expected the driver to complete the order, got %s with %+v", stored.OrderStatus, stored.DeliveryData)
+	}
+}
+
+func TestCreateOrder_AppliesDeliveryZones(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-12", Fee: 900}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	zones, err := delivery.NewZones(delivery.ZoneConfig{
+		Zones: []delivery.Zone{{Name: "core", RadiusKm: 3, MinOrderValue: 800, Fee: delivery.ZoneFee{Subsidy: 400}}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building zones: %v", err)
+	}
+	service.zones = zones
+	service.geocoder = delivery.NewOfflineGeocoder([]delivery.Address{
+		{Street: "345 Spear St", City: "San Francisco", State: "CA", ZIP: "94105", Lat: 37.79, Lng: -122.40},
+		{Street: "250 University Ave", City: "Palo Alto", State: "CA", ZIP: "94301", Lat: 37.44, Lng: -122.16},
+	})
+	basket := seedBasket(t, db, 1000, 1)
+	locateBasket(t, db, service, basket, 37.7897, -122.3972)
+
+	// Coordinates sent with the address are ignored in favor of the geocoder's
+	near, lng := 37.79, -122.40
+	req := OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "250 University Ave, Palo Alto", PhoneNumber: "+18773934448", Lat: &near, Lng: &lng},
+	}
+	if _, err := service.CreateOrder(req); !errors.Is(err, delivery.ErrOutsideDeliveryZone) {
+		t.Fatalf("expected ErrOutsideDeliveryZone, got %v", err)
+	}
+	var orders int64
+	db.Model(&Order{}).Count(&orders)
+	if orders != 0 {
+		t.Errorf("expected an out of zone order not to be stored, got %d", orders)
+	}
+
+	req.DeliveryData = &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"}
+	order, err := service.CreateOrder(req)
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.DeliveryFee != 500 || order.DeliveryData.ProviderFee != 900 || order.DeliveryData.Zone != "core" {
+		t.Errorf("expected the subsidized fee in zone core, got %d (provider %d, zone %q)",
+			order.DeliveryFee, order.DeliveryData.ProviderFee, order.DeliveryData.Zone)
+	}
+
+	// The radius is around the location making the order, so a basket from
+	// a location down the peninsula is out of zone for the same address
+	southBasket := seedBasket(t, db, 1000, 1)
+	locateBasket(t, db, service, southBasket, 37.4419, -122.1430)
+	req.BasketId = southBasket.ID
+	if _, err := service.CreateOrder(req); !errors.Is(err, delivery.ErrOutsideDeliveryZone) {
+		t.Errorf("expected ErrOutsideDeliveryZone from the other location, got %v", err)
+	}
+}
+
+func TestCreateOrder_GeocodesDropoffBeforeQuoting(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-13", Fee: 700}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	service.geocoder = delivery.NewOfflineGeocoder([]delivery.Address{
+		{Street: "345 Spear St", City: "San Francisco", State: "CA", ZIP: "94105", Lat: 37.7906, Lng: -122.3905},
+	})
+	service.zones, _ = delivery.NewZones(delivery.ZoneConfig{Zones: []delivery.Zone{{Name: "core", RadiusKm: 3}}})
+	basket := seedBasket(t, db, 1000, 1)
+	locateBasket(t, db, service, basket, 37.7897, -122.3972)
+
+	req := OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "10 Nowhere Ln", PhoneNumber: "+18773934448"},
+	}
+	if _, err := service.CreateOrder(req); !errors.Is(err, delivery.ErrAddressNotFound) {
+		t.Fatalf("expected ErrAddressNotFound, got %v", err)
+	}
+
+	req.DeliveryData = &delivery.DeliveryData{Address: "345 spear street", Unit: "#12", PhoneNumber: "+18773934448"}
+	order, err := service.CreateOrder(req)
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	data := order.DeliveryData
+	if data.Address != "345 Spear St, Apt 12, San Francisco, CA 94105" || data.Lat == nil || data.Zone != "core" {
+		t.Errorf("expected the normalized, zoned address to be stored, got %+v", data)
+	}
+}
+
+func TestQuoteDelivery_ReusesQuoteAtCheckout(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{
+		ExternalDeliveryID: "ext-30",
+		ID:                 "quote-30",
+		Fee:                650,
+		ExpiresAt:          time.Now().Add(5 * time.Minute).Format(time.RFC3339),
+	}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+
+	for range 2 {
+		quote, err := service.QuoteDelivery(basket.ID, &delivery.DeliveryData{Address: "345 Spear St"})
+		if err != nil {
+			t.Fatalf("unexpected error quoting delivery: %v", err)
+		}
+		if quote.QuoteID != "quote-30" || quote.Fee != 650 {
+			t.Fatalf("expected quote-30 for 650, got %+v", quote)
+		}
+	}
+	if deliveryService.quoted != 1 {
+		t.Fatalf("expected the second quote to come from the store, got %d provider quotes", deliveryService.quoted)
+	}
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345  Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if deliveryService.quoted != 1 {
+		t.Errorf("expected checkout to reuse the stored quote, got %d provider quotes", deliveryService.quoted)
+	}
+	if order.DeliveryFee != 650 || order.DeliveryData.QuoteID != "quote-30" {
+		t.Errorf("expected the order to use quote-30 for 650, got fee %d and %+v", order.DeliveryFee, order.DeliveryData)
+	}
+
+	// An accepted quote can't be used again
+	if _, err := service.QuoteDelivery(basket.ID, &delivery.DeliveryData{Address: "345 Spear St"}); err != nil {
+		t.Fatalf("unexpected error quoting delivery: %v", err)
+	}
+	if deliveryService.quoted != 2 {
+		t.Errorf("expected a fresh quote after checkout, got %d provider quotes", deliveryService.quoted)
+	}
+}
+
+func TestCreateOrder_RequotesWhenStoredQuoteExpires(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{
+		ExternalDeliveryID: "ext-31",
+		ID:                 "quote-31",
+		Fee:                650,
+		// Still valid, but too close to expiring to accept at checkout
+		ExpiresAt: time.Now().Add(10 * time.Second).Format(time.RFC3339),
+	}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+
+	if _, err := service.QuoteDelivery(basket.ID, &delivery.DeliveryData{Address: "345 Spear St"}); err != nil {
+		t.Fatalf("unexpected error quoting delivery: %v", err)
+	}
+	if _, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	}); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if deliveryService.quoted != 2 {
+		t.Errorf("expected checkout to re-quote an expiring quote, got %d provider quotes", deliveryService.quoted)
+	}
+}
+
+func TestQuoteDelivery_RequotesWhenBasketChanges(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{
+		ExternalDeliveryID: "ext-32",
+		Fee:                650,
+		ExpiresAt:          time.Now().Add(5 * time.Minute).Format(time.RFC3339),
+	}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+
+	if _, err := service.QuoteDelivery(basket.ID, &delivery.DeliveryData{Address: "345 Spear St"}); err != nil {
+		t.Fatalf("unexpected error quoting delivery: %v", err)
+	}
+	if err := db.Model(&BasketItem{}).Where("basket_id = ?", basket.ID).Update("quantity", 3).Error; err != nil {
+		t.Fatalf("failed to update basket: %v", err)
+	}
+	if _, err := service.QuoteDelivery(basket.ID, &delivery.DeliveryData{Address: "345 Spear St"}); err != nil {
+		t.Fatalf("unexpected error quoting delivery: %v", err)
+	}
+	if deliveryService.quoted != 2 {
+		t.Errorf("expected a changed basket to be quoted again, got %d provider quotes", deliveryService.quoted)
+	}
+}
+
+func TestCreateOrder_QuotesFromStoreProfile(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-40", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:        "Folo Mission",
+		Address:     "2128 Mission St, San Francisco, CA 94110",
+		PhoneNumber: "+14155550100",
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+	basket := seedBasket(t, db, 500, 2)
+
+	if _, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	}); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if deliveryService.params.PickupAddress != "2128 Mission St, San Francisco, CA 94110" ||
+		deliveryService.params.PickupPhoneNumber != "+14155550100" {
+		t.Errorf("expected pickup from the store profile, got %+v", deliveryService.params)
+	}
+}
+
+func TestCreateOrder_RejectsWhenStoreClosed(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	// Open for one minute, long enough ago that it's closed now
+	opens := time.Now().Add(-2 * time.Hour).UTC()
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:        "Folo",
+		Address:     "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber: "+18564567890",
+		Hours: []store.Hours{{
+			Day:    opens.Weekday().String(),
+			Opens:  opens.Format("15:04"),
+			Closes: opens.Add(time.Minute).Format("15:04"),
+		}},
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+	basket := seedBasket(t, db, 500, 1)
+
+	_, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash})
+	if !errors.Is(err, store.ErrClosed) {
+		t.Fatalf("expected store.ErrClosed, got %v", err)
+	}
+	var orders int64
+	db.Model(&Order{}).Count(&orders)
+	if orders != 0 {
+		t.Errorf("expected no order while closed, got %d", orders)
+	}
+}
+
+func TestGetReceipt_UsesStoreProfile(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:        "Folo",
+		Address:     "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber: "+18564567890",
+		Timezone:    "America/Los_Angeles",
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+	basket := seedBasket(t, db, 500, 2)
+
+	order, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash, Tip: 150})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	receipt, err := service.GetReceipt(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error getting receipt: %v", err)
+	}
+	if receipt.Store.Name != "Folo" || receipt.Store.PhoneNumber != "+18564567890" {
+		t.Errorf("expected the store's details on the receipt, got %+v", receipt.Store)
+	}
+	if receipt.PlacedAt.Location().String() != "America/Los_Angeles" {
+		t.Errorf("expected the receipt in the store's time zone, got %s", receipt.PlacedAt.Location())
+	}
+	if len(receipt.Lines) != 1 || receipt.Lines[0].Quantity != 2 || receipt.Lines[0].Total != 1000 {
+		t.Errorf("expected one line of 2 for 1000, got %+v", receipt.Lines)
+	}
+	if receipt.ItemsTotal != 1000 || receipt.Tip != 150 || receipt.Total != 1150 {
+		t.Errorf("expected 1000 + 150 tip = 1150, got %+v", receipt)
+	}
+}
+
+func TestCreateOrder_UsesBasketLocation(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-50", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	lat, lng := 37.7637, -122.4194
+	mission, err := service.stores.Create(&store.Store{
+		Name:               "Folo Mission",
+		Address:            "2128 Mission St, San Francisco, CA 94110",
+		PhoneNumber:        "+14155550100",
+		PickupInstructions: "Use the side door",
+		Lat:                &lat,
+		Lng:                &lng,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating location: %v", err)
+	}
+
+	basket := seedBasket(t, db, 500, 2)
+	price := 650
+	if err := db.Create(&MenuItemOverride{MenuItemID: basket.BasketItems[0].MenuItemID, StoreID: mission.ID, Price: &price}).Error; err != nil {
+		t.Fatalf("failed to seed override: %v", err)
+	}
+	if err := db.Model(basket).Update("store_id", mission.ID).Error; err != nil {
+		t.Fatalf("failed to move basket: %v", err)
+	}
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if order.StoreID != mission.ID {
+		t.Errorf("expected the order at location %d, got %d", mission.ID, order.StoreID)
+	}
+	if order.Subtotal != 1300 || order.Total != 1300+500 {
+		t.Errorf("expected the location's price of 650 each plus 500 delivery, got %d making %d", order.Subtotal, order.Total)
+	}
+	params := deliveryService.params
+	if params.PickupAddress != mission.Address || params.PickupBusinessName != "Folo Mission" ||
+		params.PickupInstructions != "Use the side door" || params.PickupLat == nil || *params.PickupLat != lat {
+		t.Errorf("expected pickup from the basket's location, got %+v", params)
+	}
+
+	storeID := mission.ID
+	orders, _, err := service.ListOrders(OrderListFilter{StoreID: &storeID})
+	if err != nil {
+		t.Fatalf("unexpected error listing orders: %v", err)
+	}
+	if len(orders) != 1 || orders[0].Basket.CalculateTotal() != 1300 {
+		t.Errorf("expected the order listed under its location at its price, got %+v", orders)
+	}
+}
+
+func TestCreateOrder_HoldsScheduledDeliveryUntilRelease(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-60", ID: "quote-60", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+	slot := time.Now().Add(3 * time.Hour)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+		ScheduledFor: &slot,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if !order.IsHeld() || order.OrderStatus != Paid {
+		t.Fatalf("expected a paid order held for its slot, got %+v", order)
+	}
+	if len(deliveryService.accepted) != 0 {
+		t.Fatalf("expected no dispatch before the slot, got %v", deliveryService.accepted)
+	}
+	if want := slot.Add(-deliveryLeadTime); !order.ReleaseAt.Equal(want) {
+		t.Errorf("expected release at %s, got %s", want, order.ReleaseAt)
+	}
+	if _, err := service.DispatchOrder(order.ID); !errors.Is(err, ErrNotDispatchable) {
+		t.Errorf("expected a held order not to be dispatchable, got %v", err)
+	}
+
+	released, err := service.ReleaseScheduledOrders(time.Now())
+	if err != nil || len(released) != 0 {
+		t.Fatalf("expected nothing due yet, got %v, %v", released, err)
+	}
+
+	// The checkout quote has long expired by the time the order is released
+	deliveryService.quote = &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-61", ID: "quote-61", Fee: 650}
+	released, err = service.ReleaseScheduledOrders(*order.ReleaseAt)
+	if err != nil || len(released) != 1 {
+		t.Fatalf("expected the order to be released, got %v, %v", released, err)
+	}
+	if len(deliveryService.accepted) != 1 || deliveryService.accepted[0] != "ext-61" {
+		t.Fatalf("expected the fresh quote ext-61 to be accepted, got %v", deliveryService.accepted)
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	if stored.IsHeld() || stored.ReleasedAt == nil {
+		t.Errorf("expected the order to be marked released, got %+v", stored)
+	}
+	if stored.DeliveryFee != 500 || stored.DeliveryData.ProviderFee != 650 || stored.DeliveryData.QuoteID != "quote-61" {
+		t.Errorf("expected the customer's fee kept with the new quote stored, got fee %d and %+v", stored.DeliveryFee, stored.DeliveryData)
+	}
+	if released, _ := service.ReleaseScheduledOrders(slot); len(released) != 0 {
+		t.Errorf("expected the order to be released once, got %d", len(released))
+	}
+}
+
+func TestReleaseScheduledOrders_KeepsHoldingWhenRequoteFails(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-62", ID: "quote-62", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	slot := time.Now().Add(3 * time.Hour)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     seedBasket(t, db, 500, 1).ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+		ScheduledFor: &slot,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	deliveryService.quoteErr = errors.New("provider unavailable")
+	released, err := service.ReleaseScheduledOrders(*order.ReleaseAt)
+	if err != nil || len(released) != 0 {
+		t.Fatalf("expected nothing released without a quote, got %v, %v", released, err)
+	}
+	stored, _ := service.orderRepo.FindByID(order.ID)
+	if !stored.IsHeld() {
+		t.Fatalf("expected the order still held, got %+v", stored)
+	}
+
+	// The next run gets a quote and releases it
+	deliveryService.quoteErr = nil
+	deliveryService.quote = &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-63", ID: "quote-63", Fee: 550}
+	released, err = service.ReleaseScheduledOrders(order.ReleaseAt.Add(time.Minute))
+	if err != nil || len(released) != 1 {
+		t.Fatalf("expected the order released on retry, got %v, %v", released, err)
+	}
+	if len(deliveryService.accepted) != 1 || deliveryService.accepted[0] != "ext-63" {
+		t.Errorf("expected the retried quote ext-63 to be accepted, got %v", deliveryService.accepted)
+	}
+}
+
+func TestCreateOrder_RejectsSlotsTheStoreCannotMake(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	holiday := time.Now().AddDate(0, 0, 2)
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:        "Folo",
+		Address:     "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber: "+18564567890",
+		PrepMinutes: 20,
+		Holidays:    []store.Holiday{{Date: holiday.Format("2006-01-02"), Name: "Closed for a party"}},
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+	basket := seedBasket(t, db, 500, 1)
+
+	tests := []struct {
+		name string
+		slot time.Time
+		want error
+	}{
+		{"sooner than the prep time", time.Now().Add(10 * time.Minute), ErrInvalidOrderRequest},
+		{"too far ahead", time.Now().AddDate(0, 0, 8), ErrInvalidOrderRequest},
+		{"on a holiday", holiday, store.ErrClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash, ScheduledFor: &tt.slot})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCreateOrder_RejectsWhilePaused(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	if _, err := service.stores.Pause(service.stores.Default().ID, nil, "kitchen backed up"); err != nil {
+		t.Fatalf("unexpected error pausing: %v", err)
+	}
+	basket := seedBasket(t, db, 500, 1)
+	slot := time.Now().Add(2 * time.Hour)
+
+	for _, scheduledFor := range []*time.Time{nil, &slot} {
+		_, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash, ScheduledFor: scheduledFor})
+		if !errors.Is(err, store.ErrPaused) {
+			t.Errorf("expected store.ErrPaused, got %v", err)
+		}
+	}
+}
+
+func TestCreateOrder_RejectsItemsTakenOffTheMenu(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+
+	soldOut := seedBasket(t, db, 500, 1)
+	if err := db.Model(&MenuItem{}).Where("id = ?", soldOut.BasketItems[0].MenuItemID).Update("available", false).Error; err != nil {
+		t.Fatalf("failed to 86 menu item: %v", err)
+	}
+	removed := seedBasket(t, db, 700, 1)
+	if err := db.Delete(&MenuItem{}, removed.BasketItems[0].MenuItemID).Error; err != nil {
+		t.Fatalf("failed to delete menu item: %v", err)
+	}
+
+	for _, basket := range []*Basket{soldOut, removed} {
+		if _, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash}); !errors.Is(err, ErrItemUnavailable) {
+			t.Errorf("expected ErrItemUnavailable for basket %d, got %v", basket.ID, err)
+		}
+	}
+	var orders int64
+	db.Model(&Order{}).Count(&orders)
+	if orders != 0 {
+		t.Errorf("expected no orders placed, got %d", orders)
+	}
+}
+
+func TestCreateOrder_SendsTicketToKitchen(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 2)
+
+	order, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash, Notes: "Peanut allergy"})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	tickets, err := service.kitchen.Open(nil)
+	if err != nil || len(tickets) != 1 {
+		t.Fatalf("expected one ticket, got %d, %v", len(tickets), err)
+	}
+	ticket := tickets[0]
+	if ticket.OrderID != order.ID || ticket.Notes != "Peanut allergy" || ticket.IsDelivery {
+		t.Errorf("expected a pickup ticket for the order with its notes, got %+v", ticket)
+	}
+	if len(ticket.Items) != 1 || ticket.Items[0].Name != "Test Item" || ticket.Items[0].Quantity != 2 {
+		t.Errorf("expected the basket's items on the ticket, got %+v", ticket.Items)
+	}
+
+	if _, err := service.CancelOrder(order.ID, "customer changed their mind"); err != nil {
+		t.Fatalf("unexpected error canceling: %v", err)
+	}
+	if tickets, _ := service.kitchen.Open(nil); len(tickets) != 0 {
+		t.Errorf("expected the canceled order's ticket off the screens, got %d", len(tickets))
+	}
+}
+
+func TestReleaseScheduledOrders_SendsTicketForTheSlot(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	basket := seedBasket(t, db, 500, 1)
+	slot := time.Now().Add(2 * time.Hour)
+
+	order, err := service.CreateOrder(OrderReq{BasketId: basket.ID, PaymentType: Cash, ScheduledFor: &slot})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if tickets, _ := service.kitchen.Open(nil); len(tickets) != 0 {
+		t.Fatalf("expected no ticket while the order is held, got %d", len(tickets))
+	}
+
+	if _, err := service.ReleaseScheduledOrders(*order.ReleaseAt); err != nil {
+		t.Fatalf("unexpected error releasing: %v", err)
+	}
+	tickets, _ := service.kitchen.Open(nil)
+	if len(tickets) != 1 || !tickets[0].DueAt.Equal(slot) {
+		t.Fatalf("expected a ticket due for the slot %s, got %+v", slot, tickets)
+	}
+}
+
+func TestCreateOrder_PromisesReadyTimeFromPrepAndLoad(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-70", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:                 "Folo",
+		Address:              "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber:          "+18564567890",
+		PrepMinutes:          10,
+		LoadMinutesPerTicket: 5,
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+
+	// Nothing in the kitchen yet, and the item takes the location's prep time
+	before := time.Now()
+	first, err := service.CreateOrder(OrderReq{BasketId: seedBasket(t, db, 500, 1).ID, PaymentType: Cash})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if got := first.ReadyAt.Sub(before); got < 10*time.Minute || got > 11*time.Minute {
+		t.Errorf("expected ready in 10 minutes, got %s", got)
+	}
+
+	// A slower item, behind the first order's ticket
+	basket := seedBasket(t, db, 900, 1)
+	if err := db.Model(&MenuItem{}).Where("id = ?", basket.BasketItems[0].MenuItemID).Update("prep_minutes", 25).Error; err != nil {
+		t.Fatalf("failed to set prep time: %v", err)
+	}
+	before = time.Now()
+	second, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Cash,
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	if got := second.ReadyAt.Sub(before); got < 30*time.Minute || got > 31*time.Minute {
+		t.Errorf("expected ready in 25 minutes plus 5 for the open ticket, got %s", got)
+	}
+	if pickup := deliveryService.params.PickupTime; pickup == nil || !pickup.Equal(*second.ReadyAt) {
+		t.Errorf("expected the provider asked to pick up at %s, got %v", second.ReadyAt, pickup)
+	}
+}
+
+func TestCreateOrder_ChargesTaxByCategory(t *testing.T) {
+	db := newTestDB(t)
+	deliveryService := &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-80", Fee: 500}}
+	service := newTestOrderService(t, db, deliveryService, payment.NewFakeGateway(payment.FakeGatewayConfig{MaxOvercapturePercent: 20}))
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:           "Folo",
+		Address:        "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber:    "+18564567890",
+		TaxRate:        0.08625,
+		TaxRules:       []store.TaxRule{{Category: "packaged_beverage", Rate: 0.05}},
+		TaxDeliveryFee: true,
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+
+	items := []*MenuItem{
+		{SKU: 2001, Name: "Burrito", Price: 1200},
+		{SKU: 2002, Name: "Bottled water", Price: 300, TaxCategory: "packaged_beverage"},
+		{SKU: 2003, Name: "Gift card", Price: 500, TaxExempt: true},
+	}
+	basket := &Basket{}
+	for _, item := range items {
+		if err := db.Create(item).Error; err != nil {
+			t.Fatalf("failed to seed menu item: %v", err)
+		}
+		basket.BasketItems = append(basket.BasketItems, BasketItem{MenuItemID: item.ID, Quantity: 1})
+	}
+	if err := db.Omit("BasketItems.MenuItem").Create(basket).Error; err != nil {
+		t.Fatalf("failed to seed basket: %v", err)
+	}
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	// 103.5 on the burrito, 15 on the water and 43.125 on the delivery fee
+	// round once to 162
+	if order.Subtotal != 2000 || order.Tax != 162 || order.DeliveryFee != 500 || order.Total != 2662 {
+		t.Errorf("expected 2000 + 162 tax + 500 delivery = 2662, got %d + %d + %d = %d",
+			order.Subtotal, order.Tax, order.DeliveryFee, order.Total)
+	}
+	stored, err := service.orderRepo.FindByID(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	wantRates := []float64{0.08625, 0.05, 0, 0.08625}
+	if len(stored.TaxLines) != len(wantRates) {
+		t.Fatalf("expected a tax line per item and the delivery fee, got %+v", stored.TaxLines)
+	}
+	for i, rate := range wantRates {
+		if stored.TaxLines[i].Rate != rate {
+			t.Errorf("expected %q taxed at %v, got %v", stored.TaxLines[i].Name, rate, stored.TaxLines[i].Rate)
+		}
+	}
+
+	auths, err := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if err != nil || len(auths) != 1 || auths[0].Amount != 2662 {
+		t.Fatalf("expected the card authorized for the total of 2662, got %+v (err %v)", auths, err)
+	}
+
+	// A rate change after checkout doesn't change the tax on the items
+	if _, err := service.stores.Update(service.stores.Default().ID, &store.Store{
+		Name:           "Folo",
+		Address:        "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber:    "+18564567890",
+		TaxRate:        0.1,
+		TaxDeliveryFee: true,
+	}); err != nil {
+		t.Fatalf("unexpected error updating store: %v", err)
+	}
+
+	// A lower final delivery fee is taxed again at its checkout rate: 34.5
+	// rounds to 35 in place of the 43 charged on 500
+	fee := 400
+	captured, err := service.CaptureOrderPayment(order.ID, CaptureAdjustment{DeliveryFee: &fee})
+	if err != nil {
+		t.Fatalf("unexpected error capturing payment: %v", err)
+	}
+	if captured.Tax != 154 || captured.Total != 2554 {
+		t.Errorf("expected 154 tax making 2554, got %d making %d", captured.Tax, captured.Total)
+	}
+	if lines := captured.TaxLines; len(lines) != 4 || lines[0].Tax != 104 || lines[3].Amount != 400 || lines[3].Tax != 35 {
+		t.Errorf("expected the item lines kept and the delivery fee line taxed again, got %+v", lines)
+	}
+	auths, _ = service.paymentRepo.FindActiveByOrderID(order.ID)
+	if auths[0].CapturedAmount != 2554 {
+		t.Errorf("expected 2554 captured, got %d", auths[0].CapturedAmount)
+	}
+}
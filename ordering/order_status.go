@@ -0,0 +1,59 @@
+package ordering
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// COMPLETED, FAILED and CANCELED are terminal. UNPAID may go straight to
+// PROCESSING for pay-at-pickup (cash) orders.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	Unpaid:     {Paid, Processing, Failed, Canceled},
+	Paid:       {Processing, Canceled},
+	Processing: {Completed, Failed, Canceled},
+}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// InvalidTransitionError is returned when an order status change is not allowed
+type InvalidTransitionError struct {
+	From OrderStatus
+	To   OrderStatus
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("invalid order status transition from %s to %s", e.From, e.To)
+}
+
+// ValidateTransition returns an *InvalidTransitionError if from cannot move to to
+func ValidateTransition(from, to OrderStatus) error {
+	if !CanTransition(from, to) {
+		return &InvalidTransitionError{From: from, To: to}
+	}
+	return nil
+}
+
+// OrderStatusHistory records a single status change of an order
+type OrderStatusHistory struct {
+	gorm.Model
+	OrderID    uint        `gorm:"column:order_id;not null;index" json:"orderId"`
+	FromStatus OrderStatus `gorm:"column:from_status" json:"fromStatus"`
+	ToStatus   OrderStatus `gorm:"column:to_status;not null" json:"toStatus"`
+	Reason     string      `gorm:"column:reason" json:"reason"`
+}
+
+// TableName keeps the history in one singular table, order_status_history, rather
+// than the pluralized order_status_histories
+func (OrderStatusHistory) TableName() string {
+	return "order_status_history"
+}
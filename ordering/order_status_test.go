@@ -0,0 +1,113 @@
+package ordering
+
+import (
+	"errors"
+	"testing"
+
+	"folo/payment"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from OrderStatus
+		to   OrderStatus
+		want bool
+	}{
+		{Unpaid, Paid, true},
+		{Paid, Processing, true},
+		{Processing, Completed, true},
+		{Unpaid, Canceled, true},
+		{Paid, Canceled, true},
+		{Processing, Canceled, true},
+		{Unpaid, Processing, true},
+		{Unpaid, Completed, false},
+		{Paid, Unpaid, false},
+		{Completed, Canceled, false},
+		{Canceled, Paid, false},
+		{Failed, Paid, false},
+	}
+
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateOrderStatus_RecordsHistory(t *testing.T) {
+	orderRepo := NewOrderRepository(newTestDB(t))
+	service := &orderService{orderRepo: orderRepo}
+
+	order := &Order{OrderStatus: Unpaid}
+	if err := orderRepo.Create(order); err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	if _, err := service.UpdateOrderStatus(order.ID, Paid, "payment approved"); err != nil {
+		t.Fatalf("unexpected error moving to PAID: %v", err)
+	}
+
+	_, err := service.UpdateOrderStatus(order.ID, Unpaid, "")
+	var transitionErr *InvalidTransitionError
+	if !errors.As(err, &transitionErr) {
+		t.Fatalf("expected InvalidTransitionError, got %v", err)
+	}
+
+	stored, err := orderRepo.FindByID(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error finding order: %v", err)
+	}
+	if stored.OrderStatus != Paid {
+		t.Errorf("expected stored status PAID, got %s", stored.OrderStatus)
+	}
+
+	history, err := orderRepo.FindStatusHistory(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(history))
+	}
+	if history[1].FromStatus != Unpaid || history[1].ToStatus != Paid {
+		t.Errorf("unexpected transition recorded: %+v", history[1])
+	}
+}
+
+func TestUpdateOrderStatus_CompletesPickupAtHandoff(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, &fakeDeliveryService{}, payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+
+	card, err := service.CreateOrder(OrderReq{
+		BasketId:    seedBasket(t, db, 500, 2).ID,
+		PaymentType: Credit,
+		PaymentData: &payment.PaymentData{CardNumber: "4242424242424242"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating card order: %v", err)
+	}
+	cash, err := service.CreateOrder(OrderReq{
+		BasketId:    seedBasket(t, db, 500, 1).ID,
+		PaymentType: Cash,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating cash order: %v", err)
+	}
+
+	for _, order := range []*Order{card, cash} {
+		if _, err := service.UpdateOrderStatus(order.ID, Processing, "kitchen started"); err != nil {
+			t.Fatalf("unexpected error moving %s order to PROCESSING: %v", order.PaymentType, err)
+		}
+		completed, err := service.UpdateOrderStatus(order.ID, Completed, "picked up")
+		if err != nil {
+			t.Fatalf("unexpected error completing %s order: %v", order.PaymentType, err)
+		}
+		if completed.OrderStatus != Completed {
+			t.Errorf("expected %s order COMPLETED, got %s", order.PaymentType, completed.OrderStatus)
+		}
+	}
+
+	auths, _ := service.paymentRepo.FindActiveByOrderID(card.ID)
+	if len(auths) != 1 || auths[0].Status != payment.AuthorizationCaptured || auths[0].CapturedAmount != 1000 {
+		t.Errorf("expected the card captured for 1000 at handoff, got %+v", auths)
+	}
+}
@@ -0,0 +1,57 @@
+package ordering
+
+import (
+	"folo/payment"
+
+	"gorm.io/gorm"
+)
+
+// PaymentRepository handles database operations for payment authorizations
+type PaymentRepository interface {
+	Create(auth *payment.Authorization) error
+	FindActiveByOrderID(orderID uint) ([]payment.Authorization, error)
+	FindByOrderID(orderID uint) ([]payment.Authorization, error)
+	Update(auth *payment.Authorization) error
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+// NewPaymentRepository creates a new payment repository
+func NewPaymentRepository(db *gorm.DB) PaymentRepository {
+	return &paymentRepository{db: db}
+}
+
+// Create records a new authorization attempt
+func (r *paymentRepository) Create(auth *payment.Authorization) error {
+	return r.db.Create(auth).Error
+}
+
+// FindActiveByOrderID returns the authorizations for an order that are
+// pending, hold funds or have collected them, oldest first. Split payments
+// have more than one.
+func (r *paymentRepository) FindActiveByOrderID(orderID uint) ([]payment.Authorization, error) {
+	var auths []payment.Authorization
+	err := r.db.
+		Where("order_id = ? AND status IN ?", orderID, []payment.AuthorizationStatus{
+			payment.AuthorizationPending,
+			payment.AuthorizationAuthorized,
+			payment.AuthorizationCaptured,
+		}).
+		Order("id").
+		Find(&auths).Error
+	return auths, err
+}
+
+// FindByOrderID returns every authorization attempt for an order, oldest first
+func (r *paymentRepository) FindByOrderID(orderID uint) ([]payment.Authorization, error) {
+	var auths []payment.Authorization
+	err := r.db.Where("order_id = ?", orderID).Order("id").Find(&auths).Error
+	return auths, err
+}
+
+// Update updates an existing authorization
+func (r *paymentRepository) Update(auth *payment.Authorization) error {
+	return r.db.Save(auth).Error
+}
@@ -0,0 +1,102 @@
+package ordering
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"folo/delivery"
+)
+
+// quoteReuseMargin is how long a stored quote must still be valid to be used,
+// leaving time to take payment and accept it before the provider expires it
+const quoteReuseMargin = 30 * time.Second
+
+// QuoteStore keeps delivery quotes shown before checkout so submitting the
+// order can reuse them instead of quoting again
+type QuoteStore interface {
+	// Get returns the quote stored under key unless it expires within the reuse margin of now
+	Get(key string, now time.Time) (*delivery.QuoteResult, bool)
+	// Take is Get that also removes the quote, so only one order can accept it
+	Take(key string, now time.Time) (*delivery.QuoteResult, bool)
+	Put(key string, result *delivery.QuoteResult)
+}
+
+type memoryQuoteStore struct {
+	mu     sync.Mutex
+	quotes map[string]*delivery.QuoteResult
+}
+
+// NewQuoteStore creates an in-memory quote store. Quotes live for minutes,
+// so losing them on restart only costs a fresh quote.
+func NewQuoteStore() QuoteStore {
+	return &memoryQuoteStore{quotes: make(map[string]*delivery.QuoteResult)}
+}
+
+// Get returns a quote that can still be used, dropping it if it can't
+func (s *memoryQuoteStore) Get(key string, now time.Time) (*delivery.QuoteResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usable(key, now)
+}
+
+// Take returns a quote that can still be used and removes it
+func (s *memoryQuoteStore) Take(key string, now time.Time) (*delivery.QuoteResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, ok := s.usable(key, now)
+	delete(s.quotes, key)
+	return result, ok
+}
+
+// usable looks up a quote, dropping it if it expires within the reuse
+// margin. The caller must hold the lock.
+func (s *memoryQuoteStore) usable(key string, now time.Time) (*delivery.QuoteResult, bool) {
+	result, ok := s.quotes[key]
+	if !ok {
+		return nil, false
+	}
+	if result.Response.IsExpired(now.Add(quoteReuseMargin)) {
+		delete(s.quotes, key)
+		return nil, false
+	}
+	return result, true
+}
+
+// Put stores a quote, purging any that have expired
+func (s *memoryQuoteStore) Put(key string, result *delivery.QuoteResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, q := range s.quotes {
+		if q.Response.IsExpired(now) {
+			delete(s.quotes, k)
+		}
+	}
+	s.quotes[key] = result
+}
+
+// deliveryQuoteKey identifies a quote by basket, basket total and normalized
+// dropoff, so changing either the basket or the address gets a fresh quote
+func deliveryQuoteKey(basketID uint, orderTotal int, dropoff *delivery.DeliveryData) string {
+	address := strings.ToLower(strings.Join(strings.Fields(dropoff.Address), " "))
+	unit := strings.ToLower(strings.TrimSpace(dropoff.Unit))
+	return fmt.Sprintf("%d|%d|%s|%s", basketID, orderTotal, address, unit)
+}
+
+// DeliveryQuote is the delivery price shown to the customer before checkout
+type DeliveryQuote struct {
+	Provider delivery.Provider `json:"provider"`
+	QuoteID  string            `json:"quoteId"`
+	// Fee is what the customer pays in cents, after any zone pricing
+	Fee int64 `json:"fee"`
+	// ProviderFee is what the provider charges us in cents
+	ProviderFee int64  `json:"providerFee"`
+	Address     string `json:"address"`
+	Unit        string `json:"unit,omitempty"`
+	Zone        string `json:"zone,omitempty"`
+	// ExpiresAt is when the provider stops honoring the quote
+	ExpiresAt            string `json:"expiresAt"`
+	DropoffTimeEstimated string `json:"dropoffTimeEstimated,omitempty"`
+}
@@ -0,0 +1,40 @@
+package ordering
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"folo/delivery"
+)
+
+func TestQuoteStore_TakeHandsAQuoteOutOnce(t *testing.T) {
+	quotes := NewQuoteStore()
+	quotes.Put("basket", &delivery.QuoteResult{Response: &delivery.CreateQuoteResponse{
+		ExternalDeliveryID: "ext-1",
+		ExpiresAt:          time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+	}})
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok := quotes.Take("basket", time.Now()); ok {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Errorf("expected the quote taken once, got %d", taken)
+	}
+	if _, ok := quotes.Get("basket", time.Now()); ok {
+		t.Error("expected the quote gone once taken")
+	}
+}
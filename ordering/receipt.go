@@ -0,0 +1,77 @@
+package ordering
+
+import (
+	"time"
+
+	"folo/store"
+)
+
+// Receipt is what the customer is given for an order. Amounts are in cents.
+type Receipt struct {
+	OrderID     uint          `json:"orderId"`
+	Store       ReceiptStore  `json:"store"`
+	PlacedAt    time.Time     `json:"placedAt"`
+	Status      OrderStatus   `json:"status"`
+	PaymentType PaymentType   `json:"paymentType"`
+	Lines       []ReceiptLine `json:"lines"`
+	ItemsTotal  int           `json:"itemsTotal"`
+	Tax         int           `json:"tax"`
+	DeliveryFee int           `json:"deliveryFee"`
+	Tip         int           `json:"tip"`
+	Total       int           `json:"total"`
+	// DeliveryAddress is empty for pickup orders
+	DeliveryAddress string `json:"deliveryAddress,omitempty"`
+}
+
+// ReceiptStore is the store details printed at the top of a receipt
+type ReceiptStore struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+// ReceiptLine is one basket line on a receipt
+type ReceiptLine struct {
+	Name      string   `json:"name"`
+	Modifiers []string `json:"modifiers,omitempty"`
+	Quantity  int      `json:"quantity"`
+	UnitPrice int      `json:"unitPrice"`
+	Total     int      `json:"total"`
+}
+
+// NewReceipt builds the receipt for an order loaded with its details
+func NewReceipt(order *Order, profile *store.Store) *Receipt {
+	receipt := &Receipt{
+		OrderID: order.ID,
+		Store: ReceiptStore{
+			Name:        profile.Name,
+			Address:     profile.Address,
+			PhoneNumber: profile.PhoneNumber,
+		},
+		PlacedAt:    order.CreatedAt.In(profile.TimeZone()),
+		Status:      order.OrderStatus,
+		PaymentType: order.PaymentType,
+		ItemsTotal:  order.Subtotal,
+		Tax:         order.Tax,
+		DeliveryFee: order.DeliveryFee,
+		Tip:         order.Tip,
+		Total:       order.Total,
+	}
+	for i := range order.Basket.BasketItems {
+		item := &order.Basket.BasketItems[i]
+		line := ReceiptLine{
+			Name:      item.MenuItem.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice(),
+			Total:     item.UnitPrice() * item.Quantity,
+		}
+		for _, modifier := range item.Modifiers {
+			line.Modifiers = append(line.Modifiers, modifier.Name)
+		}
+		receipt.Lines = append(receipt.Lines, line)
+	}
+	if order.IsDelivery && order.DeliveryData != nil {
+		receipt.DeliveryAddress = order.DeliveryData.Address
+	}
+	return receipt
+}
@@ -0,0 +1,106 @@
+package ordering
+
+import (
+	"fmt"
+	"testing"
+
+	"folo/database/databasetest"
+	"folo/delivery"
+	"folo/giftcard"
+	"folo/kitchen"
+	"folo/payment"
+	"folo/store"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory SQLite database with all ordering tables migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Open(t,
+		&Basket{},
+		&BasketItem{},
+		&BasketItemModifier{},
+		&MenuCategory{},
+		&MenuItem{},
+		&MenuItemOverride{},
+		&ModifierGroup{},
+		&Modifier{},
+		&Order{},
+		&OrderStatusHistory{},
+		&delivery.DeliveryData{},
+		&payment.Authorization{},
+		&IdempotencyRecord{},
+		&giftcard.Card{},
+		&giftcard.LedgerEntry{},
+		&store.Store{},
+		&store.Hours{},
+		&store.Holiday{},
+		&store.TaxRule{},
+		&kitchen.Ticket{},
+		&kitchen.TicketItem{},
+	)
+}
+
+// newTestOrderService wires an order service to the test database, for a store
+// that is always open
+func newTestOrderService(t *testing.T, db *gorm.DB, deliveryService delivery.DeliveryService, cardGateway payment.PaymentGateway) *orderService {
+	deliveries := delivery.NewRegistry(delivery.CheapestQuote)
+	deliveries.Register(delivery.ProviderDoorDash, deliveryService)
+	stores := store.NewService(store.NewRepository(db))
+	if _, err := stores.Create(&store.Store{
+		Name:        "Test Store",
+		Address:     "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber: "+18564567890",
+	}); err != nil {
+		t.Fatalf("failed to seed store profile: %v", err)
+	}
+	return NewOrderService(
+		NewOrderRepository(db),
+		NewBasketRepository(db),
+		NewDeliveryDataRepository(db),
+		NewPaymentRepository(db),
+		NewUnitOfWork(db),
+		stores,
+		kitchen.NewService(kitchen.NewRepository(db)),
+		DeliveryOptions{Providers: deliveries},
+		PaymentProviders{
+			Card:   cardGateway,
+			Gift:   giftcard.NewGateway(giftcard.NewRepository(db)),
+			Crypto: payment.NewFakeCryptoGateway(payment.FakeCryptoConfig{}),
+		},
+	).(*orderService)
+}
+
+// seedBasket creates a basket holding quantity of a single menu item priced at price
+func seedBasket(t *testing.T, db *gorm.DB, price, quantity int) *Basket {
+	t.Helper()
+	item := &MenuItem{SKU: 1000 + price, Name: "Test Item", Price: price}
+	if err := db.Create(item).Error; err != nil {
+		t.Fatalf("failed to seed menu item: %v", err)
+	}
+	basket := &Basket{BasketItems: []BasketItem{{MenuItemID: item.ID, Quantity: quantity}}}
+	if err := db.Omit("BasketItems.MenuItem").Create(basket).Error; err != nil {
+		t.Fatalf("failed to seed basket: %v", err)
+	}
+	return basket
+}
+
+// locateBasket moves the basket to a new location at lat, lng
+func locateBasket(t *testing.T, db *gorm.DB, service *orderService, basket *Basket, lat, lng float64) {
+	t.Helper()
+	profile, err := service.stores.Create(&store.Store{
+		Name:        fmt.Sprintf("Store at %.4f,%.4f", lat, lng),
+		Address:     "303 2nd St, San Francisco, CA 94107",
+		PhoneNumber: "+18564567890",
+		Lat:         &lat,
+		Lng:         &lng,
+	})
+	if err != nil {
+		t.Fatalf("failed to seed store profile: %v", err)
+	}
+	if err := db.Model(basket).Update("store_id", profile.ID).Error; err != nil {
+		t.Fatalf("failed to move basket: %v", err)
+	}
+	basket.StoreID = profile.ID
+}
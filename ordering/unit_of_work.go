@@ -0,0 +1,69 @@
+package ordering
+
+import (
+	"folo/payment"
+
+	"gorm.io/gorm"
+)
+
+// Repositories is a set of repositories that read and write through the same
+// database handle
+type Repositories struct {
+	Orders       OrderRepository
+	Baskets      BasketRepository
+	DeliveryData DeliveryDataRepository
+	Payments     PaymentRepository
+
+	// db is the transaction the repositories share, for collaborators such as
+	// gift card gateways that keep their own records
+	db *gorm.DB
+}
+
+// UnitOfWork runs a function against repositories that share one database
+// transaction. The transaction commits if fn returns nil and rolls back otherwise.
+type UnitOfWork interface {
+	Do(fn func(repos Repositories) error) error
+}
+
+type unitOfWork struct {
+	db *gorm.DB
+}
+
+// NewUnitOfWork creates a unit of work backed by gorm transactions
+func NewUnitOfWork(db *gorm.DB) UnitOfWork {
+	return &unitOfWork{db: db}
+}
+
+// Do runs fn inside a transaction
+func (u *unitOfWork) Do(fn func(repos Repositories) error) error {
+	return u.db.Transaction(func(tx *gorm.DB) error {
+		return fn(Repositories{
+			Orders:       NewOrderRepository(tx),
+			Baskets:      NewBasketRepository(tx),
+			DeliveryData: NewDeliveryDataRepository(tx),
+			Payments:     NewPaymentRepository(tx),
+			db:           tx,
+		})
+	})
+}
+
+// transactionalGateway is a payment gateway that keeps its records in our
+// database, and so can take part in a unit of work
+type transactionalGateway interface {
+	payment.PaymentGateway
+	WithDB(db *gorm.DB) payment.PaymentGateway
+}
+
+// withDB binds every transactional gateway to db. Gateways that talk to an
+// external processor are returned as they are.
+func (p PaymentProviders) withDB(db *gorm.DB) PaymentProviders {
+	bind := func(gateway payment.PaymentGateway) payment.PaymentGateway {
+		if tg, ok := gateway.(transactionalGateway); ok {
+			return tg.WithDB(db)
+		}
+		return gateway
+	}
+	p.Card = bind(p.Card)
+	p.Gift = bind(p.Gift)
+	return p
+}
@@ -0,0 +1,67 @@
+package ordering
+
+import (
+	"errors"
+	"log"
+
+	"folo/delivery"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	orderService OrderService
+	doorDashAuth string
+}
+
+// NewWebhookHandler creates a webhook handler. doorDashAuth is the
+// Authorization header value configured for the webhook in the DoorDash portal.
+func NewWebhookHandler(orderService OrderService, doorDashAuth string) *WebhookHandler {
+	return &WebhookHandler{
+		orderService: orderService,
+		doorDashAuth: doorDashAuth,
+	}
+}
+
+func RegisterWebhookRoutes(router fiber.Router, handler *WebhookHandler) {
+	webhooks := router.Group("/webhooks")
+	webhooks.Post("/doordash", handler.DoorDash)
+}
+
+// DoorDash receives DoorDash Drive delivery events
+func (h *WebhookHandler) DoorDash(c fiber.Ctx) error {
+	if !delivery.VerifyWebhookAuth(c.Get(fiber.HeaderAuthorization), h.doorDashAuth) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid webhook authorization",
+		})
+	}
+
+	event := new(delivery.WebhookEvent)
+	if err := c.Bind().Body(event); err != nil || event.ExternalDeliveryID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid webhook payload",
+		})
+	}
+
+	if err := h.orderService.HandleDeliveryEvent(*event); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"success": false,
+				"error":   "delivery not found",
+			})
+		}
+		// A non-2xx response makes DoorDash retry the event later
+		log.Printf("error handling DoorDash %s event for %s: %s", event.EventName, event.ExternalDeliveryID, err.Error())
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"error":   "failed to handle webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+	})
+}
@@ -0,0 +1,196 @@
+package ordering
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"folo/delivery"
+	"folo/delivery/doordashsim"
+	"folo/payment"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func postWebhook(t *testing.T, app *fiber.App, auth, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodPost, "/webhooks/doordash", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, auth)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestDoorDashWebhook_DrivesDeliveryAndOrderStatus(t *testing.T) {
+	db := newTestDB(t)
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{})
+	service := newTestOrderService(t, db, &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-7", Fee: 500}}, gateway)
+	basket := seedBasket(t, db, 1000, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	app := fiber.New()
+	RegisterWebhookRoutes(app, NewWebhookHandler(service, "Basic secret"))
+
+	if status := postWebhook(t, app, "Basic wrong", `{"event_name":"DASHER_CONFIRMED","external_delivery_id":"ext-7"}`); status != fiber.StatusUnauthorized {
+		t.Errorf("expected 401 for bad auth, got %d", status)
+	}
+
+	events := []string{
+		`{"event_name":"DASHER_CONFIRMED","external_delivery_id":"ext-7","dasher_id":42,"dasher_name":"Sam"}`,
+		`{"event_name":"DASHER_DROPPED_OFF","external_delivery_id":"ext-7"}`,
+		// Arrives late and must not move the delivery backwards
+		`{"event_name":"DASHER_PICKED_UP","external_delivery_id":"ext-7"}`,
+	}
+	for _, event := range events {
+		if status := postWebhook(t, app, "Basic secret", event); status != fiber.StatusOK {
+			t.Fatalf("expected 200 for %s, got %d", event, status)
+		}
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	if stored.OrderStatus != Completed {
+		t.Errorf("expected COMPLETED after delivery, got %s", stored.OrderStatus)
+	}
+	if stored.DeliveryData.Status != Delivered || stored.DeliveryData.DasherName != "Sam" {
+		t.Errorf("expected delivered status and dasher to be stored, got %+v", stored.DeliveryData)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if len(auths) != 1 || auths[0].Status != payment.AuthorizationCaptured {
+		t.Errorf("expected payment to be captured on delivery, got %+v", auths)
+	}
+
+	if status := postWebhook(t, app, "Basic secret", `{"event_name":"DASHER_CONFIRMED","external_delivery_id":"unknown"}`); status != fiber.StatusNotFound {
+		t.Errorf("expected 404 for unknown delivery, got %d", status)
+	}
+}
+
+func TestDeliveryPath_AgainstDoorDashSimulator(t *testing.T) {
+	app := fiber.New()
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := app.Test(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+	}))
+	defer receiver.Close()
+
+	sim := doordashsim.New(doordashsim.Config{WebhookURL: receiver.URL + "/webhooks/doordash", WebhookAuth: "Basic secret"})
+	defer sim.Close()
+
+	db := newTestDB(t)
+	service := newTestOrderService(t, db, delivery.NewDoorDashService(sim.DoorDashConfig()), payment.NewFakeGateway(payment.FakeGatewayConfig{}))
+	RegisterWebhookRoutes(app, NewWebhookHandler(service, "Basic secret"))
+	basket := seedBasket(t, db, 1000, 1)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     basket.ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	externalID := order.DeliveryData.ExternalDeliveryID
+	if _, ok := sim.Delivery(externalID); !ok {
+		t.Fatalf("expected the paid order to be dispatched to the simulator")
+	}
+	for _, event := range []string{"DASHER_CONFIRMED", "DASHER_PICKED_UP", "DASHER_DROPPED_OFF"} {
+		if err := sim.EmitEvent(context.Background(), externalID, event); err != nil {
+			t.Fatalf("unexpected error emitting %s: %v", event, err)
+		}
+	}
+
+	stored, err := service.orderRepo.FindByIDWithDetails(order.ID)
+	if err != nil {
+		t.Fatalf("unexpected error loading order: %v", err)
+	}
+	if stored.OrderStatus != Completed || stored.DeliveryData.Status != Delivered {
+		t.Errorf("expected a completed order and delivery, got %s / %s", stored.OrderStatus, stored.DeliveryData.Status)
+	}
+}
+
+func TestHandleDeliveryEvent_RetryCompletesADeliveredOrder(t *testing.T) {
+	db := newTestDB(t)
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{})
+	service := newTestOrderService(t, db, &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-8", Fee: 500}}, gateway)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     seedBasket(t, db, 1000, 1).ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+	// The first DASHER_DROPPED_OFF was recorded but the capture after it failed
+	if err := db.Model(&delivery.DeliveryData{}).Where("order_id = ?", order.ID).Update("status", Delivered).Error; err != nil {
+		t.Fatalf("failed to record delivery: %v", err)
+	}
+
+	if err := service.HandleDeliveryEvent(delivery.WebhookEvent{EventName: "DASHER_DROPPED_OFF", ExternalDeliveryID: "ext-8"}); err != nil {
+		t.Fatalf("unexpected error handling retried event: %v", err)
+	}
+	stored, _ := service.orderRepo.FindByID(order.ID)
+	if stored.OrderStatus != Completed {
+		t.Errorf("expected the retry to complete the order, got %s", stored.OrderStatus)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	if len(auths) != 1 || auths[0].Status != payment.AuthorizationCaptured {
+		t.Errorf("expected the hold captured on retry, got %+v", auths)
+	}
+}
+
+func TestHandleDeliveryEvent_CancelsUndeliveredOrder(t *testing.T) {
+	db := newTestDB(t)
+	gateway := payment.NewFakeGateway(payment.FakeGatewayConfig{})
+	service := newTestOrderService(t, db, &fakeDeliveryService{quote: &delivery.CreateQuoteResponse{ExternalDeliveryID: "ext-9", Fee: 500}}, gateway)
+
+	order, err := service.CreateOrder(OrderReq{
+		BasketId:     seedBasket(t, db, 1000, 1).ID,
+		PaymentType:  Credit,
+		PaymentData:  &payment.PaymentData{CardNumber: "4242424242424242"},
+		DeliveryData: &delivery.DeliveryData{Address: "345 Spear St", PhoneNumber: "+18773934448"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating order: %v", err)
+	}
+
+	event := delivery.WebhookEvent{EventName: "DELIVERY_CANCELLED", ExternalDeliveryID: "ext-9", CancellationReason: "dasher could not find the address"}
+	if err := service.HandleDeliveryEvent(event); err != nil {
+		t.Fatalf("unexpected error handling event: %v", err)
+	}
+	stored, _ := service.orderRepo.FindByID(order.ID)
+	if stored.OrderStatus != Canceled || stored.CancelReason != "delivery not completed: dasher could not find the address" {
+		t.Errorf("expected the order canceled with the provider's reason, got %s %q", stored.OrderStatus, stored.CancelReason)
+	}
+	auths, _ := service.paymentRepo.FindActiveByOrderID(order.ID)
+	for _, auth := range auths {
+		if auth.Status == payment.AuthorizationAuthorized {
+			t.Errorf("expected the card hold released, got %+v", auth)
+		}
+	}
+}
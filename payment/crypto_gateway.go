@@ -0,0 +1,128 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CryptoInvoice is a request for the customer to send a crypto payment
+type CryptoInvoice struct {
+	// ID is the provider's identifier for the invoice
+	ID string
+
+	// Address is the wallet address the customer pays to
+	Address string
+
+	// PaymentURI is a wallet-compatible URI, e.g. "bitcoin:<address>?amount=0.0005"
+	PaymentURI string
+
+	// ExpiresAt is when the quoted exchange rate stops being honored
+	ExpiresAt time.Time
+}
+
+// CryptoGateway issues crypto payment requests and confirms them once the
+// customer's transaction has been seen on chain
+type CryptoGateway interface {
+	CreateInvoice(ctx context.Context, req PaymentRequest) (*CryptoInvoice, error)
+	ConfirmInvoice(ctx context.Context, invoiceID string, transactionHash string) PaymentResult
+}
+
+// ErrUnknownInvoice is returned when confirming an invoice the gateway never issued
+var ErrUnknownInvoice = errors.New("unknown invoice")
+
+// FakeCryptoConfig configures the in-process fake crypto gateway
+type FakeCryptoConfig struct {
+	// USDPerCoin is the exchange rate used to price invoices
+	USDPerCoin float64
+
+	// InvoiceTTL is how long an invoice may be paid, defaults to 15 minutes
+	InvoiceTTL time.Duration
+}
+
+type fakeInvoice struct {
+	amount    int
+	expiresAt time.Time
+	paid      bool
+}
+
+// FakeCryptoGateway is an in-process CryptoGateway for tests and local development.
+// Any non-empty transaction hash confirms an unexpired invoice.
+type FakeCryptoGateway struct {
+	config FakeCryptoConfig
+
+	mu       sync.Mutex
+	invoices map[string]*fakeInvoice
+}
+
+// NewFakeCryptoGateway creates a fake crypto gateway
+func NewFakeCryptoGateway(config FakeCryptoConfig) *FakeCryptoGateway {
+	if config.USDPerCoin <= 0 {
+		config.USDPerCoin = 60000
+	}
+	if config.InvoiceTTL <= 0 {
+		config.InvoiceTTL = 15 * time.Minute
+	}
+	return &FakeCryptoGateway{
+		config:   config,
+		invoices: make(map[string]*fakeInvoice),
+	}
+}
+
+// CreateInvoice prices the request in coins and returns a payment request
+func (g *FakeCryptoGateway) CreateInvoice(ctx context.Context, req PaymentRequest) (*CryptoInvoice, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("invalid amount %d", req.Amount)
+	}
+
+	id := "fakecrypto_" + uuid.New().String()
+	address := "bc1q" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	coins := float64(req.Amount) / 100 / g.config.USDPerCoin
+	expiresAt := time.Now().Add(g.config.InvoiceTTL)
+
+	g.mu.Lock()
+	g.invoices[id] = &fakeInvoice{amount: req.Amount, expiresAt: expiresAt}
+	g.mu.Unlock()
+
+	return &CryptoInvoice{
+		ID:         id,
+		Address:    address,
+		PaymentURI: fmt.Sprintf("bitcoin:%s?amount=%.8f", address, coins),
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// ConfirmInvoice marks an invoice as paid by the given transaction
+func (g *FakeCryptoGateway) ConfirmInvoice(ctx context.Context, invoiceID string, transactionHash string) PaymentResult {
+	if err := ctx.Err(); err != nil {
+		return PaymentResult{AuthorizationID: invoiceID, Status: TimedOut, Error: err}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	invoice, ok := g.invoices[invoiceID]
+	if !ok {
+		return PaymentResult{AuthorizationID: invoiceID, Status: Errored, Error: ErrUnknownInvoice}
+	}
+	if transactionHash == "" {
+		return PaymentResult{AuthorizationID: invoiceID, Status: Declined, DeclineCode: "missing_transaction"}
+	}
+	if invoice.paid {
+		return PaymentResult{AuthorizationID: invoiceID, Status: Declined, DeclineCode: "already_paid"}
+	}
+	if time.Now().After(invoice.expiresAt) {
+		return PaymentResult{AuthorizationID: invoiceID, Status: Declined, DeclineCode: "invoice_expired"}
+	}
+	invoice.paid = true
+
+	return PaymentResult{AuthorizationID: invoiceID, Status: Approved}
+}
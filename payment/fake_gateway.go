@@ -0,0 +1,196 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeOutcome is what the fake gateway does for a matching card
+type FakeOutcome string
+
+const (
+	FakeApprove FakeOutcome = "approve"
+	FakeDecline FakeOutcome = "decline"
+	FakeTimeout FakeOutcome = "timeout"
+)
+
+// FakeRule maps card numbers matching Pattern to an outcome
+type FakeRule struct {
+	Pattern     *regexp.Regexp
+	Outcome     FakeOutcome
+	DeclineCode string
+}
+
+// FakeGatewayConfig configures the in-process fake payment processor
+type FakeGatewayConfig struct {
+	// Rules are checked in order; cards matching none are approved
+	Rules []FakeRule
+
+	// Latency is added to every call to mimic a network round trip
+	Latency time.Duration
+
+	// MaxOvercapturePercent is how far above the authorized amount a capture may go
+	MaxOvercapturePercent int
+}
+
+// DefaultFakeRules follows the common processor test card convention
+func DefaultFakeRules() []FakeRule {
+	return []FakeRule{
+		{Pattern: regexp.MustCompile(`^4000000000000002$`), Outcome: FakeDecline, DeclineCode: "card_declined"},
+		{Pattern: regexp.MustCompile(`^4000000000009995$`), Outcome: FakeDecline, DeclineCode: "insufficient_funds"},
+		{Pattern: regexp.MustCompile(`^4000000000000069$`), Outcome: FakeDecline, DeclineCode: "expired_card"},
+		{Pattern: regexp.MustCompile(`^4000000000000119$`), Outcome: FakeTimeout},
+	}
+}
+
+var (
+	// ErrUnknownAuthorization is returned for an authorization the gateway never issued
+	ErrUnknownAuthorization = errors.New("unknown authorization")
+	// ErrInvalidAuthorizationState is returned when e.g. capturing a voided authorization
+	ErrInvalidAuthorizationState = errors.New("authorization is not in a valid state for this operation")
+)
+
+type fakeAuthorization struct {
+	amount   int
+	captured int
+	refunded int
+	status   AuthorizationStatus
+}
+
+// FakeGateway is an in-process PaymentGateway for tests and local development.
+// It never moves money.
+type FakeGateway struct {
+	config FakeGatewayConfig
+
+	mu             sync.Mutex
+	authorizations map[string]*fakeAuthorization
+}
+
+// NewFakeGateway creates a fake payment gateway
+func NewFakeGateway(config FakeGatewayConfig) *FakeGateway {
+	return &FakeGateway{
+		config:         config,
+		authorizations: make(map[string]*fakeAuthorization),
+	}
+}
+
+// Authorize approves, declines or times out based on the card number
+func (g *FakeGateway) Authorize(ctx context.Context, req PaymentRequest) PaymentResult {
+	if err := g.wait(ctx); err != nil {
+		return PaymentResult{Status: TimedOut, Error: err}
+	}
+	if req.Card == nil || req.Card.CardNumber == "" {
+		return PaymentResult{Status: Declined, DeclineCode: "missing_card"}
+	}
+	if req.Amount <= 0 {
+		return PaymentResult{Status: Errored, Error: fmt.Errorf("invalid amount %d", req.Amount)}
+	}
+
+	rule := g.match(req.Card.CardNumber)
+	switch rule.Outcome {
+	case FakeDecline:
+		return PaymentResult{Status: Declined, DeclineCode: rule.DeclineCode}
+	case FakeTimeout:
+		<-ctx.Done()
+		return PaymentResult{Status: TimedOut, Error: ctx.Err()}
+	}
+
+	authorizationID := "fake_" + uuid.New().String()
+	g.mu.Lock()
+	g.authorizations[authorizationID] = &fakeAuthorization{
+		amount: req.Amount,
+		status: AuthorizationAuthorized,
+	}
+	g.mu.Unlock()
+
+	return PaymentResult{AuthorizationID: authorizationID, Status: Approved, Amount: req.Amount}
+}
+
+// Capture collects amount against an authorization. The amount may exceed the
+// authorized amount by up to MaxOvercapturePercent to cover tips.
+func (g *FakeGateway) Capture(ctx context.Context, authorizationID string, amount int) PaymentResult {
+	return g.update(ctx, authorizationID, func(auth *fakeAuthorization) PaymentResult {
+		if auth.status != AuthorizationAuthorized {
+			return PaymentResult{Status: Errored, Error: ErrInvalidAuthorizationState}
+		}
+		limit := auth.amount + auth.amount*g.config.MaxOvercapturePercent/100
+		if amount <= 0 || amount > limit {
+			return PaymentResult{Status: Declined, DeclineCode: "amount_too_large"}
+		}
+		auth.captured = amount
+		auth.status = AuthorizationCaptured
+		return PaymentResult{Status: Approved, Amount: amount}
+	})
+}
+
+// Void releases an authorization that has not been captured
+func (g *FakeGateway) Void(ctx context.Context, authorizationID string) PaymentResult {
+	return g.update(ctx, authorizationID, func(auth *fakeAuthorization) PaymentResult {
+		if auth.status != AuthorizationAuthorized {
+			return PaymentResult{Status: Errored, Error: ErrInvalidAuthorizationState}
+		}
+		auth.status = AuthorizationVoided
+		return PaymentResult{Status: Approved}
+	})
+}
+
+// Refund returns up to the captured amount of an authorization
+func (g *FakeGateway) Refund(ctx context.Context, authorizationID string, amount int) PaymentResult {
+	return g.update(ctx, authorizationID, func(auth *fakeAuthorization) PaymentResult {
+		if auth.status != AuthorizationCaptured && auth.status != AuthorizationRefunded {
+			return PaymentResult{Status: Errored, Error: ErrInvalidAuthorizationState}
+		}
+		if amount <= 0 || auth.refunded+amount > auth.captured {
+			return PaymentResult{Status: Declined, DeclineCode: "amount_too_large"}
+		}
+		auth.refunded += amount
+		auth.status = AuthorizationRefunded
+		return PaymentResult{Status: Approved, Amount: amount}
+	})
+}
+
+// update applies fn to a known authorization under the lock
+func (g *FakeGateway) update(ctx context.Context, authorizationID string, fn func(*fakeAuthorization) PaymentResult) PaymentResult {
+	if err := g.wait(ctx); err != nil {
+		return PaymentResult{AuthorizationID: authorizationID, Status: TimedOut, Error: err}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	auth, ok := g.authorizations[authorizationID]
+	if !ok {
+		return PaymentResult{AuthorizationID: authorizationID, Status: Errored, Error: ErrUnknownAuthorization}
+	}
+	result := fn(auth)
+	result.AuthorizationID = authorizationID
+	return result
+}
+
+func (g *FakeGateway) match(cardNumber string) FakeRule {
+	for _, rule := range g.config.Rules {
+		if rule.Pattern != nil && rule.Pattern.MatchString(cardNumber) {
+			return rule
+		}
+	}
+	return FakeRule{Outcome: FakeApprove}
+}
+
+// wait sleeps for the configured latency unless the context ends first
+func (g *FakeGateway) wait(ctx context.Context) error {
+	if g.config.Latency <= 0 {
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(g.config.Latency):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
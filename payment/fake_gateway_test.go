@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFakeGateway_OutcomeByCardNumber(t *testing.T) {
+	gateway := NewFakeGateway(FakeGatewayConfig{Rules: DefaultFakeRules()})
+
+	tests := []struct {
+		cardNumber  string
+		status      PaymentStatus
+		declineCode string
+	}{
+		{"4242424242424242", Approved, ""},
+		{"4000000000000002", Declined, "card_declined"},
+		{"4000000000009995", Declined, "insufficient_funds"},
+		{"", Declined, "missing_card"},
+	}
+
+	for _, tt := range tests {
+		result := gateway.Authorize(context.Background(), PaymentRequest{
+			Amount: 1000,
+			Card:   &PaymentData{CardNumber: tt.cardNumber},
+		})
+		if result.Status != tt.status || result.DeclineCode != tt.declineCode {
+			t.Errorf("card %q: expected %s/%q, got %s/%q",
+				tt.cardNumber, tt.status, tt.declineCode, result.Status, result.DeclineCode)
+		}
+		if tt.status == Approved && result.AuthorizationID == "" {
+			t.Errorf("card %q: expected an authorization ID", tt.cardNumber)
+		}
+	}
+}
+
+func TestFakeGateway_TimeoutRespectsContext(t *testing.T) {
+	gateway := NewFakeGateway(FakeGatewayConfig{Rules: DefaultFakeRules()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	result := gateway.Authorize(ctx, PaymentRequest{
+		Amount: 1000,
+		Card:   &PaymentData{CardNumber: "4000000000000119"},
+	})
+	if result.Status != TimedOut {
+		t.Fatalf("expected TIMED_OUT, got %s", result.Status)
+	}
+	if !errors.Is(result.Error, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", result.Error)
+	}
+}
+
+func TestFakeGateway_CaptureVoidRefund(t *testing.T) {
+	gateway := NewFakeGateway(FakeGatewayConfig{MaxOvercapturePercent: 20})
+	ctx := context.Background()
+	card := &PaymentData{CardNumber: "4242424242424242"}
+
+	auth := gateway.Authorize(ctx, PaymentRequest{Amount: 1000, Card: card})
+	if result := gateway.Capture(ctx, auth.AuthorizationID, 1300); result.Approved() {
+		t.Errorf("expected capture beyond overcapture limit to be declined")
+	}
+	if result := gateway.Capture(ctx, auth.AuthorizationID, 1150); !result.Approved() {
+		t.Fatalf("expected capture with tip to be approved, got %s", result.Status)
+	}
+	if result := gateway.Void(ctx, auth.AuthorizationID); !errors.Is(result.Error, ErrInvalidAuthorizationState) {
+		t.Errorf("expected void after capture to fail, got %v", result.Error)
+	}
+	if result := gateway.Refund(ctx, auth.AuthorizationID, 1150); !result.Approved() {
+		t.Errorf("expected full refund to be approved, got %s", result.Status)
+	}
+
+	held := gateway.Authorize(ctx, PaymentRequest{Amount: 500, Card: card})
+	if result := gateway.Void(ctx, held.AuthorizationID); !result.Approved() {
+		t.Errorf("expected void to be approved, got %s", result.Status)
+	}
+	if result := gateway.Capture(ctx, held.AuthorizationID, 500); result.Approved() {
+		t.Errorf("expected capture after void to fail")
+	}
+
+	if result := gateway.Void(ctx, "unknown"); !errors.Is(result.Error, ErrUnknownAuthorization) {
+		t.Errorf("expected ErrUnknownAuthorization, got %v", result.Error)
+	}
+}
@@ -1,7 +1,14 @@
 package payment
 
-import "time"
+import (
+	"context"
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// PaymentData carries the customer's card details. For gift cards CardNumber
+// holds the gift card code and Cvv its PIN.
 type PaymentData struct {
 	CardNumber string
 	Cvv        string
@@ -18,17 +25,94 @@ const (
 	Crypto PaymentType = "Crypto"
 )
 
-type PaymentGateway interface {
-	ProcessPayment(p *PaymentData) bool
+// DefaultCurrency is used when a payment request does not specify one
+const DefaultCurrency = "USD"
+
+// PaymentStatus is the outcome of a payment operation
+type PaymentStatus string
+
+const (
+	Approved PaymentStatus = "APPROVED"
+	Declined PaymentStatus = "DECLINED"
+	TimedOut PaymentStatus = "TIMED_OUT"
+	Errored  PaymentStatus = "ERROR"
+)
+
+// PaymentRequest describes a charge against a card
+type PaymentRequest struct {
+	// Amount is the amount to charge in cents
+	Amount int
+
+	// Currency is the ISO 4217 currency code, defaults to USD
+	Currency string
+
+	// Card is the card to charge
+	Card *PaymentData
+
+	// Reference is our identifier for the payment, e.g. the order ID
+	Reference string
+
+	// AllowPartial lets the gateway approve less than Amount when the funds
+	// available (e.g. a gift card balance) don't cover it, for split tender
+	AllowPartial bool
 }
 
-type paymentGateway struct{}
+// PaymentResult is the structured response from a payment gateway
+type PaymentResult struct {
+	// AuthorizationID is the processor's identifier for the transaction
+	AuthorizationID string
 
-func NewPaymentGateway() PaymentGateway {
-	return &paymentGateway{}
+	// Status is the outcome of the operation
+	Status PaymentStatus
+
+	// Amount is the amount approved in cents, which may be less than requested
+	// for partial authorizations
+	Amount int
+
+	// DeclineCode is the processor's reason for a decline, e.g. "insufficient_funds"
+	DeclineCode string
+
+	// Error is set when the gateway could not complete the operation
+	Error error
+}
+
+// Approved reports whether the operation succeeded
+func (r PaymentResult) Approved() bool {
+	return r.Status == Approved
+}
+
+// PaymentGateway handles two-phase card payments: Authorize holds funds at
+// checkout, Capture collects them (possibly adjusted for tips and final fees)
+// at handoff, Void releases an uncaptured hold and Refund returns captured funds.
+type PaymentGateway interface {
+	Authorize(ctx context.Context, req PaymentRequest) PaymentResult
+	Capture(ctx context.Context, authorizationID string, amount int) PaymentResult
+	Void(ctx context.Context, authorizationID string) PaymentResult
+	Refund(ctx context.Context, authorizationID string, amount int) PaymentResult
 }
 
-func (pg *paymentGateway) ProcessPayment(p *PaymentData) bool {
-	time.Sleep(3 * time.Second)
-	return true
+// AuthorizationStatus is the lifecycle state of a persisted authorization
+type AuthorizationStatus string
+
+const (
+	AuthorizationPending    AuthorizationStatus = "PENDING" // awaiting customer action, e.g. a crypto transfer
+	AuthorizationDeclined   AuthorizationStatus = "DECLINED"
+	AuthorizationAuthorized AuthorizationStatus = "AUTHORIZED"
+	AuthorizationCaptured   AuthorizationStatus = "CAPTURED"
+	AuthorizationVoided     AuthorizationStatus = "VOIDED"
+	AuthorizationRefunded   AuthorizationStatus = "REFUNDED"
+)
+
+// Authorization records a card authorization made for an order
+type Authorization struct {
+	gorm.Model
+	OrderID         uint                `gorm:"column:order_id;not null;index" json:"orderId"`
+	AuthorizationID string              `gorm:"column:authorization_id;index" json:"authorizationId"`
+	Status          AuthorizationStatus `gorm:"column:status;not null" json:"status"`
+	Currency        string              `gorm:"column:currency" json:"currency"`
+	Amount          int                 `gorm:"column:amount" json:"amount"`                  // Authorized amount in cents
+	CapturedAmount  int                 `gorm:"column:captured_amount" json:"capturedAmount"` // Captured amount in cents
+	DeclineCode     string              `gorm:"column:decline_code" json:"declineCode,omitempty"`
+	PaymentType     PaymentType         `gorm:"column:payment_type" json:"paymentType"`
+	PaymentRequest  string              `gorm:"column:payment_request" json:"paymentRequest,omitempty"` // e.g. a crypto payment URI
 }
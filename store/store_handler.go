@@ -0,0 +1,192 @@
+package store
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type Handler struct {
+	service *Service
+}
+
+func NewHandler(service *Service) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// RegisterRoutes registers the public /locations endpoints and the admin
+// endpoints for managing locations, behind requireAdmin
+func RegisterRoutes(router fiber.Router, handler *Handler, requireAdmin fiber.Handler) {
+	router.Get("/locations", handler.ListLocations)
+	router.Get("/locations/:id", handler.GetLocation)
+
+	admin := router.Group("/admin/locations", requireAdmin)
+	admin.Post("/", handler.CreateLocation)
+	admin.Put("/:id", handler.UpdateLocation)
+	admin.Post("/:id/pause", handler.PauseLocation)
+	admin.Post("/:id/resume", handler.ResumeLocation)
+}
+
+// ListLocations returns every location
+func (h *Handler) ListLocations(c fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    h.service.List(),
+	})
+}
+
+// GetLocation returns a location's profile
+func (h *Handler) GetLocation(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	profile, err := h.service.Find(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "location not found",
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// CreateLocation adds a location
+func (h *Handler) CreateLocation(c fiber.Ctx) error {
+	var req Store
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+
+	profile, err := h.service.Create(&req)
+	if err != nil {
+		return profileError(c, err, "failed to create location")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// UpdateLocation replaces a location's profile
+func (h *Handler) UpdateLocation(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	var req Store
+	if err := c.Bind().Body(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "invalid request body",
+		})
+	}
+
+	profile, err := h.service.Update(uint(id), &req)
+	if err != nil {
+		return profileError(c, err, "failed to update location")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// PauseReq pauses online ordering, for Minutes or until resumed when zero
+type PauseReq struct {
+	Minutes int    `json:"minutes"`
+	Reason  string `json:"reason"`
+}
+
+// PauseLocation stops a location taking online orders
+func (h *Handler) PauseLocation(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	var req PauseReq
+	if err := c.Bind().Body(&req); err != nil || req.Minutes < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   "minutes must be zero or more",
+		})
+	}
+
+	var until *time.Time
+	if req.Minutes > 0 {
+		t := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		until = &t
+	}
+	profile, err := h.service.Pause(uint(id), until, req.Reason)
+	if err != nil {
+		return profileError(c, err, "failed to pause location")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+// ResumeLocation starts a paused location taking online orders again
+func (h *Handler) ResumeLocation(c fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return invalidLocationID(c)
+	}
+
+	profile, err := h.service.Resume(uint(id))
+	if err != nil {
+		return profileError(c, err, "failed to resume location")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success": true,
+		"data":    profile,
+	})
+}
+
+func invalidLocationID(c fiber.Ctx) error {
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"success": false,
+		"error":   "invalid location ID",
+	})
+}
+
+// profileError maps service errors to responses, logging unexpected ones
+func profileError(c fiber.Ctx, err error, message string) error {
+	switch {
+	case errors.Is(err, ErrInvalidProfile):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNotConfigured):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"error":   "location not found",
+		})
+	}
+	log.Printf("%s: %s", message, err.Error())
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"success": false,
+		"error":   message,
+	})
+}
@@ -0,0 +1,299 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"folo/tax"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotConfigured is returned when no store profile has been loaded
+	ErrNotConfigured = errors.New("store profile is not configured")
+	// ErrNotFound is returned for a location that doesn't exist
+	ErrNotFound = errors.New("location not found")
+	// ErrClosed is returned when ordering outside the store's opening hours
+	ErrClosed = errors.New("store is closed")
+	// ErrPaused is returned when online ordering has been paused
+	ErrPaused = errors.New("online ordering is paused")
+	// ErrInvalidProfile is returned for a store profile missing required details
+	ErrInvalidProfile = errors.New("invalid store profile")
+)
+
+// Store is the profile of one of the restaurant's locations: where orders are
+// picked up from, how to reach it, and when it takes orders. The API calls
+// stores locations.
+type Store struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex;not null" json:"name"`
+	Address     string `gorm:"not null" json:"address"`
+	PhoneNumber string `gorm:"not null" json:"phoneNumber"`
+	// PickupInstructions are shown to drivers collecting orders, e.g. where to park
+	PickupInstructions string `json:"pickupInstructions,omitempty"`
+	// Lat and Lng are where drivers pick up, if known
+	Lat *float64 `json:"lat,omitempty"`
+	Lng *float64 `json:"lng,omitempty"`
+	// Timezone is the IANA zone the hours are in, e.g. "America/Los_Angeles"
+	Timezone string `json:"timezone"`
+	// Hours are the weekly opening hours. A store without hours is always open.
+	Hours []Hours `gorm:"constraint:OnDelete:CASCADE" json:"hours"`
+	// Holidays replace the weekly hours on particular dates
+	Holidays []Holiday `gorm:"constraint:OnDelete:CASCADE" json:"holidays"`
+	// Paused stops online ordering until PausedUntil, or until resumed when
+	// PausedUntil is nil, e.g. when the kitchen is overwhelmed
+	Paused      bool       `json:"paused"`
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+	PauseReason string     `json:"pauseReason,omitempty"`
+	// PrepMinutes is how long a typical order takes to prepare, used for menu
+	// items without their own prep time
+	PrepMinutes int `json:"prepMinutes"`
+	// LoadMinutesPerTicket is added to ready time estimates for each ticket
+	// already open in the kitchen
+	LoadMinutesPerTicket int `json:"loadMinutesPerTicket"`
+	// TaxRate is the sales tax rate as a fraction, e.g. 0.08625
+	TaxRate float64 `json:"taxRate"`
+	// TaxRules set other rates for menu items in particular tax categories
+	TaxRules []TaxRule `gorm:"constraint:OnDelete:CASCADE" json:"taxRules"`
+	// TaxRounding is how fractional cents of tax are rounded, half_up when empty
+	TaxRounding tax.Rounding `json:"taxRounding,omitempty"`
+	// TaxPerLine rounds tax on each basket line instead of once per order
+	TaxPerLine bool `json:"taxPerLine"`
+	// TaxDeliveryFee charges TaxRate on the delivery fee
+	TaxDeliveryFee bool `json:"taxDeliveryFee"`
+}
+
+func (Store) TableName() string {
+	return "stores"
+}
+
+// TaxRule is the tax rate for a category of menu items, e.g. 0 for
+// "grocery" where groceries are exempt
+type TaxRule struct {
+	ID       uint    `gorm:"primarykey" json:"-"`
+	StoreID  uint    `gorm:"index;not null" json:"-"`
+	Category string  `gorm:"not null" json:"category"`
+	Rate     float64 `json:"rate"`
+}
+
+func (TaxRule) TableName() string {
+	return "store_tax_rules"
+}
+
+// Tax returns the rules orders at the location are taxed by
+func (s *Store) Tax() tax.Rules {
+	rules := tax.Rules{
+		Rate:           s.TaxRate,
+		Rounding:       s.TaxRounding,
+		PerLine:        s.TaxPerLine,
+		TaxDeliveryFee: s.TaxDeliveryFee,
+	}
+	if len(s.TaxRules) > 0 {
+		rules.CategoryRates = make(map[string]float64, len(s.TaxRules))
+		for _, r := range s.TaxRules {
+			rules.CategoryRates[r.Category] = r.Rate
+		}
+	}
+	return rules
+}
+
+// Hours is one opening period on a day of the week
+type Hours struct {
+	ID      uint   `gorm:"primarykey" json:"-"`
+	StoreID uint   `gorm:"index;not null" json:"-"`
+	Day     string `gorm:"not null" json:"day"`
+	// Opens and Closes are "15:04" times. Closing at or before opening means
+	// the period runs past midnight.
+	Opens  string `gorm:"not null" json:"opens"`
+	Closes string `gorm:"not null" json:"closes"`
+}
+
+func (Hours) TableName() string {
+	return "store_hours"
+}
+
+// Holiday replaces the weekly hours on one date, e.g. to close for
+// Thanksgiving or open late on New Year's Day
+type Holiday struct {
+	ID      uint `gorm:"primarykey" json:"-"`
+	StoreID uint `gorm:"index;not null" json:"-"`
+	// Date is "2006-01-02" in the store's time zone
+	Date string `gorm:"not null" json:"date"`
+	Name string `json:"name,omitempty"`
+	// Opens and Closes are the day's hours. Leave both empty to close all day.
+	Opens  string `json:"opens,omitempty"`
+	Closes string `json:"closes,omitempty"`
+}
+
+func (Holiday) TableName() string {
+	return "store_holidays"
+}
+
+// Closed reports whether the store is closed all day
+func (h Holiday) Closed() bool {
+	return h.Opens == "" && h.Closes == ""
+}
+
+// Validate checks the profile has what quotes, receipts and hours checks need
+func (s *Store) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProfile)
+	}
+	if strings.TrimSpace(s.Address) == "" {
+		return fmt.Errorf("%w: address is required", ErrInvalidProfile)
+	}
+	if strings.TrimSpace(s.PhoneNumber) == "" {
+		return fmt.Errorf("%w: phoneNumber is required", ErrInvalidProfile)
+	}
+	if (s.Lat == nil) != (s.Lng == nil) {
+		return fmt.Errorf("%w: lat and lng must be given together", ErrInvalidProfile)
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalidProfile, s.Timezone)
+	}
+	for _, h := range s.Hours {
+		if _, ok := weekdays[strings.ToLower(h.Day)]; !ok {
+			return fmt.Errorf("%w: unknown day %q", ErrInvalidProfile, h.Day)
+		}
+		if _, err := time.Parse(clock, h.Opens); err != nil {
+			return fmt.Errorf("%w: opens must be HH:MM, got %q", ErrInvalidProfile, h.Opens)
+		}
+		if _, err := time.Parse(clock, h.Closes); err != nil {
+			return fmt.Errorf("%w: closes must be HH:MM, got %q", ErrInvalidProfile, h.Closes)
+		}
+	}
+	for _, h := range s.Holidays {
+		if _, err := time.Parse(dateLayout, h.Date); err != nil {
+			return fmt.Errorf("%w: holiday date must be YYYY-MM-DD, got %q", ErrInvalidProfile, h.Date)
+		}
+		if h.Closed() {
+			continue
+		}
+		if _, err := time.Parse(clock, h.Opens); err != nil {
+			return fmt.Errorf("%w: holiday opens must be HH:MM, got %q", ErrInvalidProfile, h.Opens)
+		}
+		if _, err := time.Parse(clock, h.Closes); err != nil {
+			return fmt.Errorf("%w: holiday closes must be HH:MM, got %q", ErrInvalidProfile, h.Closes)
+		}
+	}
+	if s.PrepMinutes < 0 {
+		return fmt.Errorf("%w: prepMinutes cannot be negative", ErrInvalidProfile)
+	}
+	if s.LoadMinutesPerTicket < 0 {
+		return fmt.Errorf("%w: loadMinutesPerTicket cannot be negative", ErrInvalidProfile)
+	}
+	if s.TaxRate < 0 || s.TaxRate >= 1 {
+		return fmt.Errorf("%w: taxRate must be a fraction between 0 and 1", ErrInvalidProfile)
+	}
+	categories := make(map[string]bool, len(s.TaxRules))
+	for _, r := range s.TaxRules {
+		if strings.TrimSpace(r.Category) == "" {
+			return fmt.Errorf("%w: tax rule category is required", ErrInvalidProfile)
+		}
+		if categories[r.Category] {
+			return fmt.Errorf("%w: more than one tax rule for %q", ErrInvalidProfile, r.Category)
+		}
+		categories[r.Category] = true
+		if r.Rate < 0 || r.Rate >= 1 {
+			return fmt.Errorf("%w: tax rule rate for %q must be a fraction between 0 and 1", ErrInvalidProfile, r.Category)
+		}
+	}
+	if err := s.TaxRounding.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+	return nil
+}
+
+// TimeZone returns the store's time zone, UTC when none is set
+func (s *Store) TimeZone() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// IsOpen reports whether t falls in one of the store's opening periods,
+// including a period that started the day before and runs past midnight
+func (s *Store) IsOpen(t time.Time) bool {
+	local := t.In(s.TimeZone())
+	minute := local.Hour()*60 + local.Minute()
+
+	for _, p := range s.periodsOn(local) {
+		if minute >= p.opens && (p.overnight() || minute < p.closes) {
+			return true
+		}
+	}
+	for _, p := range s.periodsOn(local.AddDate(0, 0, -1)) {
+		if p.overnight() && minute < p.closes {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPaused reports whether online ordering is paused at now
+func (s *Store) IsPaused(now time.Time) bool {
+	return s.Paused && (s.PausedUntil == nil || now.Before(*s.PausedUntil))
+}
+
+// period is an opening period in minutes after midnight
+type period struct {
+	opens, closes int
+}
+
+// overnight reports whether the period runs past midnight
+func (p period) overnight() bool {
+	return p.closes <= p.opens
+}
+
+// periodsOn returns the opening periods starting on local's date: the
+// holiday hours if the date is a holiday, otherwise the weekly hours, or the
+// whole day for a store without weekly hours
+func (s *Store) periodsOn(local time.Time) []period {
+	date := local.Format(dateLayout)
+	for _, h := range s.Holidays {
+		if h.Date != date {
+			continue
+		}
+		if h.Closed() {
+			return nil
+		}
+		return []period{{opens: minuteOfDay(h.Opens), closes: minuteOfDay(h.Closes)}}
+	}
+
+	if len(s.Hours) == 0 {
+		return []period{{opens: 0, closes: 24 * 60}}
+	}
+	var periods []period
+	for _, h := range s.Hours {
+		if day, ok := weekdays[strings.ToLower(h.Day)]; ok && day == local.Weekday() {
+			periods = append(periods, period{opens: minuteOfDay(h.Opens), closes: minuteOfDay(h.Closes)})
+		}
+	}
+	return periods
+}
+
+const (
+	// clock is the layout opening hours are written in
+	clock = "15:04"
+	// dateLayout is the layout holiday dates are written in
+	dateLayout = "2006-01-02"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// minuteOfDay turns a validated "15:04" time into minutes after midnight
+func minuteOfDay(s string) int {
+	t, err := time.Parse(clock, s)
+	if err != nil {
+		return 0
+	}
+	return t.Hour()*60 + t.Minute()
+}
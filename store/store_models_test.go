@@ -0,0 +1,151 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsOpen(t *testing.T) {
+	profile := &Store{
+		Timezone: "America/Los_Angeles",
+		Hours: []Hours{
+			{Day: "monday", Opens: "11:00", Closes: "22:00"},
+			{Day: "friday", Opens: "11:00", Closes: "01:00"},
+		},
+	}
+	la, _ := time.LoadLocation("America/Los_Angeles")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"monday lunch", time.Date(2026, 10, 12, 12, 0, 0, 0, la), true},
+		{"monday before opening", time.Date(2026, 10, 12, 10, 59, 0, 0, la), false},
+		{"monday at closing", time.Date(2026, 10, 12, 22, 0, 0, 0, la), false},
+		{"tuesday has no hours", time.Date(2026, 10, 13, 12, 0, 0, 0, la), false},
+		{"friday late night", time.Date(2026, 10, 16, 23, 30, 0, 0, la), true},
+		{"saturday after midnight", time.Date(2026, 10, 17, 0, 30, 0, 0, la), true},
+		{"saturday after late close", time.Date(2026, 10, 17, 1, 0, 0, 0, la), false},
+		// 19:00 UTC is noon in Los Angeles
+		{"converted to the store's zone", time.Date(2026, 10, 12, 19, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := profile.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsOpen_Holidays(t *testing.T) {
+	profile := &Store{
+		Timezone: "America/Los_Angeles",
+		Hours: []Hours{
+			{Day: "thursday", Opens: "11:00", Closes: "22:00"},
+			{Day: "friday", Opens: "11:00", Closes: "01:00"},
+		},
+		Holidays: []Holiday{
+			{Date: "2026-11-26", Name: "Thanksgiving"},
+			{Date: "2026-11-27", Opens: "16:00", Closes: "20:00"},
+		},
+	}
+	la, _ := time.LoadLocation("America/Los_Angeles")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"thursday before the holiday", time.Date(2026, 11, 19, 12, 0, 0, 0, la), true},
+		{"closed all day", time.Date(2026, 11, 26, 12, 0, 0, 0, la), false},
+		{"short hours replace the weekly hours", time.Date(2026, 11, 27, 12, 0, 0, 0, la), false},
+		{"inside the short hours", time.Date(2026, 11, 27, 17, 0, 0, 0, la), true},
+		{"no late night on a short day", time.Date(2026, 11, 27, 23, 0, 0, 0, la), false},
+		{"no overnight spill from a short day", time.Date(2026, 11, 28, 0, 30, 0, 0, la), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := profile.IsOpen(tt.at); got != tt.want {
+				t.Errorf("IsOpen(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	// A holiday closes a store that otherwise has no hours
+	profile.Hours = nil
+	if profile.IsOpen(time.Date(2026, 11, 26, 12, 0, 0, 0, la)) {
+		t.Error("expected the store to be closed on the holiday")
+	}
+	if !profile.IsOpen(time.Date(2026, 11, 25, 12, 0, 0, 0, la)) {
+		t.Error("expected the store to be open the day before the holiday")
+	}
+}
+
+func TestIsPaused(t *testing.T) {
+	now := time.Now()
+	until := now.Add(30 * time.Minute)
+	profile := &Store{Paused: true, PausedUntil: &until}
+	if !profile.IsPaused(now) {
+		t.Error("expected the store to be paused")
+	}
+	if profile.IsPaused(until) {
+		t.Error("expected the pause to end at PausedUntil")
+	}
+	profile.PausedUntil = nil
+	if !profile.IsPaused(now.Add(24 * time.Hour)) {
+		t.Error("expected a pause without an end to last until resumed")
+	}
+}
+
+func TestIsOpen_WithoutHours(t *testing.T) {
+	profile := &Store{}
+	if !profile.IsOpen(time.Now()) {
+		t.Error("expected a store without hours to always be open")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Store {
+		return &Store{
+			Name:        "Folo",
+			Address:     "303 2nd St, San Francisco, CA 94107",
+			PhoneNumber: "+18564567890",
+			Timezone:    "America/Los_Angeles",
+			Hours:       []Hours{{Day: "Monday", Opens: "11:00", Closes: "22:00"}},
+			TaxRate:     0.08625,
+		}
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("expected a valid profile, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Store)
+	}{
+		{"missing address", func(s *Store) { s.Address = "" }},
+		{"missing phone", func(s *Store) { s.PhoneNumber = " " }},
+		{"unknown timezone", func(s *Store) { s.Timezone = "Mars/Olympus" }},
+		{"unknown day", func(s *Store) { s.Hours[0].Day = "someday" }},
+		{"bad opening time", func(s *Store) { s.Hours[0].Opens = "11am" }},
+		{"bad holiday date", func(s *Store) { s.Holidays = []Holiday{{Date: "11/26/2026"}} }},
+		{"holiday without closing", func(s *Store) { s.Holidays = []Holiday{{Date: "2026-11-26", Opens: "16:00"}} }},
+		{"tax rate as a percentage", func(s *Store) { s.TaxRate = 8.625 }},
+		{"tax rule without a category", func(s *Store) { s.TaxRules = []TaxRule{{Rate: 0.05}} }},
+		{"duplicate tax rules", func(s *Store) { s.TaxRules = []TaxRule{{Category: "grocery"}, {Category: "grocery", Rate: 0.01}} }},
+		{"unknown tax rounding", func(s *Store) { s.TaxRounding = "banker" }},
+		{"lat without lng", func(s *Store) { lat := 37.78; s.Lat = &lat }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := valid()
+			tt.modify(profile)
+			if err := profile.Validate(); !errors.Is(err, ErrInvalidProfile) {
+				t.Errorf("expected ErrInvalidProfile, got %v", err)
+			}
+		})
+	}
+}
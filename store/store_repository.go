@@ -0,0 +1,71 @@
+package store
+
+import (
+	"gorm.io/gorm"
+)
+
+// Repository handles database operations for store profiles
+type Repository interface {
+	FindAll() ([]Store, error)
+	Save(store *Store) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new store repository
+func NewRepository(db *gorm.DB) Repository {
+	return &repository{db: db}
+}
+
+// FindAll returns every store with its hours, oldest first
+func (r *repository) FindAll() ([]Store, error) {
+	var stores []Store
+	err := r.db.Preload("Hours").Preload("Holidays").Preload("TaxRules").Order("id").Find(&stores).Error
+	return stores, err
+}
+
+// Save creates or updates a store, replacing its hours, holidays and tax rules
+func (r *repository) Save(store *Store) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Hours", "Holidays", "TaxRules").Save(store).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("store_id = ?", store.ID).Delete(&Hours{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("store_id = ?", store.ID).Delete(&Holiday{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("store_id = ?", store.ID).Delete(&TaxRule{}).Error; err != nil {
+			return err
+		}
+		for i := range store.Hours {
+			store.Hours[i].ID = 0
+			store.Hours[i].StoreID = store.ID
+		}
+		for i := range store.Holidays {
+			store.Holidays[i].ID = 0
+			store.Holidays[i].StoreID = store.ID
+		}
+		for i := range store.TaxRules {
+			store.TaxRules[i].ID = 0
+			store.TaxRules[i].StoreID = store.ID
+		}
+		if len(store.Hours) > 0 {
+			if err := tx.Create(&store.Hours).Error; err != nil {
+				return err
+			}
+		}
+		if len(store.Holidays) > 0 {
+			if err := tx.Create(&store.Holidays).Error; err != nil {
+				return err
+			}
+		}
+		if len(store.TaxRules) > 0 {
+			return tx.Create(&store.TaxRules).Error
+		}
+		return nil
+	})
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Service keeps every location's profile in memory, so orders read them
+// without a database round trip, and persists changes to them
+type Service struct {
+	repo Repository
+
+	mu     sync.RWMutex
+	stores []*Store
+}
+
+// NewService creates a store service. Call Load before using the profiles.
+func NewService(repo Repository) *Service {
+	return &Service{repo: repo}
+}
+
+// Load reads the stored locations, then saves each profile in the JSON file
+// at path, if given, over the location with the same name. The file holds one
+// profile or an array of them.
+func (s *Service) Load(path string) error {
+	stores, err := s.repo.FindAll()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.stores = nil
+	for i := range stores {
+		s.stores = append(s.stores, &stores[i])
+	}
+	s.mu.Unlock()
+
+	if path != "" {
+		profiles, err := readProfiles(path)
+		if err != nil {
+			return err
+		}
+		for i := range profiles {
+			if err := s.saveByName(&profiles[i]); err != nil {
+				return fmt.Errorf("store profile %q: %w", profiles[i].Name, err)
+			}
+		}
+	}
+
+	if s.Default() == nil {
+		return ErrNotConfigured
+	}
+	return nil
+}
+
+// readProfiles parses a profile file holding either one profile or an array
+func readProfiles(path string) ([]Store, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []Store
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &profiles)
+	} else {
+		profiles = make([]Store, 1)
+		err = json.Unmarshal(data, &profiles[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid store profile %s: %w", path, err)
+	}
+	return profiles, nil
+}
+
+// saveByName updates the location with the profile's name, or creates one
+func (s *Service) saveByName(profile *Store) error {
+	s.mu.RLock()
+	var existing *Store
+	for _, st := range s.stores {
+		if strings.EqualFold(st.Name, profile.Name) {
+			existing = st
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if existing == nil {
+		_, err := s.Create(profile)
+		return err
+	}
+	_, err := s.Update(existing.ID, profile)
+	return err
+}
+
+// Default returns a copy of the first location, which serves requests that
+// don't name one, or nil when there are none
+func (s *Service) Default() *Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.stores) == 0 {
+		return nil
+	}
+	return clone(s.stores[0])
+}
+
+// Find returns a copy of a location, or of the default location when id is 0
+func (s *Service) Find(id uint) (*Store, error) {
+	if id == 0 {
+		if profile := s.Default(); profile != nil {
+			return profile, nil
+		}
+		return nil, ErrNotConfigured
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, st := range s.stores {
+		if st.ID == id {
+			return clone(st), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrNotFound, id)
+}
+
+// List returns copies of every location, oldest first
+func (s *Service) List() []Store {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stores := make([]Store, 0, len(s.stores))
+	for _, st := range s.stores {
+		stores = append(stores, *clone(st))
+	}
+	return stores
+}
+
+// Create validates and saves a new location
+func (s *Service) Create(profile *Store) (*Store, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	profile.ID = 0
+	if err := s.repo.Save(profile); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.stores = append(s.stores, clone(profile))
+	s.mu.Unlock()
+	return clone(profile), nil
+}
+
+// Update validates and saves a new profile for an existing location
+func (s *Service) Update(id uint, profile *Store) (*Store, error) {
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	existing, err := s.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	profile.ID = existing.ID
+	profile.CreatedAt = existing.CreatedAt
+	// Pausing has its own endpoints, so editing the profile leaves it alone
+	profile.Paused = existing.Paused
+	profile.PausedUntil = existing.PausedUntil
+	profile.PauseReason = existing.PauseReason
+	return s.save(profile)
+}
+
+// Pause stops online ordering at a location until the given time, or until
+// resumed when until is nil
+func (s *Service) Pause(id uint, until *time.Time, reason string) (*Store, error) {
+	profile, err := s.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	profile.Paused = true
+	profile.PausedUntil = until
+	profile.PauseReason = reason
+	return s.save(profile)
+}
+
+// Resume restarts online ordering at a paused location
+func (s *Service) Resume(id uint) (*Store, error) {
+	profile, err := s.Find(id)
+	if err != nil {
+		return nil, err
+	}
+	profile.Paused = false
+	profile.PausedUntil = nil
+	profile.PauseReason = ""
+	return s.save(profile)
+}
+
+// save persists an existing location and replaces the copy in memory
+func (s *Service) save(profile *Store) (*Store, error) {
+	if err := s.repo.Save(profile); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, st := range s.stores {
+		if st.ID == profile.ID {
+			s.stores[i] = clone(profile)
+		}
+	}
+	return clone(profile), nil
+}
+
+func clone(st *Store) *Store {
+	profile := *st
+	profile.Hours = append([]Hours(nil), st.Hours...)
+	profile.Holidays = append([]Holiday(nil), st.Holidays...)
+	profile.TaxRules = append([]TaxRule(nil), st.TaxRules...)
+	return &profile
+}
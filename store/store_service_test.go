@@ -0,0 +1,102 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"folo/database/databasetest"
+
+	"gorm.io/gorm"
+)
+
+// newTestDB opens an in-memory SQLite database with the store tables migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	return databasetest.Open(t, &Store{}, &Hours{}, &Holiday{}, &TaxRule{})
+}
+
+func TestLoad_RequiresAProfile(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	if err := service.Load(""); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("expected ErrNotConfigured, got %v", err)
+	}
+}
+
+func TestLoad_SavesProfilesByName(t *testing.T) {
+	db := newTestDB(t)
+	service := NewService(NewRepository(db))
+	soma, err := service.Create(&Store{Name: "Folo SoMa", Address: "1 Old St", PhoneNumber: "+18564567890"})
+	if err != nil {
+		t.Fatalf("unexpected error creating location: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "stores.json")
+	profiles := `[
+		{"name": "folo soma", "address": "303 2nd St, San Francisco, CA 94107", "phoneNumber": "+18564567890",
+		 "hours": [{"day": "monday", "opens": "11:00", "closes": "22:00"}]},
+		{"name": "Folo Mission", "address": "2128 Mission St, San Francisco, CA 94110", "phoneNumber": "+14155550100"}
+	]`
+	if err := os.WriteFile(path, []byte(profiles), 0o600); err != nil {
+		t.Fatalf("failed to write profiles: %v", err)
+	}
+
+	// A fresh service, as at startup
+	service = NewService(NewRepository(db))
+	if err := service.Load(path); err != nil {
+		t.Fatalf("unexpected error loading profiles: %v", err)
+	}
+
+	locations := service.List()
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 locations, got %d", len(locations))
+	}
+	updated, err := service.Find(0)
+	if err != nil {
+		t.Fatalf("unexpected error finding the default location: %v", err)
+	}
+	if updated.ID != soma.ID || updated.Address != "303 2nd St, San Francisco, CA 94107" || len(updated.Hours) != 1 {
+		t.Errorf("expected the existing location to be updated in place, got %+v", updated)
+	}
+	if _, err := service.Find(99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Profiles survive a restart without the file
+	service = NewService(NewRepository(db))
+	if err := service.Load(""); err != nil {
+		t.Fatalf("unexpected error reloading: %v", err)
+	}
+	if mission, err := service.Find(locations[1].ID); err != nil || mission.Name != "Folo Mission" {
+		t.Errorf("expected the new location to be stored, got %+v, %v", mission, err)
+	}
+}
+
+func TestPause_SurvivesProfileUpdates(t *testing.T) {
+	service := NewService(NewRepository(newTestDB(t)))
+	location, err := service.Create(&Store{Name: "Folo SoMa", Address: "303 2nd St", PhoneNumber: "+18564567890"})
+	if err != nil {
+		t.Fatalf("unexpected error creating location: %v", err)
+	}
+
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	if _, err := service.Pause(location.ID, &until, "kitchen backed up"); err != nil {
+		t.Fatalf("unexpected error pausing: %v", err)
+	}
+	updated, err := service.Update(location.ID, &Store{Name: "Folo SoMa", Address: "303 2nd St", PhoneNumber: "+14155550100"})
+	if err != nil {
+		t.Fatalf("unexpected error updating: %v", err)
+	}
+	if !updated.IsPaused(time.Now()) || updated.PauseReason != "kitchen backed up" {
+		t.Errorf("expected the pause to survive a profile update, got %+v", updated)
+	}
+
+	if _, err := service.Resume(location.ID); err != nil {
+		t.Fatalf("unexpected error resuming: %v", err)
+	}
+	if resumed, _ := service.Find(location.ID); resumed.IsPaused(time.Now()) {
+		t.Error("expected the location to be taking orders again")
+	}
+}
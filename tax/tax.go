@@ -0,0 +1,145 @@
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrInvalidRounding is returned for a rounding rule that doesn't exist
+var ErrInvalidRounding = errors.New("invalid tax rounding")
+
+// Rounding is how fractional cents of tax are rounded
+type Rounding string
+
+const (
+	// HalfUp rounds half a cent or more up, the usual rule for US sales tax
+	HalfUp Rounding = "half_up"
+	// HalfEven rounds half a cent to the nearest even cent
+	HalfEven Rounding = "half_even"
+	// Up rounds any fraction of a cent up
+	Up Rounding = "up"
+)
+
+// Validate checks the rounding is one we know. Empty means HalfUp.
+func (r Rounding) Validate() error {
+	switch r {
+	case "", HalfUp, HalfEven, Up:
+		return nil
+	}
+	return fmt.Errorf("%w: %q, expected %s, %s or %s", ErrInvalidRounding, r, HalfUp, HalfEven, Up)
+}
+
+// DeliveryFee is the category of the delivery fee's line
+const DeliveryFee = "delivery_fee"
+
+// Rules are how a location charges tax
+type Rules struct {
+	// Rate is the rate as a fraction, e.g. 0.08625, for lines whose category
+	// has no rate of its own
+	Rate float64
+	// CategoryRates override Rate for lines in a category, e.g. a lower rate
+	// for packaged beverages than for prepared food
+	CategoryRates map[string]float64
+	Rounding      Rounding
+	// PerLine rounds the tax on each line, rather than once on the total
+	PerLine bool
+	// TaxDeliveryFee charges Rate on the delivery fee, which is otherwise untaxed
+	TaxDeliveryFee bool
+}
+
+// Line is an amount to tax, e.g. one basket line
+type Line struct {
+	Name string `json:"name"`
+	// Category picks the line's rate from the rules' CategoryRates
+	Category string `json:"category,omitempty"`
+	Exempt   bool   `json:"exempt,omitempty"`
+	// Amount is the line's price in cents
+	Amount int `json:"amount"`
+	// Rate and Tax are set by Calculate
+	Rate float64 `json:"rate"`
+	Tax  int     `json:"tax"`
+}
+
+// Breakdown is the tax on each line and in total, in cents
+type Breakdown struct {
+	Lines []Line
+	Tax   int
+}
+
+// RateFor returns the rate a line is taxed at
+func (r Rules) RateFor(line Line) float64 {
+	switch {
+	case line.Exempt:
+		return 0
+	case line.Category == DeliveryFee:
+		if !r.TaxDeliveryFee {
+			return 0
+		}
+		return r.Rate
+	}
+	if rate, ok := r.CategoryRates[line.Category]; ok {
+		return rate
+	}
+	return r.Rate
+}
+
+// Calculate taxes the lines. Unless rounding per line, the exact tax of
+// every line is added up and rounded once, so the line taxes, which are each
+// rounded, may not add up to the total.
+func (r Rules) Calculate(lines []Line) Breakdown {
+	b := Breakdown{Lines: make([]Line, len(lines))}
+	var exact int64
+	for i, line := range lines {
+		line.Rate = r.RateFor(line)
+		tax := int64(line.Amount) * perMillion(line.Rate)
+		line.Tax = r.Rounding.round(tax)
+		b.Lines[i] = line
+
+		if r.PerLine {
+			b.Tax += line.Tax
+		} else {
+			exact += tax
+		}
+	}
+	if !r.PerLine {
+		b.Tax = r.Rounding.round(exact)
+	}
+	return b
+}
+
+// million is the denominator taxes are worked out over, so rates with up to
+// six decimal places are exact
+const million = 1_000_000
+
+// perMillion turns a rate into parts per million, e.g. 0.08625 into 86250
+func perMillion(rate float64) int64 {
+	return int64(math.Round(rate * million))
+}
+
+// round turns an amount in millionths of a cent into whole cents
+func (r Rounding) round(amount int64) int {
+	negative := amount < 0
+	if negative {
+		amount = -amount
+	}
+	cents, rest := amount/million, amount%million
+	switch r {
+	case Up:
+		if rest > 0 {
+			cents++
+		}
+	case HalfEven:
+		if rest > million/2 || (rest == million/2 && cents%2 == 1) {
+			cents++
+		}
+	default:
+		if rest >= million/2 {
+			cents++
+		}
+	}
+	if negative {
+		cents = -cents
+	}
+	return int(cents)
+}
@@ -0,0 +1,90 @@
+package tax
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCalculate_RatesByCategory(t *testing.T) {
+	rules := Rules{
+		Rate:          0.08625,
+		CategoryRates: map[string]float64{"packaged_beverage": 0.05},
+	}
+	b := rules.Calculate([]Line{
+		{Name: "Burrito", Amount: 1200},
+		{Name: "Bottled water", Category: "packaged_beverage", Amount: 300},
+		{Name: "Gift card", Amount: 2500, Exempt: true},
+		{Name: "Delivery fee", Category: DeliveryFee, Amount: 500},
+	})
+
+	want := []struct {
+		rate float64
+		tax  int
+	}{
+		{0.08625, 104}, // 103.5 rounds up
+		{0.05, 15},
+		{0, 0},
+		{0, 0},
+	}
+	for i, w := range want {
+		if got := b.Lines[i]; got.Rate != w.rate || got.Tax != w.tax {
+			t.Errorf("line %q: expected %d at %v, got %d at %v", got.Name, w.tax, w.rate, got.Tax, got.Rate)
+		}
+	}
+	// 103.5 + 15 rounds once to 119
+	if b.Tax != 119 {
+		t.Errorf("expected 119 in tax, got %d", b.Tax)
+	}
+}
+
+func TestCalculate_TaxesDeliveryFee(t *testing.T) {
+	rules := Rules{Rate: 0.1, TaxDeliveryFee: true}
+	b := rules.Calculate([]Line{{Name: "Delivery fee", Category: DeliveryFee, Amount: 500}})
+	if b.Tax != 50 {
+		t.Errorf("expected 50 in tax on the delivery fee, got %d", b.Tax)
+	}
+}
+
+func TestCalculate_Rounding(t *testing.T) {
+	// Each line is taxed 12.5 cents
+	lines := []Line{{Name: "A", Amount: 250}, {Name: "B", Amount: 250}, {Name: "C", Amount: 250}}
+
+	tests := []struct {
+		name     string
+		rounding Rounding
+		perLine  bool
+		want     int
+	}{
+		{"half up on the total", HalfUp, false, 38},     // 37.5
+		{"half up per line", HalfUp, true, 39},          // 13 * 3
+		{"half even on the total", HalfEven, false, 38}, // 37.5 to the even 38
+		{"half even per line", HalfEven, true, 36},      // 12.5 to the even 12, * 3
+		{"up per line", Up, true, 39},
+		{"default is half up", "", false, 38},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := Rules{Rate: 0.05, Rounding: tt.rounding, PerLine: tt.perLine}
+			if got := rules.Calculate(lines).Tax; got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCalculate_ExactForDecimalRates(t *testing.T) {
+	// 200 * 0.0725 is 14.5, which floating point puts just below
+	rules := Rules{Rate: 0.0725}
+	if got := rules.Calculate([]Line{{Name: "Taco", Amount: 200}}).Tax; got != 15 {
+		t.Errorf("expected 14.5 to round up to 15, got %d", got)
+	}
+}
+
+func TestRounding_Validate(t *testing.T) {
+	if err := Rounding("banker").Validate(); !errors.Is(err, ErrInvalidRounding) {
+		t.Errorf("expected ErrInvalidRounding, got %v", err)
+	}
+	if err := HalfEven.Validate(); err != nil {
+		t.Errorf("expected half_even to be valid, got %v", err)
+	}
+}